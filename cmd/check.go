@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"site-mirror/internal/linkcheck"
+	"site-mirror/internal/logging"
+	"site-mirror/internal/parser"
+	"site-mirror/mirror"
+	"syscall"
+)
+
+const checkUsage = "Usage: site-mirror check -url URL [-format text|json|junit] [-report FILE] [flags]\n\n" +
+	"Crawl the site without saving anything and report broken links grouped by page:\n" +
+	"failed pages, resources and external links checked with HEAD (GET if HEAD is\n" +
+	"rejected), and #anchors missing on the target page. Crawl flags are the same as\n" +
+	"for mirror. Exits with 0 if all links work, 3 if broken links were found.\n\nFlags:\n"
+
+// discard - хранилище проверки ссылок, тела страниц не сохраняются.
+type discard struct{}
+
+func (discard) Save(*url.URL, []byte, string) error { return nil }
+
+func runCheck(args []string, stdout, stderr io.Writer) int {
+	var format, reportFile string
+	external := true
+	cfg, err := parser.LoadCommandFlags("check", checkUsage, args, os.Getenv, func(fs *flag.FlagSet) {
+		fs.StringVar(&format, "format", linkcheck.FormatText, "Report format: text, json or junit")
+		fs.StringVar(&reportFile, "report", "", "Write the report to FILE instead of stdout")
+		fs.BoolVar(&external, "external", true, "Check links to other hosts")
+	})
+	if code, done := configExit(err, stderr); done {
+		return code
+	}
+	if err = (&linkcheck.Report{}).Write(io.Discard, format); err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+
+	logger, err := logging.New(stderr, cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	// Проверка ничего не пишет в -out: ни журнала, ни манифеста, ни контрольной точки.
+	cfg.EventLog = ""
+	cfg.CheckpointFile = ""
+	cfg.Transforms = nil
+
+	crawler, err := mirror.New(mirror.Options{
+		Config:    *cfg,
+		Storage:   discard{},
+		Logger:    logger,
+		Output:    stderr,
+		UserAgent: userAgent,
+		PagesOnly: true,
+	})
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	checker := linkcheck.New(cfg.StartURL)
+	checker.External = external
+	checker.Workers = cfg.Concurrency
+	checker.Logger = logger
+	crawler.Subscribe(checker.Handle, mirror.Saved, mirror.Failed, mirror.Skipped)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if _, err = crawler.Run(ctx); err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	prober := mirror.NewFetcher(mirror.Options{Config: *cfg, Logger: logger, UserAgent: userAgent})
+	report := checker.Check(prober)
+
+	if reportFile == "" {
+		err = report.Write(stdout, format)
+	} else {
+		err = writeReport(reportFile, report, format)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	if report.Broken() > 0 {
+		return exitCheckFailed
+	}
+	return exitOK
+}
+
+func writeReport(path string, report *linkcheck.Report, format string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err = report.Write(f, format); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
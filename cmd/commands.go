@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"site-mirror/internal/config"
+	"site-mirror/internal/eventlog"
+	"site-mirror/internal/parser"
+	"site-mirror/internal/progress"
+	"site-mirror/internal/robots"
+	"site-mirror/mirror"
+	"strings"
+)
+
+// Коды выхода подкоманд.
+const (
+	exitOK = iota
+	exitError
+	exitUsage
+	// exitCheckFailed - проверка выполнена, но результат отрицательный:
+	// verify нашёл расхождения, check - битые ссылки, robots запрещает URL.
+	exitCheckFailed
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdout, stderr io.Writer) int
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"mirror", "download a site (default when the first argument is a flag)", runMirror},
+		{"resume", "continue a stopped crawl from its checkpoint", runResume},
+		{"update", "re-crawl an existing mirror, skipping unchanged files", runUpdate},
+		{"watch", "re-crawl on an interval and report changed pages", runWatch},
+		{"check", "report broken links of a site without saving it", runCheck},
+		{"verify", "check the mirror against its manifest", runVerify},
+		{"diff", "compare two snapshots of a mirror", runDiff},
+		{"serve", "browse a mirror over HTTP", runServe},
+		{"proxy", "record a browser session into a mirror", runProxy},
+		{"replay", "browse WARC archives by URL and capture time", runReplay},
+		{"graph", "export the recorded link graph and its stats", runGraph},
+		{"dups", "list clusters of near-duplicate pages", runDups},
+		{"stats", "summarize a previous run from its event log", runStats},
+		{"robots", "test a URL against the site's robots.txt", runRobots},
+		{"ctl", "control a running crawl", runCtl},
+		{"config", "print the effective configuration (config print)", runConfig},
+	}
+}
+
+func usage(w io.Writer) {
+	_, _ = fmt.Fprint(w, "Usage: site-mirror COMMAND [flags]\n\nCommands:\n")
+	for _, c := range commands {
+		_, _ = fmt.Fprintf(w, "  %-8s %s\n", c.name, c.summary)
+	}
+	_, _ = fmt.Fprint(w, "\nRun 'site-mirror COMMAND -h' for command flags.\n")
+}
+
+// run выбирает подкоманду. Запуск с флагами без команды - прежний вызов mirror.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return exitUsage
+	}
+	switch name := args[0]; {
+	case name == "-h" || name == "-help" || name == "--help" || name == "help":
+		usage(stdout)
+		return exitOK
+	case strings.HasPrefix(name, "-"):
+		return runMirror(args, stdout, stderr)
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(args[1:], stdout, stderr)
+		}
+	}
+	_, _ = fmt.Fprintf(stderr, "unknown command %q\n\n", args[0])
+	usage(stderr)
+	return exitUsage
+}
+
+const (
+	mirrorUsage = "Usage: site-mirror mirror -url URL [flags]\n\nDownload a site into -out.\n\nFlags:\n"
+	resumeUsage = "Usage: site-mirror resume -url URL [flags]\n\nContinue a crawl stopped with 'ctl stop' from -checkpoint in -out.\n\nFlags:\n"
+	updateUsage = "Usage: site-mirror update -url URL [flags]\n\nRe-crawl the mirror in -out. Files are requested with If-Modified-Since\n" +
+		"and kept when the server answers 304, links are taken from the stored copy.\n\nFlags:\n"
+)
+
+func runMirror(args []string, _, stderr io.Writer) int {
+	return crawl("mirror", mirrorUsage, args, stderr, func(*config.Config) {})
+}
+
+func runResume(args []string, _, stderr io.Writer) int {
+	return crawl("resume", resumeUsage, args, stderr, func(cfg *config.Config) { cfg.Resume = true })
+}
+
+func runUpdate(args []string, _, stderr io.Writer) int {
+	return crawl("update", updateUsage, args, stderr, func(cfg *config.Config) { cfg.Update = true })
+}
+
+func crawl(name, help string, args []string, stderr io.Writer, setup func(cfg *config.Config)) int {
+	cfg, err := parser.LoadCommand(name, help, args, os.Getenv)
+	if code, done := configExit(err, stderr); done {
+		return code
+	}
+	setup(cfg)
+	if err = runApp(cfg); err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	return exitOK
+}
+
+// configExit переводит ошибку разбора флагов и конфигурации в код выхода.
+func configExit(err error, stderr io.Writer) (int, bool) {
+	switch {
+	case err == nil:
+		return exitOK, false
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK, true
+	default:
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitUsage, true
+	}
+}
+
+const configUsage = "Usage: site-mirror config print [-format yaml|json|toml] [flags]\n\n" +
+	"Print the configuration merged from defaults, -config, SITE_MIRROR_* and flags.\n\nFlags:\n"
+
+func runConfig(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "print" {
+		_, _ = fmt.Fprint(stderr, configUsage)
+		return exitUsage
+	}
+	err := parser.PrintConfig(stdout, configUsage, args[1:], os.Getenv)
+	code, _ := configExit(err, stderr)
+	return code
+}
+
+const statsUsage = "Usage: site-mirror stats [-out DIR] [-event-log FILE] [-json]\n\nSummarize a previous run from its event log.\n\nFlags:\n"
+
+func runStats(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("stats", statsUsage, stderr)
+	out := fs.String("out", "./", "Mirror directory")
+	logFile := fs.String("event-log", eventlog.DefaultFile, "Event log of the run, relative to -out")
+	asJSON := fs.Bool("json", false, "Print summary as JSON")
+	if code, done := parseFlags(fs, args, 0); done {
+		return code
+	}
+
+	records, err := eventlog.Read(mirror.OutputPath(*out, *logFile))
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	summary := progress.Summarize(records)
+	if *asJSON {
+		err = summary.WriteJSON(stdout)
+	} else {
+		err = summary.WriteText(stdout)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	return exitOK
+}
+
+const robotsUsage = "Usage: site-mirror robots [-agent NAME] URL\n\n" +
+	"Check URL against robots.txt of its host. Exits with 0 if allowed, 3 if disallowed.\n\nFlags:\n"
+
+func runRobots(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("robots", robotsUsage, stderr)
+	agent := fs.String("agent", userAgent, "User agent to check rules for")
+	if code, done := parseFlags(fs, args, 1); done {
+		return code
+	}
+
+	u, err := url.Parse(fs.Arg(0))
+	if err != nil || u.Host == "" {
+		_, _ = fmt.Fprintf(stderr, "invalid URL %q\n", fs.Arg(0))
+		return exitUsage
+	}
+	r, err := robots.FetchRobots(u.Host)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	if !r.IsAllowed(*agent, u) {
+		_, _ = fmt.Fprintf(stdout, "disallowed: %s for %s\n", u, *agent)
+		return exitCheckFailed
+	}
+	_, _ = fmt.Fprintf(stdout, "allowed: %s for %s\n", u, *agent)
+	return exitOK
+}
+
+func newFlagSet(name, help string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprint(stderr, help)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags разбирает флаги подкоманды и проверяет число позиционных аргументов.
+func parseFlags(fs *flag.FlagSet, args []string, nargs int) (int, bool) {
+	return parseFlagsRange(fs, args, nargs, nargs)
+}
+
+// parseFlagsRange - parseFlags для подкоманды с необязательными позиционными
+// аргументами: их должно быть от minArgs до maxArgs.
+func parseFlagsRange(fs *flag.FlagSet, args []string, minArgs, maxArgs int) (int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK, true
+		}
+		return exitUsage, true
+	}
+	if fs.NArg() < minArgs || fs.NArg() > maxArgs {
+		fs.Usage()
+		return exitUsage, true
+	}
+	return exitOK, false
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"site-mirror/internal/control"
+	"strconv"
+	"strings"
+)
+
+const ctlUsage = `Usage: site-mirror ctl [-addr ADDR] [-token-file FILE] COMMAND [ARGS]
+
+Commands:
+  status             show crawl state
+  pause              stop handing out new tasks
+  resume             continue after pause
+  workers N          change number of workers
+  seed URL...        add seed URLs
+  exclude PATTERN    skip URLs matching regexp (-kind page|resource, default both)
+  stop               stop gracefully and write checkpoint
+
+Flags:
+`
+
+// runCtl выполняет команду "site-mirror ctl" и возвращает код выхода:
+// 0 - успех, 1 - ошибка запроса, 2 - неверные аргументы.
+func runCtl(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("ctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	addr := fs.String("addr", control.DefaultAddr, "Control API address: host:port or unix:/path")
+	tokenFile := fs.String("token-file", control.DefaultTokenFile, "Token written by the crawl to -control-token-file")
+	kind := fs.String("kind", "", "Task kind for exclude: page or resource (default both)")
+	fs.Usage = func() {
+		_, _ = fmt.Fprint(stderr, ctlUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	// Флаги допускаются и после команды: "ctl exclude -kind page PATTERN".
+	cmd := fs.Arg(0)
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return 2
+	}
+	rest := fs.Args()
+
+	token, err := os.ReadFile(*tokenFile)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "reading control token: %v\n", err)
+		return 1
+	}
+	c := control.NewClient(*addr)
+	c.Token = strings.TrimSpace(string(token))
+	var out any
+	switch {
+	case cmd == "status" && len(rest) == 0:
+		out, err = c.State()
+	case cmd == "pause" && len(rest) == 0:
+		out, err = c.Pause()
+	case cmd == "resume" && len(rest) == 0:
+		out, err = c.Resume()
+	case cmd == "stop" && len(rest) == 0:
+		out, err = c.Stop()
+	case cmd == "workers" && len(rest) == 1:
+		n, errConv := strconv.Atoi(rest[0])
+		if errConv != nil {
+			_, _ = fmt.Fprintf(stderr, "invalid worker count %q\n", rest[0])
+			return 2
+		}
+		out, err = c.SetWorkers(n)
+	case cmd == "seed" && len(rest) > 0:
+		var resp control.SeedsResponse
+		resp, err = c.AddSeeds(rest)
+		out = resp
+		if err == nil && len(resp.Rejected) > 0 {
+			err = fmt.Errorf("%d of %d seeds rejected", len(resp.Rejected), len(rest))
+		}
+	case cmd == "exclude" && len(rest) == 1:
+		out, err = c.AddExclude(*kind, rest[0])
+	default:
+		fs.Usage()
+		return 2
+	}
+
+	if out != nil {
+		if printErr := printJSON(stdout, out); printErr != nil && err == nil {
+			err = printErr
+		}
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func printJSON(w io.Writer, v any) error {
+	if raw, ok := v.(json.RawMessage); ok {
+		if len(raw) == 0 {
+			return nil
+		}
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, raw, "", "  "); err != nil {
+			return err
+		}
+		buf.WriteByte('\n')
+		_, err := w.Write(buf.Bytes())
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
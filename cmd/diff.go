@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"site-mirror/internal/diff"
+	"site-mirror/internal/parser"
+	"site-mirror/internal/storage"
+	"site-mirror/mirror"
+)
+
+const diffUsage = "Usage: site-mirror diff [-out DIR] [-ignore SELECTORS] [-context N] [-json] [OLD [NEW]]\n\n" +
+	"Compare two snapshots saved with -snapshot: added, removed and changed URLs, text\n" +
+	"changes of HTML pages and other text files, size changes of binary files. Pages are\n" +
+	"compared by visible text: whitespace, scripts and -ignore elements don't count.\n" +
+	"OLD and NEW are snapshot names in -out/" + storage.SnapshotDir + " or mirror directories; by\n" +
+	"default the two latest snapshots are compared, with only OLD - OLD and the latest.\n\nFlags:\n"
+
+func runDiff(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("diff", diffUsage, stderr)
+	out := fs.String("out", "./", "Mirror directory with snapshots")
+	manifestFile := fs.String("manifest", storage.DefaultManifestFile, "Manifest of each snapshot, relative to the snapshot")
+	ignore := fs.String("ignore", "", "Ignore changes in HTML elements, e.g. time,.counter,meta[name=csrf-token]")
+	context := fs.Int("context", 2, "Lines of context around text changes")
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+	if code, done := parseFlagsRange(fs, args, 0, 2); done {
+		return code
+	}
+	sels, err := parser.ParseSelectors(*ignore)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+
+	names := fs.Args()
+	if len(names) < 2 {
+		snapshots, errList := storage.Snapshots(*out)
+		if errList != nil {
+			_, _ = fmt.Fprintln(stderr, errList)
+			return exitError
+		}
+		if len(snapshots) < 2-len(names) {
+			_, _ = fmt.Fprintf(stderr, "%d snapshots in %s, need two to compare\n", len(snapshots), *out)
+			return exitUsage
+		}
+		names = append(names, snapshots[len(snapshots)-2+len(names):]...)
+	}
+
+	var sides [2]diff.Snapshot
+	for i, name := range names {
+		if sides[i], err = openSnapshot(*out, name, *manifestFile); err != nil {
+			_, _ = fmt.Fprintln(stderr, err)
+			return exitError
+		}
+	}
+	report, err := diff.Compare(sides[0], sides[1], diff.Options{Ignore: sels, Context: *context})
+	if err == nil {
+		if *asJSON {
+			err = report.WriteJSON(stdout)
+		} else {
+			err = report.WriteText(stdout)
+		}
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	return exitOK
+}
+
+// openSnapshot находит снимок name в out или каталог зеркала по пути name и читает его манифест.
+func openSnapshot(out, name, manifestFile string) (diff.Snapshot, error) {
+	dir := storage.SnapshotPath(out, name)
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		dir = name
+	}
+	path := mirror.OutputPath(dir, manifestFile)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return diff.Snapshot{}, fmt.Errorf("no snapshot %s in %s", name, filepath.Join(out, storage.SnapshotDir))
+	}
+	m, err := storage.ReadManifest(path)
+	if err != nil {
+		return diff.Snapshot{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return diff.Snapshot{Name: name, Dir: dir, Manifest: m}, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"site-mirror/internal/neardup"
+	"site-mirror/mirror"
+)
+
+const dupsUsage = "Usage: site-mirror dups [-out DIR] [-near-dup-report FILE] [-json]\n\n" +
+	"Print clusters of near-duplicate pages found by a crawl with -near-dup: the first\n" +
+	"page of each cluster and pages with almost the same visible text, with similarity.\n\nFlags:\n"
+
+func runDups(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("dups", dupsUsage, stderr)
+	out := fs.String("out", "./", "Mirror directory")
+	reportFile := fs.String("near-dup-report", neardup.DefaultFile, "Near-duplicates report of the crawl, relative to -out")
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+	if code, done := parseFlags(fs, args, 0); done {
+		return code
+	}
+
+	report, err := neardup.Read(mirror.OutputPath(*out, *reportFile))
+	if err == nil {
+		if *asJSON {
+			err = report.WriteJSON(stdout)
+		} else {
+			err = report.WriteText(stdout)
+		}
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	return exitOK
+}
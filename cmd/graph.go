@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"site-mirror/internal/linkgraph"
+	"site-mirror/mirror"
+)
+
+const graphUsage = "Usage: site-mirror graph [-out DIR] [-link-graph FILE] [-format csv|graphml|dot|stats] [-json]\n\n" +
+	"Export the link graph recorded by a crawl with -link-graph as a CSV edge list,\n" +
+	"GraphML or Graphviz DOT, or print stats: most linked URLs, pages found only via\n" +
+	"sitemap.xml and pages by depth.\n\nFlags:\n"
+
+func runGraph(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("graph", graphUsage, stderr)
+	out := fs.String("out", "./", "Mirror directory")
+	graphFile := fs.String("link-graph", linkgraph.DefaultFile, "Link graph of the crawl, relative to -out")
+	format := fs.String("format", "stats", "Output: csv, graphml, dot or stats")
+	top := fs.Int("top", 20, "Most linked URLs in stats")
+	asJSON := fs.Bool("json", false, "Print stats as JSON")
+	if code, done := parseFlags(fs, args, 0); done {
+		return code
+	}
+
+	g, err := linkgraph.Read(mirror.OutputPath(*out, *graphFile))
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	switch {
+	case *format != "stats":
+		err = g.Write(stdout, *format)
+	case *asJSON:
+		err = g.Stats(*top).WriteJSON(stdout)
+	default:
+		err = g.Stats(*top).WriteText(stdout)
+	}
+	if errors.Is(err, linkgraph.ErrUnknownFormat) {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	return exitOK
+}
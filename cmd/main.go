@@ -1,96 +1,114 @@
 package main
 
 import (
-	"errors"
-	"fmt"
+	"context"
+	"log/slog"
 	"os"
+	"os/signal"
+	"site-mirror/internal/admin"
 	"site-mirror/internal/config"
-	"site-mirror/internal/downloader"
-	"site-mirror/internal/parser"
-	"site-mirror/internal/queue"
-	"site-mirror/internal/storage"
-	"sync"
+	"site-mirror/internal/control"
+	"site-mirror/internal/hooks"
+	"site-mirror/internal/logging"
+	"site-mirror/internal/metrics"
+	"site-mirror/mirror"
+	"syscall"
 )
 
-func printErrAndExit(err error) {
-	_, err = fmt.Fprintln(os.Stderr, err)
-	if err != nil {
-		panic(err)
-	}
-	os.Exit(1)
-}
+const userAgent = mirror.DefaultUserAgent
 
 func main() {
-	if err := runApp("SiteMirror"); err != nil {
-		printErrAndExit(err)
-	}
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
 }
 
-func runApp(userAgent string) error {
-	cfg, err := parser.ParseArgs()
+func runApp(cfg *config.Config) error {
+	logger, err := logging.New(os.Stderr, cfg.LogLevel, cfg.LogFormat)
 	if err != nil {
 		return err
 	}
+	slog.SetDefault(logger)
 
-	q := queue.NewQueue(1000, cfg.StartURL.Host)
-	dwnld, err := downloader.NewDownloader(cfg.StartURL, userAgent)
+	registry := metrics.NewRegistry()
+	crawler, err := mirror.New(mirror.Options{
+		Config:    *cfg,
+		Logger:    logger,
+		Metrics:   registry,
+		Output:    os.Stderr,
+		UserAgent: userAgent,
+	})
 	if err != nil {
 		return err
 	}
-	st := storage.NewStorage(cfg.OutputDir)
-	pars := parser.NewParser()
 
-	wg := &sync.WaitGroup{}
-	wg.Add(cfg.Concurrency)
-	for range cfg.Concurrency {
-		go runWorker(q, pars, dwnld, st, cfg, wg)
+	if sinks := hookSinks(cfg); len(sinks) > 0 {
+		dispatcher := hooks.NewDispatcher(sinks...)
+		dispatcher.Logger = logger
+		crawler.Subscribe(dispatcher.Handle, cfg.HookEvents...)
+		defer dispatcher.Close()
+	}
+
+	if cfg.AdminAddr != "" {
+		adminSrv := admin.NewServer(cfg.AdminAddr, registry, func() any { return crawler.Status() })
+		if err = adminSrv.Start(); err != nil {
+			return err
+		}
+		defer func() {
+			if errClose := adminSrv.Close(); errClose != nil {
+				slog.Error("closing admin server", "err", errClose)
+			}
+		}()
 	}
 
-	initTask := queue.Task{URL: cfg.StartURL, Depth: 0, Type: "page"}
-	err = q.Enqueue(initTask, cfg.Depth)
+	if cfg.ControlAddr != "" {
+		ctlSrv := control.NewServer(cfg.ControlAddr, crawler)
+		ctlSrv.TokenFile = mirror.OutputPath(cfg.OutputDir, cfg.ControlTokenFile)
+		if err = ctlSrv.Start(); err != nil {
+			return err
+		}
+		defer func() {
+			if errClose := ctlSrv.Close(); errClose != nil {
+				slog.Error("closing control server", "err", errClose)
+			}
+		}()
+	}
+
+	// Прерывание останавливает обход так же, как "ctl stop".
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	result, err := crawler.Run(ctx)
 	if err != nil {
 		return err
 	}
-
-	fmt.Println("Processing...")
-	q.WaitAndClose()
-	fmt.Println("Done")
-	return nil
+	return writeSummary(cfg, result)
 }
 
-func runWorker(q *queue.Queue, pars *parser.Parser, dwnld *downloader.Downloader, st *storage.Storage, cfg *config.Config, wg *sync.WaitGroup) {
-	defer wg.Done()
-	for task := range q.Dequeue() {
-		body, ctype, err := dwnld.Download(task.URL, cfg.UseRobots)
-		if err != nil && !errors.Is(err, downloader.ErrTooManyAttempts) {
-			printErrAndExit(err)
-		}
+func hookSinks(cfg *config.Config) []hooks.Sink {
+	var sinks []hooks.Sink
+	if cfg.HookExec != "" {
+		sinks = append(sinks, hooks.Exec{Command: cfg.HookExec})
+	}
+	if cfg.HookURL != "" {
+		sinks = append(sinks, hooks.Webhook{URL: cfg.HookURL})
+	}
+	return sinks
+}
 
-		err = st.Save(task.URL, body, ctype)
-		if err != nil {
-			printErrAndExit(err)
-		}
+func writeSummary(cfg *config.Config, summary *mirror.Result) error {
+	if err := summary.WriteText(os.Stdout); err != nil {
+		return err
+	}
+	if cfg.SummaryJSON == "" {
+		return nil
+	}
 
-		if task.Depth < cfg.Depth {
-			pages, resources, errParser := pars.ParseHTML(body, task.URL)
-			if errParser != nil {
-				printErrAndExit(errParser)
-			}
-			for _, page := range pages {
-				newTask := queue.Task{URL: page, Depth: task.Depth + 1, Type: "page"}
-				err = q.Enqueue(newTask, cfg.Depth)
-				if err != nil {
-					continue
-				}
-			}
-			for _, resource := range resources {
-				newTask := queue.Task{URL: resource, Depth: task.Depth + 1, Type: "page"}
-				err = q.Enqueue(newTask, cfg.Depth)
-				if err != nil {
-					continue
-				}
-			}
-		}
-		q.Done()
+	f, err := os.Create(mirror.OutputPath(cfg.OutputDir, cfg.SummaryJSON))
+	if err != nil {
+		return err
+	}
+	if err = summary.WriteJSON(f); err != nil {
+		_ = f.Close()
+		return err
 	}
+	return f.Close()
 }
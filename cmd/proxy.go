@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"site-mirror/internal/eventlog"
+	"site-mirror/internal/logging"
+	"site-mirror/internal/proxy"
+	"site-mirror/internal/storage"
+	"site-mirror/mirror"
+	"syscall"
+	"time"
+)
+
+const proxyUsage = "Usage: site-mirror proxy [-addr ADDR] [-out DIR] [flags]\n\n" +
+	"Run an HTTP proxy that saves every response into the mirror in -out. Point the\n" +
+	"browser at -addr and trust the -ca-cert certificate to record HTTPS sites; the CA\n" +
+	"is created on first run.\n\nFlags:\n"
+
+func runProxy(args []string, stdout, stderr io.Writer) int {
+	caCert, caKey := defaultCAFiles()
+	flags := newFlagSet("proxy", proxyUsage, stderr)
+	addr := flags.String("addr", "127.0.0.1:8081", "Listen address")
+	out := flags.String("out", "./", "Mirror directory")
+	logFile := flags.String("event-log", eventlog.DefaultFile, "Event log of the session, relative to -out (empty - disabled)")
+	manifestFile := flags.String("manifest", storage.DefaultManifestFile, "Manifest of saved files, relative to -out (empty - disabled)")
+	flags.StringVar(&caCert, "ca-cert", caCert, "CA certificate for HTTPS, PEM")
+	flags.StringVar(&caKey, "ca-key", caKey, "CA private key for HTTPS, PEM")
+	mitm := flags.Bool("https", true, "Record HTTPS with the CA (false - tunnel HTTPS without recording)")
+	requisites := flags.Bool("requisites", false, "Also fetch images, styles and scripts of recorded pages")
+	var fetchCfg mirror.Config
+	flags.Float64Var(&fetchCfg.RateLimit, "rate", 0, "Max requests per second for -requisites (0 - unlimited)")
+	flags.IntVar(&fetchCfg.BreakerThreshold, "breaker-threshold", 5, "Consecutive failures before -requisites stop fetching from a host (0 - disabled)")
+	flags.DurationVar(&fetchCfg.BreakerCooldown, "breaker-cooldown", 30*time.Second, "Pause before -requisites probe a failed host again")
+	var filter mirror.Filter
+	flags.Func("include", "Only record URLs matching regexp (repeatable)", appendRegexp(&filter.Include))
+	flags.Func("exclude", "Don't record URLs matching regexp (repeatable)", appendRegexp(&filter.Exclude))
+	logLevel := flags.String("log-level", "info", "Log level: debug, info, warn or error")
+	if code, done := parseFlags(flags, args, 0); done {
+		return code
+	}
+
+	logger, err := logging.New(stderr, *logLevel, logging.FormatText)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+
+	st := storage.NewStorage(*out)
+	st.Logger = logger
+	if *manifestFile != "" {
+		path := mirror.OutputPath(*out, *manifestFile)
+		if st.Manifest, err = storage.ReadManifest(path); err != nil {
+			_, _ = fmt.Fprintln(stderr, err)
+			return exitError
+		}
+		defer func() {
+			if errWrite := st.Manifest.WriteFile(path); errWrite != nil {
+				logger.Error("writing manifest", "err", errWrite)
+			}
+		}()
+	}
+	p := proxy.New(st)
+	p.Logger = logger
+	p.Filter = filter
+	p.Requisites = *requisites
+	if *requisites {
+		fetcher := mirror.NewFetcher(mirror.Options{Config: fetchCfg, Logger: logger, UserAgent: userAgent})
+		// Как и сам прокси, без прокси из окружения: иначе браузерный HTTP_PROXY зациклит загрузки.
+		fetcher.Client.Transport = p.Transport
+		p.Fetcher = fetcher
+	}
+	if *mitm {
+		if p.CA, err = loadOrCreateCA(caCert, caKey, stdout); err != nil {
+			_, _ = fmt.Fprintln(stderr, err)
+			return exitError
+		}
+	}
+	if *logFile != "" {
+		events, errOpen := eventlog.Open(mirror.OutputPath(*out, *logFile))
+		if errOpen != nil {
+			_, _ = fmt.Fprintln(stderr, errOpen)
+			return exitError
+		}
+		defer func() {
+			if errClose := events.Close(); errClose != nil {
+				logger.Error("closing event log", "err", errClose)
+			}
+		}()
+		p.OnRecord = func(rec eventlog.Record) {
+			if errWrite := events.Write(rec); errWrite != nil {
+				logger.Error("writing event log", "err", errWrite)
+			}
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{Addr: *addr, Handler: p, ReadHeaderTimeout: 30 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	_, _ = fmt.Fprintf(stdout, "recording proxy on http://%s/, saving to %s\n", *addr, *out)
+	if err = srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	p.Wait()
+	return exitOK
+}
+
+func appendRegexp(list *[]*regexp.Regexp) func(string) error {
+	return func(s string) error {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return err
+		}
+		*list = append(*list, re)
+		return nil
+	}
+}
+
+// defaultCAFiles - CA хранится в каталоге настроек пользователя, а не в зеркале,
+// чтобы ключ не попал в публикуемые файлы.
+func defaultCAFiles() (string, string) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	dir = filepath.Join(dir, "site-mirror")
+	return filepath.Join(dir, "proxy-ca.pem"), filepath.Join(dir, "proxy-ca-key.pem")
+}
+
+func loadOrCreateCA(certFile, keyFile string, stdout io.Writer) (*proxy.CA, error) {
+	ca, err := proxy.LoadCA(certFile, keyFile)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return ca, err
+	}
+	if ca, err = proxy.NewCA(); err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(filepath.Dir(certFile), 0o700); err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(filepath.Dir(keyFile), 0o700); err != nil {
+		return nil, err
+	}
+	if err = ca.Save(certFile, keyFile); err != nil {
+		return nil, err
+	}
+	_, _ = fmt.Fprintf(stdout, "created CA %s, add it to the browser's trusted certificates to record HTTPS\n", certFile)
+	return ca, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"site-mirror/internal/replay"
+	"site-mirror/internal/warc"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const replayUsage = "Usage: site-mirror replay [-addr ADDR] [-cdx FILE]... WARC...\n\n" +
+	"Serve captures from WARC files: /web/TIMESTAMP/URL replays the capture nearest to\n" +
+	"TIMESTAMP, /web/*/URL shows a calendar of captures. Without -cdx the archives are\n" +
+	"indexed on start.\n\nFlags:\n"
+
+// fileList - значения повторяемого флага с путями.
+type fileList []string
+
+func (l *fileList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *fileList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+func runReplay(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("replay", replayUsage, stderr)
+	addr := fs.String("addr", "127.0.0.1:8090", "Listen address")
+	var cdxFiles fileList
+	fs.Var(&cdxFiles, "cdx", "CDX index of the archives (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	captures, err := loadCaptures(fs.Args(), cdxFiles)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	handler, err := replay.NewHandler(captures, fs.Args())
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{Addr: *addr, Handler: handler, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	_, _ = fmt.Fprintf(stdout, "replaying %d captures on http://%s/\n", len(captures), *addr)
+	if err = srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	return exitOK
+}
+
+func loadCaptures(archives, cdxFiles []string) ([]warc.Capture, error) {
+	var captures []warc.Capture
+	if len(cdxFiles) == 0 {
+		for _, path := range archives {
+			list, err := warc.Index(path)
+			if err != nil {
+				return nil, err
+			}
+			captures = append(captures, list...)
+		}
+		return captures, nil
+	}
+
+	for _, path := range cdxFiles {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		list, err := warc.ReadCDX(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		captures = append(captures, list...)
+	}
+	return captures, nil
+}
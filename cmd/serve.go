@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"site-mirror/internal/eventlog"
+	"site-mirror/internal/serve"
+	"site-mirror/internal/storage"
+	"site-mirror/mirror"
+	"slices"
+	"syscall"
+	"time"
+)
+
+const serveUsage = "Usage: site-mirror serve [-out DIR] [-addr ADDR] [-host HOST] [-event-log FILE] [-manifest FILE]\n\n" +
+	"Serve the mirrored copy of HOST from -out until interrupted. URLs map to files as\n" +
+	"during the crawl, content types come from the event log, missing pages link to\n" +
+	"the live site.\n\nFlags:\n"
+
+func runServe(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("serve", serveUsage, stderr)
+	out := fs.String("out", "./", "Mirror directory")
+	addr := fs.String("addr", "127.0.0.1:8080", "Listen address")
+	host := fs.String("host", "", "Mirrored host to serve (default - the only host in -out)")
+	logFile := fs.String("event-log", eventlog.DefaultFile, "Event log of the run with content types, relative to -out")
+	manifestFile := fs.String("manifest", storage.DefaultManifestFile, "Manifest of the mirror, needed for -dedup pointer, relative to -out")
+	if code, done := parseFlags(fs, args, 0); done {
+		return code
+	}
+
+	st := storage.NewStorage(*out)
+	var err error
+	if st.Manifest, err = storage.ReadManifest(mirror.OutputPath(*out, *manifestFile)); err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	hosts, err := serve.Hosts(*out, st.Manifest)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	if *host == "" {
+		if len(hosts) != 1 {
+			_, _ = fmt.Fprintf(stderr, "%d hosts in %s, choose one with -host: %v\n", len(hosts), *out, hosts)
+			return exitUsage
+		}
+		*host = hosts[0]
+	}
+	if !slices.Contains(hosts, *host) {
+		_, _ = fmt.Fprintf(stderr, "no mirror of %s in %s\n", *host, *out)
+		return exitUsage
+	}
+
+	// Без журнала зеркало всё равно отдаётся, тип определяется по файлу.
+	records, err := eventlog.Read(mirror.OutputPath(*out, *logFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	handler := serve.NewHandler(st, serve.Origin(*host, records), records)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{Addr: *addr, Handler: handler, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	_, _ = fmt.Fprintf(stdout, "serving %s on http://%s/\n", *host, *addr)
+	if err = srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	return exitOK
+}
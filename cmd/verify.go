@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"site-mirror/internal/integrity"
+	"site-mirror/internal/storage"
+	"site-mirror/mirror"
+)
+
+const verifyUsage = "Usage: site-mirror verify [-out DIR] [-manifest FILE] [-links=false] [-json]\n\n" +
+	"Check the mirror against its manifest: missing, modified and extra files, and links\n" +
+	"of saved pages to same-host URLs that are not in the mirror.\n" +
+	"Exits with 0 if the mirror is intact, 3 if problems were found.\n\nFlags:\n"
+
+func runVerify(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("verify", verifyUsage, stderr)
+	out := fs.String("out", "./", "Mirror directory")
+	manifestFile := fs.String("manifest", storage.DefaultManifestFile, "Manifest of the mirror, relative to -out")
+	links := fs.Bool("links", true, "Check links of saved HTML pages")
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+	if code, done := parseFlags(fs, args, 0); done {
+		return code
+	}
+
+	path := mirror.OutputPath(*out, *manifestFile)
+	if _, err := os.Stat(path); err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	manifest, err := storage.ReadManifest(path)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s: %v\n", path, err)
+		return exitError
+	}
+	report, err := integrity.Check(*out, manifest, *links)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(report); err != nil {
+			_, _ = fmt.Fprintln(stderr, err)
+			return exitError
+		}
+	} else {
+		for _, p := range report.Problems {
+			_, _ = fmt.Fprintln(stdout, p)
+		}
+		_, _ = fmt.Fprintf(stdout, "%d files and %d links checked, %d problems\n",
+			report.Files, report.Links, len(report.Problems))
+	}
+	if len(report.Problems) > 0 {
+		return exitCheckFailed
+	}
+	return exitOK
+}
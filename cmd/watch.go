@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"regexp"
+	"site-mirror/internal/config"
+	"site-mirror/internal/hooks"
+	"site-mirror/internal/logging"
+	"site-mirror/internal/parser"
+	"site-mirror/internal/watch"
+	"site-mirror/mirror"
+	"syscall"
+	"time"
+)
+
+const watchUsage = "Usage: site-mirror watch -url URL [-interval 1h] [-once] [-ignore SELECTORS] [-select REGEXP] [flags]\n\n" +
+	"Re-crawl the mirror every -interval like update, with conditional requests, and\n" +
+	"compare per-page hashes of the visible text with the previous check. Elements matching\n" +
+	"-ignore don't count. When selected pages were added, changed or removed, print the\n" +
+	"change report and run -notify-exec or POST it to -notify-url. The first check only\n" +
+	"records the baseline. With -once check once and exit, e.g. from cron.\n" +
+	"Crawl flags are the same as for mirror.\n\nFlags:\n"
+
+type watchOptions struct {
+	interval   time.Duration
+	once       bool
+	ignore     []parser.Selector
+	selects    []*regexp.Regexp
+	stateFile  string
+	reportFile string
+	notify     []hooks.Sink
+}
+
+func runWatch(args []string, stdout, stderr io.Writer) int {
+	var opts watchOptions
+	var ignore, notifyExec, notifyURL string
+	cfg, err := parser.LoadCommandFlags("watch", watchUsage, args, os.Getenv, func(fs *flag.FlagSet) {
+		fs.DurationVar(&opts.interval, "interval", time.Hour, "Time between checks")
+		fs.BoolVar(&opts.once, "once", false, "Check once and exit")
+		fs.StringVar(&ignore, "ignore", "", "Ignore changes in HTML elements, e.g. time,.counter,#updated")
+		fs.Var((*parser.RegexpList)(&opts.selects), "select", "Only watch pages matching regexp (repeatable, default - all pages)")
+		fs.StringVar(&opts.stateFile, "state", watch.DefaultStateFile, "Page hashes of the previous check, relative to -out")
+		fs.StringVar(&opts.reportFile, "report", "", "Write the JSON report of the last change to FILE, relative to -out")
+		fs.StringVar(&notifyExec, "notify-exec", "", "Run shell command on changes with the JSON report on stdin")
+		fs.StringVar(&notifyURL, "notify-url", "", "POST the JSON report to this URL on changes")
+	})
+	if code, done := configExit(err, stderr); done {
+		return code
+	}
+	if opts.ignore, err = parser.ParseSelectors(ignore); err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	if notifyURL != "" {
+		if err = parser.CheckHookURL(notifyURL); err != nil {
+			_, _ = fmt.Fprintln(stderr, err)
+			return exitUsage
+		}
+	}
+	if opts.interval <= 0 && !opts.once {
+		_, _ = fmt.Fprintln(stderr, "interval must be positive")
+		return exitUsage
+	}
+	if notifyExec != "" {
+		opts.notify = append(opts.notify, hooks.Exec{Command: notifyExec})
+	}
+	if notifyURL != "" {
+		opts.notify = append(opts.notify, hooks.Webhook{URL: notifyURL})
+	}
+	cfg.Update = true
+
+	logger, err := logging.New(stderr, cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	slog.SetDefault(logger)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	for {
+		if err = watchOnce(ctx, cfg, opts, logger, stdout, stderr); err != nil {
+			_, _ = fmt.Fprintln(stderr, err)
+			return exitError
+		}
+		if opts.once {
+			return exitOK
+		}
+		select {
+		case <-ctx.Done():
+			return exitOK
+		case <-time.After(opts.interval):
+		}
+	}
+}
+
+// watchOnce обходит сайт, сравнивает хеши страниц с прошлой проверкой и
+// уведомляет об изменениях. Ошибки уведомления только пишутся в лог.
+func watchOnce(ctx context.Context, cfg *config.Config, opts watchOptions, logger *slog.Logger, stdout, stderr io.Writer) error {
+	statePath := mirror.OutputPath(cfg.OutputDir, opts.stateFile)
+	state, err := watch.ReadState(statePath)
+	if err != nil {
+		return err
+	}
+
+	crawler, err := mirror.New(mirror.Options{
+		Config:    *cfg,
+		Logger:    logger,
+		Output:    stderr,
+		UserAgent: userAgent,
+	})
+	if err != nil {
+		return err
+	}
+	detector := watch.NewDetector()
+	detector.Ignore = opts.ignore
+	detector.Select = opts.selects
+	detector.Logger = logger
+	crawler.Subscribe(detector.Handle, mirror.Saved, mirror.Failed, mirror.Removed)
+	if sinks := hookSinks(cfg); len(sinks) > 0 {
+		dispatcher := hooks.NewDispatcher(sinks...)
+		dispatcher.Logger = logger
+		crawler.Subscribe(dispatcher.Handle, cfg.HookEvents...)
+		defer dispatcher.Close()
+	}
+	if _, err = crawler.Run(ctx); err != nil {
+		return err
+	}
+	// Прерванный обход видел не все страницы, но изменения в увиденных верны.
+	report := detector.Apply(state, time.Now())
+	if err = state.WriteFile(statePath); err != nil {
+		return err
+	}
+	if err = report.WriteText(stdout); err != nil {
+		return err
+	}
+	if !report.HasChanges() {
+		return nil
+	}
+
+	var payload bytes.Buffer
+	if err = report.WriteJSON(&payload); err != nil {
+		return err
+	}
+	if opts.reportFile != "" {
+		if err = os.WriteFile(mirror.OutputPath(cfg.OutputDir, opts.reportFile), payload.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	notifyCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, sink := range opts.notify {
+		if errNotify := sink.Deliver(notifyCtx, watch.ChangedEvent, payload.Bytes()); errNotify != nil {
+			logger.Error("change notification failed", "err", errNotify)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package adaptive
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"site-mirror/internal/metrics"
+	"sync"
+	"time"
+)
+
+var ErrInvalidBounds = errors.New("invalid concurrency bounds")
+
+const (
+	ewmaWeight     = 0.2
+	baselineWeight = 0.01
+	// Рост задержки меньше этого порога считается шумом даже при большом отношении к базовой.
+	minLatencyRise = 50 * time.Millisecond
+)
+
+// Config задаёт границы и шаги AIMD: за каждое "окно" из limit удачных запросов
+// лимит растёт на Increase, при перегрузке умножается на Decrease.
+type Config struct {
+	Min           int
+	Max           int
+	Initial       int
+	Increase      float64
+	Decrease      float64
+	LatencyFactor float64
+}
+
+func (c Config) Validate() error {
+	if c.Min < 1 || c.Max < c.Min {
+		return fmt.Errorf("%w: min %d, max %d", ErrInvalidBounds, c.Min, c.Max)
+	}
+	return nil
+}
+
+func (c Config) withDefaults() Config {
+	if c.Initial < c.Min {
+		c.Initial = c.Min
+	}
+	if c.Initial > c.Max {
+		c.Initial = c.Max
+	}
+	if c.Increase <= 0 {
+		c.Increase = 1
+	}
+	if c.Decrease <= 0 || c.Decrease >= 1 {
+		c.Decrease = 0.5
+	}
+	if c.LatencyFactor <= 1 {
+		c.LatencyFactor = 2
+	}
+	return c
+}
+
+// Outcome - результат одной попытки запроса.
+type Outcome struct {
+	Latency    time.Duration
+	StatusCode int
+	Err        error
+}
+
+type hostState struct {
+	limit         float64
+	inFlight      int
+	latency       time.Duration
+	baseline      time.Duration
+	sinceDecrease int
+	cond          *sync.Cond
+}
+
+// Controller ограничивает число одновременных запросов к каждому хосту и
+// подстраивает лимит по задержкам и ответам сервера.
+type Controller struct {
+	Logger  *slog.Logger
+	Metrics metrics.Metrics
+
+	cfg   Config
+	mu    sync.Mutex
+	hosts map[string]*hostState
+}
+
+func New(cfg Config) *Controller {
+	return &Controller{
+		Logger:  slog.Default(),
+		Metrics: metrics.Nop{},
+		cfg:     cfg.withDefaults(),
+		hosts:   make(map[string]*hostState),
+	}
+}
+
+func (c *Controller) host(name string) *hostState {
+	st, ok := c.hosts[name]
+	if !ok {
+		st = &hostState{
+			limit:         float64(c.cfg.Initial),
+			sinceDecrease: c.cfg.Initial,
+			cond:          sync.NewCond(&c.mu),
+		}
+		c.hosts[name] = st
+		c.Metrics.Set(metrics.HostConcurrency, st.limit, "host", name)
+	}
+	return st
+}
+
+// Acquire ждёт свободного места в лимите хоста. Возвращённую функцию нужно
+// вызвать с результатом попытки. Для nil-контроллера ограничения нет.
+func (c *Controller) Acquire(host string) func(Outcome) {
+	if c == nil {
+		return func(Outcome) {}
+	}
+	c.mu.Lock()
+	st := c.host(host)
+	for st.inFlight >= int(st.limit) {
+		st.cond.Wait()
+	}
+	st.inFlight++
+	c.mu.Unlock()
+
+	var once sync.Once
+	return func(o Outcome) {
+		once.Do(func() { c.release(host, st, o) })
+	}
+}
+
+// Limit возвращает текущий лимит хоста.
+func (c *Controller) Limit(host string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return int(c.host(host).limit)
+}
+
+func (c *Controller) release(host string, st *hostState, o Outcome) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st.inFlight--
+	st.sinceDecrease++
+	defer st.cond.Broadcast()
+
+	if o.Err == nil && o.Latency > 0 {
+		st.observeLatency(o.Latency)
+	}
+
+	if reason := c.congestion(st, o); reason != "" {
+		// Одна перегрузка обычно роняет сразу несколько запросов в полёте,
+		// поэтому лимит снижается не чаще раза за окно.
+		if st.sinceDecrease < int(st.limit) {
+			return
+		}
+		st.sinceDecrease = 0
+		c.set(host, st, max(float64(c.cfg.Min), float64(int(st.limit*c.cfg.Decrease))), "decrease", reason)
+		return
+	}
+
+	if o.Err == nil && o.StatusCode < http.StatusInternalServerError {
+		c.set(host, st, min(float64(c.cfg.Max), st.limit+c.cfg.Increase/st.limit), "increase", "healthy")
+	}
+}
+
+func (st *hostState) observeLatency(d time.Duration) {
+	if st.latency == 0 {
+		st.latency = d
+	} else {
+		st.latency += time.Duration(ewmaWeight * float64(d-st.latency))
+	}
+	// Базовая задержка - минимум сглаженной, медленно подтягивается вверх,
+	// чтобы постоянное замедление сервера не держало лимит на минимуме.
+	if st.baseline == 0 || st.latency < st.baseline {
+		st.baseline = st.latency
+	} else {
+		st.baseline += time.Duration(baselineWeight * float64(st.latency-st.baseline))
+	}
+}
+
+func (c *Controller) congestion(st *hostState, o Outcome) string {
+	var netErr net.Error
+	switch {
+	case errors.As(o.Err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case o.StatusCode == http.StatusTooManyRequests:
+		return "429"
+	case o.StatusCode == http.StatusServiceUnavailable:
+		return "503"
+	case o.Err == nil && st.baseline > 0 && st.latency-st.baseline > minLatencyRise &&
+		float64(st.latency) > float64(st.baseline)*c.cfg.LatencyFactor:
+		return "latency"
+	}
+	return ""
+}
+
+func (c *Controller) set(host string, st *hostState, limit float64, direction, reason string) {
+	old := int(st.limit)
+	st.limit = limit
+	if int(limit) == old {
+		return
+	}
+	c.Metrics.Set(metrics.HostConcurrency, float64(int(limit)), "host", host)
+	metrics.Inc(c.Metrics, metrics.ConcurrencyChanges, "host", host, "direction", direction)
+	c.Logger.Info("host concurrency "+direction+"d", "host", host, "from", old, "to", int(limit),
+		"reason", reason, "latency", st.latency, "baseline", st.baseline)
+}
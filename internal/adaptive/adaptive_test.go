@@ -0,0 +1,147 @@
+package adaptive
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"site-mirror/internal/metrics"
+	"testing"
+	"time"
+)
+
+func ok(latency time.Duration) Outcome {
+	return Outcome{Latency: latency, StatusCode: http.StatusOK}
+}
+
+func run(c *Controller, host string, outcomes ...Outcome) {
+	for _, o := range outcomes {
+		c.Acquire(host)(o)
+	}
+}
+
+func TestController_AdditiveIncrease(t *testing.T) {
+	c := New(Config{Min: 1, Max: 4, Initial: 2})
+
+	// Каждый удачный запрос добавляет 1/limit: 2 -> 2.5 -> 2.9 -> 3.24.
+	run(c, "a.com", ok(10*time.Millisecond), ok(10*time.Millisecond))
+	if got := c.Limit("a.com"); got != 2 {
+		t.Fatalf("expected limit 2 within first window, got %d", got)
+	}
+	run(c, "a.com", ok(10*time.Millisecond))
+	if got := c.Limit("a.com"); got != 3 {
+		t.Fatalf("expected limit 3 after a window of successes, got %d", got)
+	}
+	for range 20 {
+		run(c, "a.com", ok(10*time.Millisecond))
+	}
+	if got := c.Limit("a.com"); got != 4 {
+		t.Errorf("expected limit capped at max 4, got %d", got)
+	}
+	if got := c.Limit("b.com"); got != 2 {
+		t.Errorf("expected other host to keep initial limit, got %d", got)
+	}
+}
+
+func TestController_MultiplicativeDecrease(t *testing.T) {
+	tests := []struct {
+		name    string
+		outcome Outcome
+	}{
+		{"429", Outcome{StatusCode: http.StatusTooManyRequests}},
+		{"503", Outcome{StatusCode: http.StatusServiceUnavailable}},
+		{"timeout", Outcome{Err: os.ErrDeadlineExceeded}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := metrics.NewRegistry()
+			c := New(Config{Min: 2, Max: 20, Initial: 8})
+			c.Metrics = reg
+
+			run(c, "a.com", tt.outcome)
+			if got := c.Limit("a.com"); got != 4 {
+				t.Fatalf("expected limit halved to 4, got %d", got)
+			}
+			// Следующая перегрузка в том же окне лимит не трогает.
+			run(c, "a.com", tt.outcome)
+			if got := c.Limit("a.com"); got != 4 {
+				t.Errorf("expected one decrease per window, got %d", got)
+			}
+
+			for range 3 {
+				run(c, "a.com", ok(10*time.Millisecond))
+			}
+			run(c, "a.com", tt.outcome, tt.outcome, tt.outcome, tt.outcome, tt.outcome, tt.outcome)
+			if got := c.Limit("a.com"); got != 2 {
+				t.Errorf("expected limit bounded by min 2, got %d", got)
+			}
+
+			if v := reg.Value(metrics.ConcurrencyChanges, "host", "a.com", "direction", "decrease"); v != 2 {
+				t.Errorf("expected 2 decreases in metrics, got %v", v)
+			}
+			if v := reg.Value(metrics.HostConcurrency, "host", "a.com"); v != 2 {
+				t.Errorf("expected host concurrency gauge 2, got %v", v)
+			}
+		})
+	}
+}
+
+func TestController_LatencyBackoff(t *testing.T) {
+	c := New(Config{Min: 1, Max: 10, Initial: 4})
+
+	run(c, "a.com", ok(10*time.Millisecond))
+	for range 10 {
+		run(c, "a.com", ok(200*time.Millisecond))
+	}
+	if got := c.Limit("a.com"); got >= 4 {
+		t.Errorf("expected rising latency to reduce limit below 4, got %d", got)
+	}
+}
+
+func TestController_ErrorsDoNotIncrease(t *testing.T) {
+	c := New(Config{Min: 1, Max: 10, Initial: 2})
+	for range 10 {
+		run(c, "a.com", Outcome{StatusCode: http.StatusInternalServerError}, Outcome{Err: errors.New("connection refused")})
+	}
+	if got := c.Limit("a.com"); got != 2 {
+		t.Errorf("expected limit to stay 2 on non-congestion errors, got %d", got)
+	}
+}
+
+func TestController_AcquireBlocksAtLimit(t *testing.T) {
+	c := New(Config{Min: 1, Max: 1, Initial: 1})
+	release := c.Acquire("a.com")
+
+	acquired := make(chan struct{})
+	go func() {
+		c.Acquire("a.com")(ok(time.Millisecond))
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("second Acquire should wait for release")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release(ok(time.Millisecond))
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("second Acquire did not proceed after release")
+	}
+}
+
+func TestController_Nil(t *testing.T) {
+	var c *Controller
+	c.Acquire("a.com")(Outcome{})
+}
+
+func TestConfig_Validate(t *testing.T) {
+	for _, cfg := range []Config{{Min: 0, Max: 5}, {Min: 5, Max: 2}} {
+		if err := cfg.Validate(); !errors.Is(err, ErrInvalidBounds) {
+			t.Errorf("expected ErrInvalidBounds for %+v, got %v", cfg, err)
+		}
+	}
+	if err := (Config{Min: 1, Max: 1}).Validate(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
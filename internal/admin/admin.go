@@ -0,0 +1,86 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// StatusFunc возвращает состояние обхода для /status, результат кодируется в JSON.
+type StatusFunc func() any
+
+// Server - служебный HTTP-сервер: /metrics, /healthz и /status.
+type Server struct {
+	Addr   string
+	Logger *slog.Logger
+
+	mux      *http.ServeMux
+	srv      *http.Server
+	listener net.Listener
+}
+
+func NewServer(addr string, metrics http.Handler, status StatusFunc) *Server {
+	s := &Server{Addr: addr, Logger: slog.Default(), mux: http.NewServeMux()}
+	s.mux.Handle("GET /metrics", metrics)
+	s.mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	s.mux.HandleFunc("GET /status", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, status())
+	})
+	return s
+}
+
+// Handle регистрирует дополнительный обработчик на служебном сервере.
+func (s *Server) Handle(pattern string, h http.Handler) {
+	s.mux.Handle(pattern, h)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Start начинает слушать Addr и обслуживает запросы в фоне.
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	s.listener = ln
+	s.srv = &http.Server{Handler: s.mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.Logger.Error("admin server stopped", "err", err)
+		}
+	}()
+	s.Logger.Info("admin server listening", "addr", ln.Addr().String())
+	return nil
+}
+
+// ListenAddr возвращает фактический адрес после Start, например при порте 0.
+func (s *Server) ListenAddr() string {
+	if s.listener == nil {
+		return s.Addr
+	}
+	return s.listener.Addr().String()
+}
+
+func (s *Server) Close() error {
+	if s == nil || s.srv == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.srv.Shutdown(ctx)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
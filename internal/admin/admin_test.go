@@ -0,0 +1,64 @@
+package admin
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"site-mirror/internal/metrics"
+	"strings"
+	"testing"
+)
+
+func TestServer_Endpoints(t *testing.T) {
+	reg := metrics.NewRegistry()
+	reg.Set(metrics.QueueDepth, 7)
+	s := NewServer("127.0.0.1:0", reg, func() any {
+		return map[string]int{"queued": 7}
+	})
+
+	tests := []struct {
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{"/metrics", http.StatusOK, "site_mirror_queue_depth 7"},
+		{"/healthz", http.StatusOK, "ok"},
+		{"/status", http.StatusOK, `"queued":7`},
+		{"/unknown", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.wantCode {
+				t.Fatalf("expected status %d, got %d", tt.wantCode, rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body %q does not contain %q", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestServer_StartClose(t *testing.T) {
+	s := NewServer("127.0.0.1:0", metrics.NewRegistry(), func() any { return struct{}{} })
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start returned error: %v", err)
+	}
+	defer s.Close()
+
+	resp, err := http.Get("http://" + s.ListenAddr() + "/status")
+	if err != nil {
+		t.Fatalf("GET /status: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	var v map[string]any
+	if err := json.Unmarshal(body, &v); err != nil {
+		t.Errorf("status is not JSON: %q", body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+}
@@ -1,6 +1,19 @@
 package config
 
-import "net/url"
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"site-mirror/internal/events"
+	"site-mirror/internal/queue"
+	"site-mirror/internal/ratelimit"
+	"site-mirror/internal/storage"
+	"site-mirror/internal/transform"
+	"time"
+)
+
+var ErrInvalidConfig = errors.New("invalid configuration")
 
 type Config struct {
 	StartURL    *url.URL
@@ -8,4 +21,105 @@ type Config struct {
 	Depth       int
 	Concurrency int
 	UseRobots   bool
+
+	RateLimit      float64
+	BandwidthLimit int64
+	RateSchedule   []ratelimit.Window
+
+	MaxPages        int
+	MaxBytes        int64
+	MaxBytesPerMIME map[string]int64
+	MaxDuration     time.Duration
+
+	CrawlOrder       string
+	PriorityPatterns []queue.PatternWeight
+	ResourcesFirst   bool
+	UseSitemap       bool
+
+	PageConcurrency     int
+	ResourceConcurrency int
+	Adaptive            bool
+	MinConcurrency      int
+	MaxConcurrency      int
+	PageFilter          queue.Filter
+	ResourceFilter      queue.Filter
+
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	BreakerProbes    int
+
+	LogLevel  string
+	LogFormat string
+	EventLog  string
+	Manifest  string
+	LinkGraph string
+	// NearDup - порог сходства видимого текста страниц (0-1), с которого страница
+	// считается почти копией уже скачанной, 0 - без поиска почти одинаковых страниц.
+	NearDup          float64
+	NearDupSkipLinks bool
+	NearDupReport    string
+	// Dedup - режим блоб-хранилища для одинаковых файлов, пустой - без дедупликации.
+	Dedup storage.DedupMode
+	// Snapshot - сохранить обход как новый снимок в SnapshotDir каталога вывода,
+	// неизменившиеся файлы делят блобы с прошлыми снимками.
+	Snapshot bool
+
+	Progress    bool
+	SummaryJSON string
+
+	// Внешние обработчики событий обхода, пустой HookEvents - все события.
+	HookExec   string
+	HookURL    string
+	HookEvents []events.Type
+
+	// Преобразования файлов перед сохранением и дополнительные шаблоны
+	// счётчиков для strip-trackers.
+	Transforms      []transform.Spec
+	TrackerPatterns []*regexp.Regexp
+
+	AdminAddr        string
+	ControlAddr      string
+	ControlTokenFile string
+	CheckpointFile   string
+	Resume           bool
+	// Update - повторный обход поверх существующего зеркала: неизменившиеся
+	// файлы не скачиваются заново.
+	Update bool
+}
+
+// Validate проверяет итоговую конфигурацию после объединения файла, окружения и флагов.
+// Файловую систему Validate не трогает: каталог вывода проверяет mirror.New.
+func (c *Config) Validate() error {
+	if c.StartURL == nil || c.StartURL.Host == "" || (c.StartURL.Scheme != "http" && c.StartURL.Scheme != "https") {
+		return fmt.Errorf("%w: url must be an absolute http(s) URL, got %q", ErrInvalidConfig, urlString(c.StartURL))
+	}
+	if c.Depth < 0 {
+		return fmt.Errorf("%w: depth must not be negative, got %d", ErrInvalidConfig, c.Depth)
+	}
+	if c.Concurrency < 1 {
+		return fmt.Errorf("%w: concurrency must be at least 1, got %d", ErrInvalidConfig, c.Concurrency)
+	}
+	if c.PageConcurrency < 0 || c.ResourceConcurrency < 0 {
+		return fmt.Errorf("%w: per-kind concurrency must not be negative", ErrInvalidConfig)
+	}
+	if c.RateLimit < 0 || c.MaxPages < 0 || c.MaxDuration < 0 {
+		return fmt.Errorf("%w: limits and budgets must not be negative", ErrInvalidConfig)
+	}
+	if c.NearDup < 0 || c.NearDup > 1 {
+		return fmt.Errorf("%w: near-dup threshold must be between 0 and 1, got %g", ErrInvalidConfig, c.NearDup)
+	}
+	if c.Dedup == storage.DedupPointer && c.Manifest == "" {
+		return fmt.Errorf("%w: dedup %s needs a manifest", ErrInvalidConfig, c.Dedup)
+	}
+	if c.Snapshot && (c.Resume || c.Update) {
+		return fmt.Errorf("%w: snapshot starts a new copy and can't be combined with resume or update", ErrInvalidConfig)
+	}
+	return nil
+}
+
+func urlString(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	return u.String()
 }
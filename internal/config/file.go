@@ -0,0 +1,163 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrUnknownFileFormat = errors.New("unknown config file format")
+	ErrUnknownProfile    = errors.New("unknown profile")
+	ErrUnknownKey        = errors.New("unknown config key")
+	ErrInvalidValue      = errors.New("invalid config value")
+)
+
+// EnvPrefix - префикс переменных окружения: -max-pages задаётся SITE_MIRROR_MAX_PAGES.
+const EnvPrefix = "SITE_MIRROR_"
+
+const profilesKey = "profiles"
+
+// File - файл конфигурации. Ключи совпадают с именами флагов командной строки,
+// профили из секции "profiles" переопределяют общие настройки.
+type File struct {
+	Path     string
+	Settings map[string]any
+	Profiles map[string]map[string]any
+}
+
+// ReadFile читает YAML, TOML или JSON в зависимости от расширения файла.
+func ReadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make(map[string]any)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		// Пустой файл - допустимая конфигурация без настроек.
+		if err = yaml.NewDecoder(bytes.NewReader(data)).Decode(&raw); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	case ".toml":
+		if _, err = toml.Decode(string(data), &raw); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	case ".json":
+		if err = json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFileFormat, path)
+	}
+
+	f := &File{Path: path, Settings: raw, Profiles: make(map[string]map[string]any)}
+	profiles, ok := raw[profilesKey]
+	if !ok {
+		return f, nil
+	}
+	delete(raw, profilesKey)
+	byName, ok := profiles.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s: %q must be a table of profiles", ErrInvalidValue, path, profilesKey)
+	}
+	for name, p := range byName {
+		settings, ok := p.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s: profile %q must be a table", ErrInvalidValue, path, name)
+		}
+		f.Profiles[name] = settings
+	}
+	return f, nil
+}
+
+// Resolve возвращает общие настройки, переопределённые профилем. Пустой profile - без профиля.
+func (f *File) Resolve(profile string) (map[string]any, error) {
+	settings := make(map[string]any, len(f.Settings))
+	for k, v := range f.Settings {
+		settings[k] = v
+	}
+	if profile == "" {
+		return settings, nil
+	}
+	p, ok := f.Profiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("%w %q in %s", ErrUnknownProfile, profile, f.Path)
+	}
+	for k, v := range p {
+		settings[k] = v
+	}
+	return settings, nil
+}
+
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
+
+// FlagValues переводит значение из файла в строки для флага: список даёт
+// по строке на элемент, таблица - пары "ключ=значение" через запятую.
+func FlagValues(v any) ([]string, error) {
+	switch val := v.(type) {
+	case []any:
+		values := make([]string, 0, len(val))
+		for _, item := range val {
+			s, err := scalar(item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	case map[string]any:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		pairs := make([]string, 0, len(keys))
+		for _, k := range keys {
+			s, err := scalar(val[k])
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, k+"="+s)
+		}
+		return []string{strings.Join(pairs, ",")}, nil
+	default:
+		s, err := scalar(v)
+		if err != nil {
+			return nil, err
+		}
+		return []string{s}, nil
+	}
+}
+
+func scalar(v any) (string, error) {
+	switch val := v.(type) {
+	case string:
+		return val, nil
+	case bool:
+		return strconv.FormatBool(val), nil
+	case int:
+		return strconv.Itoa(val), nil
+	case int64:
+		return strconv.FormatInt(val, 10), nil
+	case uint64:
+		return strconv.FormatUint(val, 10), nil
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), nil
+	default:
+		return "", fmt.Errorf("%w: unsupported %T", ErrInvalidValue, v)
+	}
+}
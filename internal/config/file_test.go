@@ -0,0 +1,125 @@
+package config
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"site.yaml", "url: https://example.com\ndepth: 2\npage-exclude: [/private/, /tmp/]\nprofiles:\n  fast:\n    depth: 1\n    concurrency: 20\n"},
+		{"site.toml", "url = \"https://example.com\"\ndepth = 2\npage-exclude = [\"/private/\", \"/tmp/\"]\n[profiles.fast]\ndepth = 1\nconcurrency = 20\n"},
+		{"site.json", `{"url": "https://example.com", "depth": 2, "page-exclude": ["/private/", "/tmp/"], "profiles": {"fast": {"depth": 1, "concurrency": 20}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ReadFile(writeFile(t, tt.name, tt.content))
+			if err != nil {
+				t.Fatalf("ReadFile returned error: %v", err)
+			}
+			if _, ok := f.Settings["profiles"]; ok {
+				t.Error("profiles should not be left among settings")
+			}
+
+			settings, err := f.Resolve("fast")
+			if err != nil {
+				t.Fatalf("Resolve returned error: %v", err)
+			}
+			for key, want := range map[string]string{"url": "https://example.com", "depth": "1", "concurrency": "20"} {
+				got, err := FlagValues(settings[key])
+				if err != nil || len(got) != 1 || got[0] != want {
+					t.Errorf("%s: expected %q, got %v (%v)", key, want, got, err)
+				}
+			}
+			if got, _ := FlagValues(settings["page-exclude"]); len(got) != 2 || got[1] != "/tmp/" {
+				t.Errorf("expected list values, got %v", got)
+			}
+
+			if _, err = f.Resolve("slow"); !errors.Is(err, ErrUnknownProfile) {
+				t.Errorf("expected ErrUnknownProfile, got %v", err)
+			}
+		})
+	}
+}
+
+func TestReadFile_Errors(t *testing.T) {
+	if _, err := ReadFile(writeFile(t, "site.ini", "depth=1")); !errors.Is(err, ErrUnknownFileFormat) {
+		t.Errorf("expected ErrUnknownFileFormat, got %v", err)
+	}
+	if _, err := ReadFile(writeFile(t, "site.yaml", "profiles: [fast]\n")); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected ErrInvalidValue for malformed profiles, got %v", err)
+	}
+	if f, err := ReadFile(writeFile(t, "empty.yaml", "")); err != nil || len(f.Settings) != 0 {
+		t.Errorf("expected empty YAML to be valid, got %v", err)
+	}
+}
+
+func TestFlagValues_Table(t *testing.T) {
+	got, err := FlagValues(map[string]any{"text/html": "10MB", "image/*": "100MB"})
+	if err != nil || len(got) != 1 || got[0] != "image/*=100MB,text/html=10MB" {
+		t.Errorf("unexpected table values %v (%v)", got, err)
+	}
+	if _, err = FlagValues([]any{map[string]any{}}); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected ErrInvalidValue for nested table, got %v", err)
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	if got := EnvName("max-pages"); got != "SITE_MIRROR_MAX_PAGES" {
+		t.Errorf("unexpected env name %q", got)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	valid := func() *Config {
+		u, _ := url.Parse("https://example.com")
+		return &Config{StartURL: u, OutputDir: t.TempDir(), Depth: 1, Concurrency: 1}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr bool
+	}{
+		{"valid", func(*Config) {}, false},
+		{"missing output dir is created later", func(c *Config) { c.OutputDir = filepath.Join(c.OutputDir, "a", "b") }, false},
+		{"output is a file is checked later", func(c *Config) { c.OutputDir = writeFile(t, "out", "") }, false},
+		{"relative URL", func(c *Config) { c.StartURL, _ = url.Parse("/docs") }, true},
+		{"ftp URL", func(c *Config) { c.StartURL, _ = url.Parse("ftp://example.com") }, true},
+		{"negative depth", func(c *Config) { c.Depth = -1 }, true},
+		{"zero concurrency", func(c *Config) { c.Concurrency = 0 }, true},
+		{"negative page concurrency", func(c *Config) { c.PageConcurrency = -2 }, true},
+		{"negative max pages", func(c *Config) { c.MaxPages = -1 }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid()
+			tt.modify(c)
+			err := c.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("expected ErrInvalidConfig, got %v", err)
+			}
+			if _, errStat := os.Stat(filepath.Join(c.OutputDir, "a")); errStat == nil {
+				t.Error("Validate created the output dir")
+			}
+		})
+	}
+}
@@ -0,0 +1,419 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"site-mirror/internal/fsutil"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultAddr = "127.0.0.1:9091"
+	// DefaultTokenFile - файл с токеном запуска, относительно -out.
+	DefaultTokenFile = "control-token"
+	unixPrefix       = "unix:"
+)
+
+var (
+	ErrNotLocal = errors.New("control address must be loopback or unix socket")
+
+	errForbidden    = errors.New("cross-origin and non-loopback requests are not allowed")
+	errUnauthorized = errors.New("missing or invalid control token")
+	errContentType  = errors.New("content type must be application/json")
+)
+
+// Controller - операции над идущим обходом, доступные через API управления.
+type Controller interface {
+	Pause()
+	Resume()
+	SetWorkers(n int) error
+	AddSeed(rawURL string) error
+	// AddExclude добавляет исключение для задач вида kind ("page", "resource"), пустой kind - для всех.
+	AddExclude(kind, pattern string) error
+	// Stop останавливает обход с сохранением контрольной точки.
+	Stop()
+	State() any
+}
+
+type WorkersRequest struct {
+	Workers int `json:"workers"`
+}
+
+type SeedsRequest struct {
+	URLs []string `json:"urls"`
+}
+
+type SeedsResponse struct {
+	Added    []string          `json:"added"`
+	Rejected map[string]string `json:"rejected,omitempty"`
+}
+
+type ExcludeRequest struct {
+	Kind    string `json:"kind,omitempty"`
+	Pattern string `json:"pattern"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// ValidateAddr допускает только loopback-адреса и unix-сокеты вида "unix:/path".
+func ValidateAddr(addr string) error {
+	if path, ok := strings.CutPrefix(addr, unixPrefix); ok {
+		if path == "" {
+			return fmt.Errorf("%w: empty socket path", ErrNotLocal)
+		}
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if !isLoopback(host) {
+		return fmt.Errorf("%w: %s", ErrNotLocal, addr)
+	}
+	return nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func listen(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, unixPrefix); ok {
+		// Сокет мог остаться от прошлого запуска.
+		_ = os.Remove(path)
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", addr)
+}
+
+type Server struct {
+	Addr   string
+	Logger *slog.Logger
+	// Token требуется в заголовке "Authorization: Bearer" каждого запроса.
+	// Start создаёт случайный токен, если он не задан, и записывает его в
+	// TokenFile с правами 0600.
+	Token     string
+	TokenFile string
+
+	ctrl     Controller
+	mux      *http.ServeMux
+	srv      *http.Server
+	listener net.Listener
+}
+
+func NewServer(addr string, ctrl Controller) *Server {
+	s := &Server{Addr: addr, Logger: slog.Default(), ctrl: ctrl, mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /state", s.handleState)
+	s.mux.HandleFunc("POST /pause", s.handlePause)
+	s.mux.HandleFunc("POST /resume", s.handleResume)
+	s.mux.HandleFunc("POST /workers", s.handleWorkers)
+	s.mux.HandleFunc("POST /seeds", s.handleSeeds)
+	s.mux.HandleFunc("POST /excludes", s.handleExcludes)
+	s.mux.HandleFunc("POST /stop", s.handleStop)
+	return s
+}
+
+// ServeHTTP отклоняет запросы из браузера: с заголовком Origin, с чужим Host
+// (DNS rebinding) и POST не в JSON, который нельзя отправить простой формой.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Origin") != "" || !s.localHost(r.Host) {
+		writeError(w, http.StatusForbidden, errForbidden)
+		return
+	}
+	if s.Token != "" && !validToken(r.Header.Get("Authorization"), s.Token) {
+		writeError(w, http.StatusUnauthorized, errUnauthorized)
+		return
+	}
+	if r.Method == http.MethodPost {
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+			writeError(w, http.StatusUnsupportedMediaType, errContentType)
+			return
+		}
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// localHost проверяет заголовок Host; клиент unix-сокета передаёт любое имя.
+func (s *Server) localHost(host string) bool {
+	if strings.HasPrefix(s.Addr, unixPrefix) {
+		return true
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return isLoopback(host)
+}
+
+func validToken(header, token string) bool {
+	got, ok := strings.CutPrefix(header, "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (s *Server) Start() error {
+	if err := ValidateAddr(s.Addr); err != nil {
+		return err
+	}
+	if s.Token == "" {
+		token, err := newToken()
+		if err != nil {
+			return err
+		}
+		s.Token = token
+	}
+	if s.TokenFile != "" {
+		if err := fsutil.WriteFileAtomic(s.TokenFile, []byte(s.Token+"\n"), 0600); err != nil {
+			return fmt.Errorf("writing control token: %w", err)
+		}
+	}
+	ln, err := listen(s.Addr)
+	if err != nil {
+		return err
+	}
+	s.listener = ln
+	s.srv = &http.Server{Handler: s, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.Logger.Error("control server stopped", "err", err)
+		}
+	}()
+	s.Logger.Info("control server listening", "addr", s.ListenAddr(), "token_file", s.TokenFile)
+	return nil
+}
+
+// ListenAddr возвращает фактический адрес после Start в том же виде, что принимает NewClient.
+func (s *Server) ListenAddr() string {
+	if s.listener == nil || strings.HasPrefix(s.Addr, unixPrefix) {
+		return s.Addr
+	}
+	return s.listener.Addr().String()
+}
+
+func (s *Server) Close() error {
+	if s == nil || s.srv == nil {
+		return nil
+	}
+	if s.TokenFile != "" {
+		_ = os.Remove(s.TokenFile)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.srv.Shutdown(ctx)
+}
+
+func (s *Server) handleState(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.ctrl.State())
+}
+
+func (s *Server) handlePause(w http.ResponseWriter, _ *http.Request) {
+	s.ctrl.Pause()
+	s.Logger.Info("crawl paused via control API")
+	writeJSON(w, http.StatusOK, s.ctrl.State())
+}
+
+func (s *Server) handleResume(w http.ResponseWriter, _ *http.Request) {
+	s.ctrl.Resume()
+	s.Logger.Info("crawl resumed via control API")
+	writeJSON(w, http.StatusOK, s.ctrl.State())
+}
+
+func (s *Server) handleWorkers(w http.ResponseWriter, r *http.Request) {
+	var req WorkersRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if err := s.ctrl.SetWorkers(req.Workers); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.Logger.Info("workers resized via control API", "workers", req.Workers)
+	writeJSON(w, http.StatusOK, s.ctrl.State())
+}
+
+func (s *Server) handleSeeds(w http.ResponseWriter, r *http.Request) {
+	var req SeedsRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	resp := SeedsResponse{Added: []string{}}
+	for _, raw := range req.URLs {
+		if err := s.ctrl.AddSeed(raw); err != nil {
+			if resp.Rejected == nil {
+				resp.Rejected = make(map[string]string)
+			}
+			resp.Rejected[raw] = err.Error()
+			continue
+		}
+		resp.Added = append(resp.Added, raw)
+	}
+	s.Logger.Info("seeds added via control API", "added", len(resp.Added), "rejected", len(resp.Rejected))
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleExcludes(w http.ResponseWriter, r *http.Request) {
+	var req ExcludeRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if err := s.ctrl.AddExclude(req.Kind, req.Pattern); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.Logger.Info("exclude added via control API", "kind", req.Kind, "pattern", req.Pattern)
+	writeJSON(w, http.StatusOK, s.ctrl.State())
+}
+
+func (s *Server) handleStop(w http.ResponseWriter, _ *http.Request) {
+	s.ctrl.Stop()
+	s.Logger.Info("graceful stop requested via control API")
+	writeJSON(w, http.StatusAccepted, s.ctrl.State())
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, errorResponse{Error: err.Error()})
+}
+
+// Client обращается к API управления, например из "site-mirror ctl".
+type Client struct {
+	// Token - токен запуска из Server.TokenFile.
+	Token string
+
+	http *http.Client
+	base string
+}
+
+func NewClient(addr string) *Client {
+	c := &Client{http: &http.Client{Timeout: 10 * time.Second}, base: "http://" + addr}
+	if path, ok := strings.CutPrefix(addr, unixPrefix); ok {
+		c.base = "http://unix"
+		c.http.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		}
+	}
+	return c
+}
+
+func (c *Client) State() (json.RawMessage, error) {
+	var out json.RawMessage
+	err := c.do(http.MethodGet, "/state", nil, &out)
+	return out, err
+}
+
+func (c *Client) Pause() (json.RawMessage, error) {
+	var out json.RawMessage
+	err := c.do(http.MethodPost, "/pause", nil, &out)
+	return out, err
+}
+
+func (c *Client) Resume() (json.RawMessage, error) {
+	var out json.RawMessage
+	err := c.do(http.MethodPost, "/resume", nil, &out)
+	return out, err
+}
+
+func (c *Client) SetWorkers(n int) (json.RawMessage, error) {
+	var out json.RawMessage
+	err := c.do(http.MethodPost, "/workers", WorkersRequest{Workers: n}, &out)
+	return out, err
+}
+
+func (c *Client) AddSeeds(urls []string) (SeedsResponse, error) {
+	var out SeedsResponse
+	err := c.do(http.MethodPost, "/seeds", SeedsRequest{URLs: urls}, &out)
+	return out, err
+}
+
+func (c *Client) AddExclude(kind, pattern string) (json.RawMessage, error) {
+	var out json.RawMessage
+	err := c.do(http.MethodPost, "/excludes", ExcludeRequest{Kind: kind, Pattern: pattern}, &out)
+	return out, err
+}
+
+func (c *Client) Stop() (json.RawMessage, error) {
+	var out json.RawMessage
+	err := c.do(http.MethodPost, "/stop", nil, &out)
+	return out, err
+}
+
+func (c *Client) do(method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.base+path, reader)
+	if err != nil {
+		return err
+	}
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		var e errorResponse
+		if json.Unmarshal(data, &e) == nil && e.Error != "" {
+			return errors.New(e.Error)
+		}
+		return fmt.Errorf("control API returned %s", resp.Status)
+	}
+	return json.Unmarshal(data, out)
+}
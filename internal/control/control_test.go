@@ -0,0 +1,200 @@
+package control
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type fakeController struct {
+	mu       sync.Mutex
+	paused   bool
+	stopped  bool
+	workers  int
+	seeds    []string
+	excludes []string
+}
+
+func (f *fakeController) Pause()  { f.mu.Lock(); f.paused = true; f.mu.Unlock() }
+func (f *fakeController) Resume() { f.mu.Lock(); f.paused = false; f.mu.Unlock() }
+func (f *fakeController) Stop()   { f.mu.Lock(); f.stopped = true; f.mu.Unlock() }
+
+func (f *fakeController) SetWorkers(n int) error {
+	if n < 1 {
+		return errors.New("need at least one worker")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.workers = n
+	return nil
+}
+
+func (f *fakeController) AddSeed(rawURL string) error {
+	if !strings.HasPrefix(rawURL, "https://example.com/") {
+		return errors.New("external domain")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seeds = append(f.seeds, rawURL)
+	return nil
+}
+
+func (f *fakeController) AddExclude(kind, pattern string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.excludes = append(f.excludes, kind+":"+pattern)
+	return nil
+}
+
+func (f *fakeController) State() any {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return map[string]any{"paused": f.paused, "workers": f.workers, "stopping": f.stopped}
+}
+
+func TestClientServer(t *testing.T) {
+	ctrl := &fakeController{workers: 5}
+	s := NewServer("127.0.0.1:0", ctrl)
+	s.Token = "secret"
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	c := NewClient(strings.TrimPrefix(ts.URL, "http://"))
+	c.Token = "secret"
+
+	state, err := c.Pause()
+	if err != nil || !strings.Contains(string(state), `"paused":true`) {
+		t.Fatalf("Pause: %s %v", state, err)
+	}
+	if _, err = c.Resume(); err != nil || ctrl.paused {
+		t.Fatalf("Resume: %v", err)
+	}
+
+	if _, err = c.SetWorkers(8); err != nil || ctrl.workers != 8 {
+		t.Errorf("SetWorkers: workers=%d err=%v", ctrl.workers, err)
+	}
+	if _, err = c.SetWorkers(0); err == nil || !strings.Contains(err.Error(), "at least one worker") {
+		t.Errorf("expected controller error to reach the client, got %v", err)
+	}
+
+	seeds, err := c.AddSeeds([]string{"https://example.com/new", "https://other.com/"})
+	if err != nil {
+		t.Fatalf("AddSeeds: %v", err)
+	}
+	if len(seeds.Added) != 1 || seeds.Rejected["https://other.com/"] != "external domain" {
+		t.Errorf("unexpected seeds response %+v", seeds)
+	}
+
+	if _, err = c.AddExclude("page", "/private/"); err != nil || len(ctrl.excludes) != 1 || ctrl.excludes[0] != "page:/private/" {
+		t.Errorf("AddExclude: %v %v", ctrl.excludes, err)
+	}
+
+	if _, err = c.Stop(); err != nil || !ctrl.stopped {
+		t.Errorf("Stop: %v", err)
+	}
+	if state, err = c.State(); err != nil || !strings.Contains(string(state), `"stopping":true`) {
+		t.Errorf("State: %s %v", state, err)
+	}
+}
+
+func TestServer_UnixSocket(t *testing.T) {
+	addr := "unix:" + filepath.Join(t.TempDir(), "ctl.sock")
+	s := NewServer(addr, &fakeController{workers: 2})
+	s.TokenFile = filepath.Join(t.TempDir(), DefaultTokenFile)
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start returned error: %v", err)
+	}
+	defer s.Close()
+
+	fi, err := os.Stat(s.TokenFile)
+	if err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatalf("expected token file with mode 0600, got %v %v", fi, err)
+	}
+	token, _ := os.ReadFile(s.TokenFile)
+
+	c := NewClient(s.ListenAddr())
+	if _, err = c.State(); err == nil || !strings.Contains(err.Error(), "token") {
+		t.Errorf("expected request without token to fail, got %v", err)
+	}
+	c.Token = strings.TrimSpace(string(token))
+	state, err := c.State()
+	if err != nil || !strings.Contains(string(state), `"workers":2`) {
+		t.Errorf("State over unix socket: %s %v", state, err)
+	}
+}
+
+func TestServer_RejectsBrowserRequests(t *testing.T) {
+	ctrl := &fakeController{workers: 2}
+	s := NewServer("127.0.0.1:0", ctrl)
+	s.Token = "secret"
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		host   string
+		want   int
+	}{
+		{"ok", map[string]string{"Content-Type": "application/json"}, "127.0.0.1:9091", http.StatusOK},
+		{"charset", map[string]string{"Content-Type": "application/json; charset=utf-8"}, "localhost:9091", http.StatusOK},
+		{"form", map[string]string{"Content-Type": "application/x-www-form-urlencoded"}, "127.0.0.1:9091", http.StatusUnsupportedMediaType},
+		{"text", map[string]string{"Content-Type": "text/plain"}, "127.0.0.1:9091", http.StatusUnsupportedMediaType},
+		{"no content type", nil, "127.0.0.1:9091", http.StatusUnsupportedMediaType},
+		{"origin", map[string]string{"Content-Type": "application/json", "Origin": "http://evil.example"}, "127.0.0.1:9091", http.StatusForbidden},
+		{"rebinding", map[string]string{"Content-Type": "application/json"}, "evil.example:9091", http.StatusForbidden},
+		{"no token", map[string]string{"Content-Type": "application/json", "Authorization": ""}, "127.0.0.1:9091", http.StatusUnauthorized},
+		{"wrong token", map[string]string{"Content-Type": "application/json", "Authorization": "Bearer guess"}, "127.0.0.1:9091", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/pause", strings.NewReader("{}"))
+			req.Host = tt.host
+			req.Header.Set("Authorization", "Bearer secret")
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("got status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+	if ctrl.paused != true {
+		t.Error("expected accepted requests to pause the crawl")
+	}
+
+	// GET /state не требует Content-Type, но проверяется так же.
+	req := httptest.NewRequest(http.MethodGet, "/state", nil)
+	req.Host = "evil.example"
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected GET with foreign Host to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestValidateAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		wantErr bool
+	}{
+		{"127.0.0.1:9091", false},
+		{"localhost:9091", false},
+		{"[::1]:9091", false},
+		{"unix:/tmp/site-mirror.sock", false},
+		{"0.0.0.0:9091", true},
+		{"192.168.1.10:9091", true},
+		{"unix:", true},
+		{"9091", true},
+	}
+	for _, tt := range tests {
+		if err := ValidateAddr(tt.addr); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateAddr(%q) error = %v, wantErr %v", tt.addr, err, tt.wantErr)
+		}
+	}
+}
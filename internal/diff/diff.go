@@ -0,0 +1,139 @@
+package diff
+
+import (
+	"site-mirror/internal/mediatype"
+	"site-mirror/internal/parser"
+	"site-mirror/internal/storage"
+	"sort"
+	"strings"
+)
+
+// Виды изменений URL между снимками.
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// Snapshot - сравниваемая копия: каталог и её манифест.
+type Snapshot struct {
+	Name     string
+	Dir      string
+	Manifest *storage.Manifest
+}
+
+type Options struct {
+	// Ignore - элементы HTML, изменения которых не учитываются, например
+	// счётчики, даты сборки и CSRF-токены.
+	Ignore []parser.Selector
+	// Context - строки контекста вокруг изменений текста.
+	Context int
+}
+
+// Change - URL, который появился, пропал или изменился.
+type Change struct {
+	Kind        string `json:"change"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type,omitempty"`
+	OldSize     int64  `json:"old_size"`
+	NewSize     int64  `json:"new_size"`
+	// Diff - изменения текста в формате unified diff, для двоичных файлов пуст.
+	Diff []string `json:"diff,omitempty"`
+}
+
+type Report struct {
+	Old     string   `json:"old"`
+	New     string   `json:"new"`
+	Changes []Change `json:"changes"`
+	// Unchanged - URL с тем же содержимым, включая Normalized.
+	Unchanged int `json:"unchanged"`
+	// Normalized - файлы с другим SHA-256, текст которых совпал после
+	// нормализации пробелов и удаления игнорируемых элементов.
+	Normalized int `json:"normalized"`
+}
+
+// Count возвращает число изменений вида kind.
+func (r *Report) Count(kind string) int {
+	n := 0
+	for _, c := range r.Changes {
+		if c.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+// Compare сравнивает снимок to с from по манифестам. Файлы с одинаковым SHA-256 не
+// читаются; у изменившихся HTML сравнивается видимый текст, у других текстовых
+// файлов - строки без лишних пробелов, у двоичных - только размер.
+func Compare(from, to Snapshot, opts Options) (*Report, error) {
+	r := &Report{Old: from.Name, New: to.Name, Changes: []Change{}}
+	oldEntries := make(map[string]storage.ManifestEntry)
+	for _, e := range from.Manifest.Entries() {
+		oldEntries[e.URL] = e
+	}
+
+	pars := parser.NewParser()
+	for _, e := range to.Manifest.Entries() {
+		prev, ok := oldEntries[e.URL]
+		delete(oldEntries, e.URL)
+		switch {
+		case !ok:
+			r.Changes = append(r.Changes, Change{Kind: Added, URL: e.URL, ContentType: e.ContentType, NewSize: e.Size})
+			continue
+		case prev.SHA256 == e.SHA256:
+			r.Unchanged++
+			continue
+		}
+
+		c := Change{Kind: Changed, URL: e.URL, ContentType: e.ContentType, OldSize: prev.Size, NewSize: e.Size}
+		if isText(prev.ContentType) && isText(e.ContentType) {
+			a, err := textLines(pars, from.Dir, prev, opts.Ignore)
+			if err != nil {
+				return nil, err
+			}
+			b, err := textLines(pars, to.Dir, e, opts.Ignore)
+			if err != nil {
+				return nil, err
+			}
+			if c.Diff = Lines(a, b, opts.Context); len(c.Diff) == 0 {
+				r.Unchanged++
+				r.Normalized++
+				continue
+			}
+		}
+		r.Changes = append(r.Changes, c)
+	}
+
+	for _, e := range from.Manifest.Entries() {
+		if _, ok := oldEntries[e.URL]; ok {
+			r.Changes = append(r.Changes, Change{Kind: Removed, URL: e.URL, ContentType: e.ContentType, OldSize: e.Size})
+		}
+	}
+	sort.Slice(r.Changes, func(i, j int) bool { return r.Changes[i].URL < r.Changes[j].URL })
+	return r, nil
+}
+
+// textLines читает файл записи и нормализует его для сравнения.
+func textLines(pars *parser.Parser, dir string, e storage.ManifestEntry, ignore []parser.Selector) ([]string, error) {
+	content, err := storage.ReadEntry(dir, e)
+	if err != nil {
+		return nil, err
+	}
+	if mediatype.Of(e.ContentType) == "text/html" {
+		return pars.TextLines(content, ignore)
+	}
+	var lines []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+func isText(contentType string) bool {
+	mt := mediatype.Of(contentType)
+	return strings.HasPrefix(mt, "text/") || strings.HasSuffix(mt, "javascript") ||
+		strings.HasSuffix(mt, "json") || strings.HasSuffix(mt, "xml")
+}
@@ -0,0 +1,93 @@
+package diff
+
+import (
+	"bytes"
+	"net/url"
+	"site-mirror/internal/parser"
+	"site-mirror/internal/storage"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	a := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	b := []string{"a", "B", "c", "d", "e", "f", "g", "h", "i"}
+
+	got := Lines(a, b, 1)
+	want := []string{
+		"@@ -1,3 +1,3 @@", " a", "-b", "+B", " c",
+		"@@ -8,1 +8,2 @@", " h", "+i",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Lines() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	// С большим контекстом изменения сливаются в одну группу.
+	if got = Lines(a, b, 3); len(got) == 0 || strings.Count(strings.Join(got, "\n"), "@@ -") != 1 {
+		t.Errorf("expected one hunk with context 3, got %q", got)
+	}
+	if got = Lines(a, a, 3); len(got) != 0 {
+		t.Errorf("expected no diff for equal lines, got %q", got)
+	}
+}
+
+func saveAll(t *testing.T, dir string, files map[string]string) *storage.Manifest {
+	t.Helper()
+	s := storage.NewStorage(dir)
+	s.Manifest = storage.NewManifest()
+	s.Dedup = storage.DedupPointer
+	for path, content := range files {
+		u, _ := url.Parse("https://example.com" + path)
+		contentType := "text/html"
+		if strings.HasSuffix(path, ".png") {
+			contentType = "image/png"
+		}
+		if err := s.Save(u, []byte(content), contentType); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s.Manifest
+}
+
+func TestCompare(t *testing.T) {
+	oldDir, newDir := t.TempDir(), t.TempDir()
+	oldFiles := map[string]string{
+		"/":         `<p>Welcome</p><p>Price: 10</p>`,
+		"/about":    `<p>About us</p><time>Mon</time>`,
+		"/gone":     `<p>bye</p>`,
+		"/logo.png": "PNG",
+	}
+	newFiles := map[string]string{
+		"/":         `<p>Welcome</p><p>Price: 12</p>`,
+		"/about":    `<p>About   us</p><time>Tue</time>`,
+		"/new":      `<p>hi</p>`,
+		"/logo.png": "PNG v2",
+	}
+	ignore, _ := parser.ParseSelectors("time")
+	r, err := Compare(
+		Snapshot{Name: "old", Dir: oldDir, Manifest: saveAll(t, oldDir, oldFiles)},
+		Snapshot{Name: "new", Dir: newDir, Manifest: saveAll(t, newDir, newFiles)},
+		Options{Ignore: ignore, Context: 1},
+	)
+	if err != nil {
+		t.Fatalf("Compare returned error: %v", err)
+	}
+
+	if r.Count(Added) != 1 || r.Count(Removed) != 1 || r.Count(Changed) != 2 || r.Unchanged != 1 || r.Normalized != 1 {
+		t.Errorf("unexpected report %+v", r)
+	}
+	var buf bytes.Buffer
+	if err = r.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"added    https://example.com/new (9B)\n",
+		"removed  https://example.com/gone (10B)\n",
+		"changed  https://example.com/\n  @@ -1,2 +1,2 @@\n   Welcome\n  -Price: 10\n  +Price: 12\n",
+		"changed  https://example.com/logo.png 3B -> 6B (+3B)\n",
+		"1 added, 1 removed, 2 changed, 1 unchanged (1 differ only in whitespace or ignored elements)\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected %q in report:\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package diff
+
+import "fmt"
+
+// maxCells ограничивает таблицу LCS: у больших изменений строки не
+// сопоставляются, всё старое удаляется и всё новое добавляется.
+const maxCells = 1 << 22
+
+type op struct {
+	kind   byte // ' ', '-' или '+'
+	line   string
+	ai, bi int
+}
+
+// Lines сравнивает строки a и b и возвращает изменения в формате unified diff:
+// заголовки @@ и строки с префиксами " ", "-" и "+", context строк контекста
+// вокруг изменений. Одинаковые a и b - пустой результат.
+func Lines(a, b []string, context int) []string {
+	ops := lineOps(a, b)
+
+	var out []string
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		// Группа изменений с контекстом; изменения, между которыми не больше
+		// 2*context общих строк, попадают в одну группу.
+		start := max(i-context, 0)
+		end := i
+		for j := i; j < len(ops) && j <= end+2*context+1; j++ {
+			if ops[j].kind != ' ' {
+				end = j
+			}
+		}
+		end = min(end+context+1, len(ops))
+
+		var oldLines, newLines int
+		for _, o := range ops[start:end] {
+			if o.kind != '+' {
+				oldLines++
+			}
+			if o.kind != '-' {
+				newLines++
+			}
+		}
+		out = append(out, fmt.Sprintf("@@ -%s +%s @@", hunkRange(ops[start].ai, oldLines), hunkRange(ops[start].bi, newLines)))
+		for _, o := range ops[start:end] {
+			out = append(out, string(o.kind)+o.line)
+		}
+		i = end
+	}
+	return out
+}
+
+// hunkRange - начало и число строк группы; пустая группа, как в diff -u,
+// указывает на строку перед собой.
+func hunkRange(start, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
+
+// lineOps сопоставляет строки через наибольшую общую подпоследовательность,
+// общие начало и конец отрезаются заранее.
+func lineOps(a, b []string) []op {
+	var prefix, suffix int
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]op, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, op{kind: ' ', line: a[i], ai: i, bi: i})
+	}
+
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(ma)*len(mb) > maxCells {
+		for i, line := range ma {
+			ops = append(ops, op{kind: '-', line: line, ai: prefix + i, bi: prefix})
+		}
+		for i, line := range mb {
+			ops = append(ops, op{kind: '+', line: line, ai: prefix + len(ma), bi: prefix + i})
+		}
+	} else {
+		// lcs[i][j] - длина общей подпоследовательности ma[i:] и mb[j:].
+		lcs := make([][]int32, len(ma)+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, len(mb)+1)
+		}
+		for i := len(ma) - 1; i >= 0; i-- {
+			for j := len(mb) - 1; j >= 0; j-- {
+				if ma[i] == mb[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(ma) || j < len(mb) {
+			switch {
+			case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+				ops = append(ops, op{kind: ' ', line: ma[i], ai: prefix + i, bi: prefix + j})
+				i++
+				j++
+			case j == len(mb) || (i < len(ma) && lcs[i+1][j] >= lcs[i][j+1]):
+				ops = append(ops, op{kind: '-', line: ma[i], ai: prefix + i, bi: prefix + j})
+				i++
+			default:
+				ops = append(ops, op{kind: '+', line: mb[j], ai: prefix + i, bi: prefix + j})
+				j++
+			}
+		}
+	}
+
+	for i := 0; i < suffix; i++ {
+		ai, bi := len(a)-suffix+i, len(b)-suffix+i
+		ops = append(ops, op{kind: ' ', line: a[ai], ai: ai, bi: bi})
+	}
+	return ops
+}
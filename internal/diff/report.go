@@ -0,0 +1,53 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"site-mirror/internal/units"
+	"strings"
+)
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText выводит изменения по URL: размер добавленных и удалённых файлов,
+// изменения текста или размера изменённых, и итоговую строку.
+func (r *Report) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Comparing %s -> %s\n", r.Old, r.New)
+	for _, c := range r.Changes {
+		switch {
+		case c.Kind == Added:
+			fmt.Fprintf(&b, "%-8s %s (%s)\n", c.Kind, c.URL, units.FormatBytes(c.NewSize))
+		case c.Kind == Removed:
+			fmt.Fprintf(&b, "%-8s %s (%s)\n", c.Kind, c.URL, units.FormatBytes(c.OldSize))
+		case len(c.Diff) > 0:
+			fmt.Fprintf(&b, "%-8s %s\n", c.Kind, c.URL)
+			for _, line := range c.Diff {
+				fmt.Fprintf(&b, "  %s\n", line)
+			}
+		default:
+			fmt.Fprintf(&b, "%-8s %s %s -> %s (%s)\n", c.Kind, c.URL,
+				units.FormatBytes(c.OldSize), units.FormatBytes(c.NewSize), sizeDelta(c.NewSize-c.OldSize))
+		}
+	}
+	fmt.Fprintf(&b, "%d added, %d removed, %d changed, %d unchanged",
+		r.Count(Added), r.Count(Removed), r.Count(Changed), r.Unchanged)
+	if r.Normalized > 0 {
+		fmt.Fprintf(&b, " (%d differ only in whitespace or ignored elements)", r.Normalized)
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func sizeDelta(n int64) string {
+	if n < 0 {
+		return "-" + units.FormatBytes(-n)
+	}
+	return "+" + units.FormatBytes(n)
+}
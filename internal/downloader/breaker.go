@@ -0,0 +1,206 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"site-mirror/internal/metrics"
+	"sync"
+	"time"
+)
+
+var (
+	ErrCircuitOpen = errors.New("circuit open")
+	ErrHostDown    = errors.New("host is down")
+)
+
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+	CircuitDead
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	case CircuitDead:
+		return "dead"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerConfig: после Threshold неудач подряд хост открывается на Cooldown,
+// затем один пробный запрос проверяет восстановление. Каждая неудачная проба
+// удваивает паузу, после MaxProbes проб хост считается недоступным.
+type BreakerConfig struct {
+	Threshold int
+	Cooldown  time.Duration
+	MaxProbes int
+}
+
+type circuit struct {
+	state    CircuitState
+	failures int
+	probes   int
+	probing  bool
+}
+
+// Breaker - автоматический выключатель по хостам. OnChange вызывается вне
+// блокировок при каждой смене состояния хоста.
+type Breaker struct {
+	Logger   *slog.Logger
+	Metrics  metrics.Metrics
+	OnChange func(host string, state CircuitState)
+
+	cfg   BreakerConfig
+	mu    sync.Mutex
+	hosts map[string]*circuit
+	after func(d time.Duration, f func())
+}
+
+func NewBreaker(cfg BreakerConfig) *Breaker {
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = 5
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = 30 * time.Second
+	}
+	if cfg.MaxProbes <= 0 {
+		cfg.MaxProbes = 1
+	}
+	return &Breaker{
+		Logger:  slog.Default(),
+		Metrics: metrics.Nop{},
+		cfg:     cfg,
+		hosts:   make(map[string]*circuit),
+		after: func(d time.Duration, f func()) {
+			time.AfterFunc(d, f)
+		},
+	}
+}
+
+func (b *Breaker) circuit(host string) *circuit {
+	c, ok := b.hosts[host]
+	if !ok {
+		c = &circuit{}
+		b.hosts[host] = c
+	}
+	return c
+}
+
+// Allow разрешает запрос к хосту. В состоянии half-open пропускается
+// только один пробный запрос.
+func (b *Breaker) Allow(host string) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuit(host)
+	switch c.state {
+	case CircuitOpen:
+		return ErrCircuitOpen
+	case CircuitHalfOpen:
+		if c.probing {
+			return ErrCircuitOpen
+		}
+		c.probing = true
+	case CircuitDead:
+		return ErrHostDown
+	}
+	return nil
+}
+
+// Ready сообщает, стоит ли выдавать задачи хоста воркерам. Задачи недоступного
+// хоста выдаются, чтобы сразу завершиться ошибкой.
+func (b *Breaker) Ready(host string) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuit(host)
+	return c.state == CircuitClosed || c.state == CircuitDead || (c.state == CircuitHalfOpen && !c.probing)
+}
+
+func (b *Breaker) State(host string) CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.circuit(host).state
+}
+
+// Record учитывает результат попытки запроса к хосту.
+func (b *Breaker) Record(host string, ok bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	c := b.circuit(host)
+	prev := c.state
+
+	switch {
+	case ok:
+		c.failures = 0
+		if c.state == CircuitHalfOpen {
+			c.state = CircuitClosed
+			c.probes = 0
+			c.probing = false
+		}
+	case c.state == CircuitClosed:
+		c.failures++
+		if c.failures >= b.cfg.Threshold {
+			c.state = CircuitOpen
+			b.schedule(host, b.cfg.Cooldown)
+		}
+	case c.state == CircuitHalfOpen:
+		c.probes++
+		c.probing = false
+		if c.probes >= b.cfg.MaxProbes {
+			c.state = CircuitDead
+		} else {
+			c.state = CircuitOpen
+			b.schedule(host, b.cfg.Cooldown<<c.probes)
+		}
+	}
+	state := c.state
+	b.mu.Unlock()
+
+	if state != prev {
+		b.changed(host, prev, state)
+	}
+}
+
+func (b *Breaker) schedule(host string, cooldown time.Duration) {
+	b.after(cooldown, func() {
+		b.mu.Lock()
+		c := b.circuit(host)
+		if c.state != CircuitOpen {
+			b.mu.Unlock()
+			return
+		}
+		c.state = CircuitHalfOpen
+		b.mu.Unlock()
+		b.changed(host, CircuitOpen, CircuitHalfOpen)
+	})
+}
+
+func (b *Breaker) changed(host string, from, to CircuitState) {
+	b.Metrics.Set(metrics.CircuitState, float64(to), "host", host)
+	level := slog.LevelWarn
+	if to == CircuitClosed || to == CircuitHalfOpen {
+		level = slog.LevelInfo
+	}
+	b.Logger.Log(context.Background(), level, "circuit "+to.String(), "host", host, "from", from.String())
+	if b.OnChange != nil {
+		b.OnChange(host, to)
+	}
+}
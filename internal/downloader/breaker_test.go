@@ -0,0 +1,137 @@
+package downloader
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// newTestBreaker возвращает выключатель, у которого таймеры срабатывают по вызову fire.
+func newTestBreaker(cfg BreakerConfig) (*Breaker, *[]time.Duration, func()) {
+	b := NewBreaker(cfg)
+	var delays []time.Duration
+	var pending []func()
+	b.after = func(d time.Duration, f func()) {
+		delays = append(delays, d)
+		pending = append(pending, f)
+	}
+	fire := func() {
+		fns := pending
+		pending = nil
+		for _, f := range fns {
+			f()
+		}
+	}
+	return b, &delays, fire
+}
+
+func TestBreaker_OpenProbeClose(t *testing.T) {
+	b, _, fire := newTestBreaker(BreakerConfig{Threshold: 2, Cooldown: time.Minute, MaxProbes: 3})
+	var changes []CircuitState
+	b.OnChange = func(_ string, s CircuitState) { changes = append(changes, s) }
+
+	b.Record("a.com", false)
+	if err := b.Allow("a.com"); err != nil {
+		t.Fatalf("circuit opened before threshold: %v", err)
+	}
+	b.Record("a.com", false)
+	if err := b.Allow("a.com"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen after threshold, got %v", err)
+	}
+	if b.Ready("a.com") || !b.Ready("b.com") {
+		t.Error("only the failing host should be held back")
+	}
+
+	fire()
+	if b.State("a.com") != CircuitHalfOpen || !b.Ready("a.com") {
+		t.Fatalf("expected half-open after cooldown, got %v", b.State("a.com"))
+	}
+	if err := b.Allow("a.com"); err != nil {
+		t.Fatalf("probe should be allowed, got %v", err)
+	}
+	if err := b.Allow("a.com"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("only one probe should be allowed, got %v", err)
+	}
+
+	b.Record("a.com", true)
+	if b.State("a.com") != CircuitClosed {
+		t.Errorf("expected closed after successful probe, got %v", b.State("a.com"))
+	}
+	want := []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitClosed}
+	if len(changes) != len(want) {
+		t.Fatalf("expected changes %v, got %v", want, changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("expected changes %v, got %v", want, changes)
+		}
+	}
+}
+
+func TestBreaker_FailedProbesMarkHostDown(t *testing.T) {
+	b, delays, fire := newTestBreaker(BreakerConfig{Threshold: 1, Cooldown: time.Second, MaxProbes: 2})
+
+	b.Record("a.com", false)
+	fire()
+	_ = b.Allow("a.com")
+	b.Record("a.com", false)
+	if b.State("a.com") != CircuitOpen {
+		t.Fatalf("expected open after first failed probe, got %v", b.State("a.com"))
+	}
+
+	fire()
+	_ = b.Allow("a.com")
+	b.Record("a.com", false)
+	if b.State("a.com") != CircuitDead {
+		t.Fatalf("expected dead after max probes, got %v", b.State("a.com"))
+	}
+	if err := b.Allow("a.com"); !errors.Is(err, ErrHostDown) {
+		t.Errorf("expected ErrHostDown, got %v", err)
+	}
+	if !b.Ready("a.com") {
+		t.Error("tasks of a dead host should be handed out to fail fast")
+	}
+	if len(*delays) != 2 || (*delays)[0] != time.Second || (*delays)[1] != 2*time.Second {
+		t.Errorf("expected cooldown doubling after failed probe, got %v", *delays)
+	}
+}
+
+func TestBreaker_SuccessResetsFailures(t *testing.T) {
+	b, _, _ := newTestBreaker(BreakerConfig{Threshold: 2})
+	b.Record("a.com", false)
+	b.Record("a.com", true)
+	b.Record("a.com", false)
+	if b.State("a.com") != CircuitClosed {
+		t.Errorf("failures should be consecutive, got %v", b.State("a.com"))
+	}
+}
+
+func TestDownloader_Fetch_CircuitOpen(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		requests++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	d, _ := NewDownloader(u, "TestBot")
+	d.Breaker, _, _ = newTestBreaker(BreakerConfig{Threshold: 1})
+
+	if _, err := d.Fetch(u, false); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected retries to stop at open circuit, got %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("expected a single request before the circuit opened, got %d", requests)
+	}
+	if _, err := d.Fetch(u, false); !errors.Is(err, ErrCircuitOpen) || requests != 1 {
+		t.Errorf("expected open circuit to block requests, got %v after %d requests", err, requests)
+	}
+}
@@ -2,11 +2,15 @@ package downloader
 
 import (
 	"errors"
-	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"site-mirror/internal/adaptive"
+	"site-mirror/internal/metrics"
+	"site-mirror/internal/ratelimit"
 	"site-mirror/internal/robots"
+	"strconv"
 	"time"
 )
 
@@ -14,6 +18,7 @@ var (
 	ErrTooManyAttempts          = errors.New("too many requests")
 	ErrDisallowed               = errors.New("disallowed")
 	ErrCouldNotCreateDownloader = errors.New("could not create downloader")
+	ErrNotModified              = errors.New("not modified")
 )
 
 const maxAttempts = 3
@@ -21,7 +26,17 @@ const maxAttempts = 3
 type Downloader struct {
 	Client    *http.Client
 	Robots    *robots.Robots
+	Limiter   *ratelimit.Limiter
+	Adaptive  *adaptive.Controller
+	Breaker   *Breaker
+	Logger    *slog.Logger
+	Metrics   metrics.Metrics
 	UserAgent string
+	// IfModifiedSince возвращает время сохранённой копии URL для условного запроса,
+	// нулевое время - запрос без условия.
+	IfModifiedSince func(u *url.URL) time.Time
+	// IfNoneMatch возвращает ETag сохранённой копии URL, пустой - без условия.
+	IfNoneMatch func(u *url.URL) string
 }
 
 func NewDownloader(u *url.URL, userAgent string) (*Downloader, error) {
@@ -35,53 +50,198 @@ func NewDownloader(u *url.URL, userAgent string) (*Downloader, error) {
 			Timeout: time.Second * 30,
 		},
 		Robots:    r,
+		Logger:    slog.Default(),
+		Metrics:   metrics.Nop{},
 		UserAgent: userAgent,
 	}, nil
 }
 
+type Response struct {
+	URL         *url.URL
+	Body        []byte
+	ContentType string
+	StatusCode  int
+	Header      http.Header
+	Attempts    int
+	Duration    time.Duration
+	// Redirects - адреса, на которые перенаправлял сервер, по порядку; последний - итоговый.
+	Redirects []string
+}
+
 func (d *Downloader) Download(u *url.URL, useRobots bool) ([]byte, string, error) {
-	var resp *http.Response
-	var err error
+	resp, err := d.Fetch(u, useRobots)
+	if err != nil {
+		return nil, "", err
+	}
+	return resp.Body, resp.ContentType, nil
+}
+
+// Fetch скачивает URL с повторами. Ответ возвращается и вместе с ошибкой,
+// чтобы вызывающий мог записать статус, число попыток и длительность.
+func (d *Downloader) Fetch(u *url.URL, useRobots bool) (*Response, error) {
+	result := &Response{URL: u}
+	start := time.Now()
+	defer func() { result.Duration = time.Since(start) }()
 
 	if useRobots && !d.Robots.IsAllowed(d.UserAgent, u) {
-		return nil, "", ErrDisallowed
+		d.logger().Debug("disallowed by robots.txt", "url", u.String())
+		metrics.Inc(d.metrics(), metrics.RobotsDenied)
+		return result, ErrDisallowed
 	}
 
-	attempts := 0
-	for attempts < maxAttempts {
-		fmt.Printf("Downloading %s, attempt: %d\n", u.String(), attempts)
-		resp, err = d.Client.Get(u.String())
+	var resp *http.Response
+	var err error
+	for result.Attempts < maxAttempts {
+		if err = d.Breaker.Allow(u.Host); err != nil {
+			return result, err
+		}
+		d.Limiter.WaitRequest()
+		release := d.Adaptive.Acquire(u.Host)
+		d.logger().Debug("downloading", "url", u.String(), "attempt", result.Attempts)
+		if result.Attempts > 0 {
+			metrics.Inc(d.metrics(), metrics.RetriesTotal)
+		}
+		reqStart := time.Now()
+		resp, err = d.get(u)
+		latency := time.Since(reqStart)
+		d.metrics().Observe(metrics.RequestDuration, latency.Seconds())
 		if err != nil {
-			attempts++
-			time.Sleep(time.Second * time.Duration(attempts))
+			release(adaptive.Outcome{Latency: latency, Err: err})
+			d.Breaker.Record(u.Host, false)
+			metrics.Inc(d.metrics(), metrics.RequestsTotal, "status", "error")
+			result.Attempts++
+			d.logger().Warn("request failed", "url", u.String(), "attempt", result.Attempts, "err", err)
+			time.Sleep(time.Second * time.Duration(result.Attempts))
 			continue
 		}
+		result.StatusCode = resp.StatusCode
+		result.Redirects = redirects(resp)
+		metrics.Inc(d.metrics(), metrics.RequestsTotal, "status", strconv.Itoa(resp.StatusCode))
+		d.Breaker.Record(u.Host, resp.StatusCode < http.StatusInternalServerError)
+		if resp.StatusCode == http.StatusNotModified {
+			release(adaptive.Outcome{Latency: latency, StatusCode: resp.StatusCode})
+			result.Attempts++
+			result.Header = resp.Header
+			if err = resp.Body.Close(); err != nil {
+				return result, err
+			}
+			return result, ErrNotModified
+		}
 		if resp.StatusCode == http.StatusOK {
+			// Удачная попытка освобождает место в лимите хоста после чтения тела.
+			defer release(adaptive.Outcome{Latency: latency, StatusCode: resp.StatusCode})
 			break
 		}
 
+		release(adaptive.Outcome{Latency: latency, StatusCode: resp.StatusCode})
 		err = resp.Body.Close()
 		if err != nil {
-			return nil, "", err
+			return result, err
 		}
-		attempts++
-		if attempts < maxAttempts {
-			time.Sleep(time.Second * time.Duration(attempts))
+		result.Attempts++
+		if result.Attempts < maxAttempts {
+			time.Sleep(time.Second * time.Duration(result.Attempts))
 		}
 	}
 
 	if resp != nil && resp.StatusCode != http.StatusOK {
-		fmt.Printf("Can't download %s after attempt: %d, last status: %d\n", u.String(), attempts, resp.StatusCode)
-		return nil, "", ErrTooManyAttempts
+		d.logger().Warn("giving up", "url", u.String(), "attempts", result.Attempts, "status", resp.StatusCode)
+		return result, ErrTooManyAttempts
 	}
 
 	if err != nil {
-		return nil, "", err
+		return result, err
 	}
+	result.Attempts++
 
-	respBody, err := io.ReadAll(resp.Body)
+	respBody, err := io.ReadAll(d.Limiter.Reader(resp.Body))
+	errClose := resp.Body.Close()
 	if err != nil {
-		return nil, "", err
+		return result, err
+	}
+	if errClose != nil {
+		return result, errClose
+	}
+
+	d.metrics().Add(metrics.DownloadedBytes, float64(len(respBody)))
+	result.Body = respBody
+	result.ContentType = resp.Header.Get("Content-Type")
+	result.Header = resp.Header
+	return result, nil
+}
+
+// Probe выполняет один запрос method без повторов, как при проверке ссылок.
+// Ответ с любым статусом не считается ошибкой, тело читается только у GET.
+func (d *Downloader) Probe(u *url.URL, method string) (*Response, error) {
+	result := &Response{URL: u}
+	start := time.Now()
+	defer func() { result.Duration = time.Since(start) }()
+
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return result, err
+	}
+	d.Limiter.WaitRequest()
+	d.logger().Debug("probing", "url", u.String(), "method", method)
+	result.Attempts = 1
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		metrics.Inc(d.metrics(), metrics.RequestsTotal, "status", "error")
+		return result, err
+	}
+	metrics.Inc(d.metrics(), metrics.RequestsTotal, "status", strconv.Itoa(resp.StatusCode))
+	result.StatusCode = resp.StatusCode
+	result.Redirects = redirects(resp)
+	result.ContentType = resp.Header.Get("Content-Type")
+	result.Header = resp.Header
+
+	if method == http.MethodGet {
+		result.Body, err = io.ReadAll(d.Limiter.Reader(resp.Body))
+		d.metrics().Add(metrics.DownloadedBytes, float64(len(result.Body)))
+	}
+	if errClose := resp.Body.Close(); err == nil {
+		err = errClose
+	}
+	return result, err
+}
+
+// redirects восстанавливает цепочку перенаправлений, пройденную клиентом до resp.
+func redirects(resp *http.Response) []string {
+	var chain []string
+	for r := resp; r.Request != nil && r.Request.Response != nil; r = r.Request.Response {
+		chain = append([]string{r.Request.URL.String()}, chain...)
+	}
+	return chain
+}
+
+func (d *Downloader) get(u *url.URL) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if d.IfModifiedSince != nil {
+		if since := d.IfModifiedSince(u); !since.IsZero() {
+			req.Header.Set("If-Modified-Since", since.UTC().Format(http.TimeFormat))
+		}
+	}
+	if d.IfNoneMatch != nil {
+		if etag := d.IfNoneMatch(u); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+	}
+	return d.Client.Do(req)
+}
+
+func (d *Downloader) metrics() metrics.Metrics {
+	if d.Metrics == nil {
+		return metrics.Nop{}
+	}
+	return d.Metrics
+}
+
+func (d *Downloader) logger() *slog.Logger {
+	if d.Logger == nil {
+		return slog.Default()
 	}
-	return respBody, resp.Header.Get("Content-Type"), nil
+	return d.Logger
 }
@@ -5,6 +5,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"site-mirror/internal/adaptive"
+	"site-mirror/internal/metrics"
+	"site-mirror/internal/ratelimit"
+	"strings"
 	"testing"
 	"time"
 )
@@ -153,3 +157,246 @@ func TestDownloader_Download_RobotsDisallowed(t *testing.T) {
 		t.Fatalf("expected ErrDisallowed, got %v", err)
 	}
 }
+
+func TestDownloader_Download_RateLimited(t *testing.T) {
+	expectedBody := strings.Repeat("x", 4096)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(expectedBody))
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	d, _ := NewDownloader(u, "TestBot")
+	d.Limiter = ratelimit.New(0, 2048, nil)
+
+	start := time.Now()
+	body, _, err := d.Download(u, false)
+	elapsed := time.Since(start)
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(body) != expectedBody {
+		t.Errorf("body mismatch: got %d bytes", len(body))
+	}
+	if elapsed < 900*time.Millisecond {
+		t.Errorf("expected throttled download to take about 1s, took %v", elapsed)
+	}
+}
+
+func TestDownloader_Fetch(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		attempts++
+		if attempts < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html></html>"))
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	d, _ := NewDownloader(u, "TestBot")
+
+	resp, err := d.Fetch(u, false)
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Attempts != 2 {
+		t.Errorf("expected status 200 after 2 attempts, got %d after %d", resp.StatusCode, resp.Attempts)
+	}
+	if resp.ContentType != "text/html" || string(resp.Body) != "<html></html>" {
+		t.Errorf("unexpected response %q %q", resp.ContentType, resp.Body)
+	}
+	if resp.Duration <= 0 {
+		t.Error("expected positive duration")
+	}
+}
+
+func TestDownloader_Fetch_NotModified(t *testing.T) {
+	saved := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+		if err == nil && !since.Before(saved) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write([]byte("fresh"))
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL + "/page")
+	d, _ := NewDownloader(u, "TestBot")
+	d.IfModifiedSince = func(u *url.URL) time.Time {
+		if u.Path == "/page" {
+			return saved
+		}
+		return time.Time{}
+	}
+
+	resp, err := d.Fetch(u, false)
+	if !errors.Is(err, ErrNotModified) || resp.StatusCode != http.StatusNotModified || resp.Attempts != 1 {
+		t.Fatalf("expected single 304 attempt, got %d after %d attempts, err %v", resp.StatusCode, resp.Attempts, err)
+	}
+
+	other, _ := url.Parse(server.URL + "/other")
+	if body, _, err := d.Download(other, false); err != nil || string(body) != "fresh" {
+		t.Errorf("expected unconditional request for unsaved URL, got %q %v", body, err)
+	}
+}
+
+func TestDownloader_Fetch_IfNoneMatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v2"`)
+		_, _ = w.Write([]byte("fresh"))
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL + "/page")
+	d, _ := NewDownloader(u, "TestBot")
+	etag := `"v1"`
+	d.IfNoneMatch = func(*url.URL) string { return etag }
+
+	if _, err := d.Fetch(u, false); !errors.Is(err, ErrNotModified) {
+		t.Fatalf("expected ErrNotModified for matching ETag, got %v", err)
+	}
+	etag = ""
+	resp, err := d.Fetch(u, false)
+	if err != nil || resp.Header.Get("ETag") != `"v2"` {
+		t.Errorf("expected unconditional request without ETag, got %v", err)
+	}
+}
+
+func TestDownloader_Fetch_FailureKeepsStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	d, _ := NewDownloader(u, "TestBot")
+
+	resp, err := d.Fetch(u, false)
+
+	if !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("expected ErrTooManyAttempts, got %v", err)
+	}
+	if resp == nil || resp.StatusCode != http.StatusNotFound || resp.Attempts != maxAttempts {
+		t.Errorf("unexpected response %+v", resp)
+	}
+}
+
+func TestDownloader_Probe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/moved", http.StatusMovedPermanently)
+		case "/moved":
+			http.Redirect(w, r, "/missing", http.StatusFound)
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<p>page</p>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	d, _ := NewDownloader(u, "TestBot")
+
+	old, _ := url.Parse(server.URL + "/old")
+	resp, err := d.Probe(old, http.MethodHead)
+	if err != nil {
+		t.Fatalf("expected no error for 404, got %v", err)
+	}
+	want := []string{server.URL + "/moved", server.URL + "/missing"}
+	if resp.StatusCode != http.StatusNotFound || strings.Join(resp.Redirects, " ") != strings.Join(want, " ") {
+		t.Errorf("expected 404 after %v, got %d after %v", want, resp.StatusCode, resp.Redirects)
+	}
+	if resp.Attempts != 1 || resp.Body != nil {
+		t.Errorf("expected single HEAD without body, got %d attempts, body %q", resp.Attempts, resp.Body)
+	}
+
+	page, _ := url.Parse(server.URL + "/page")
+	resp, err = d.Probe(page, http.MethodGet)
+	if err != nil || resp.StatusCode != http.StatusOK || string(resp.Body) != "<p>page</p>" || len(resp.Redirects) != 0 {
+		t.Errorf("unexpected GET response %+v, err %v", resp, err)
+	}
+}
+
+func TestDownloader_Metrics(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		attempts++
+		if attempts < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	d, _ := NewDownloader(u, "TestBot")
+	reg := metrics.NewRegistry()
+	d.Metrics = reg
+
+	if _, err := d.Fetch(u, false); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if v := reg.Value(metrics.RequestsTotal, "status", "503"); v != 1 {
+		t.Errorf("expected one 503 request, got %v", v)
+	}
+	if v := reg.Value(metrics.RequestsTotal, "status", "200"); v != 1 {
+		t.Errorf("expected one 200 request, got %v", v)
+	}
+	if v := reg.Value(metrics.RetriesTotal); v != 1 {
+		t.Errorf("expected one retry, got %v", v)
+	}
+	if v := reg.Value(metrics.RequestDuration); v != 2 {
+		t.Errorf("expected two latency observations, got %v", v)
+	}
+	if v := reg.Value(metrics.DownloadedBytes); v != 5 {
+		t.Errorf("expected 5 downloaded bytes, got %v", v)
+	}
+}
+
+func TestDownloader_AdaptiveBacksOff(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	d, _ := NewDownloader(u, "TestBot")
+	d.Adaptive = adaptive.New(adaptive.Config{Min: 1, Max: 8, Initial: 8})
+
+	if _, err := d.Fetch(u, false); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("expected ErrTooManyAttempts, got %v", err)
+	}
+	if got := d.Adaptive.Limit(u.Host); got != 4 {
+		t.Errorf("expected host limit halved to 4 after 429s, got %d", got)
+	}
+}
@@ -0,0 +1,94 @@
+package eventlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const DefaultFile = "crawl-events.jsonl"
+
+// Record - одна строка журнала обхода на каждый обработанный URL.
+type Record struct {
+	Time        time.Time `json:"time"`
+	URL         string    `json:"url"`
+	Kind        string    `json:"kind"`
+	Depth       int       `json:"depth"`
+	Parent      string    `json:"parent,omitempty"`
+	Status      int       `json:"status,omitempty"`
+	Bytes       int64     `json:"bytes"`
+	DurationMS  float64   `json:"duration_ms"`
+	ContentType string    `json:"content_type,omitempty"`
+	SavedPath   string    `json:"saved_path,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	// SavedBytes - размер файла на диске, если его изменили преобразования.
+	SavedBytes int64 `json:"saved_bytes,omitempty"`
+	// Redirects - адреса перенаправлений по порядку, последний - итоговый.
+	Redirects []string `json:"redirects,omitempty"`
+}
+
+type Log struct {
+	mu  sync.Mutex
+	f   *os.File
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	return &Log{f: f, w: w, enc: json.NewEncoder(w)}, nil
+}
+
+func (l *Log) Write(r Record) error {
+	if l == nil {
+		return nil
+	}
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.enc.Encode(r)
+}
+
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.w.Flush(); err != nil {
+		_ = l.f.Close()
+		return err
+	}
+	return l.f.Close()
+}
+
+func Read(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []Record
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var r Record
+		if err = dec.Decode(&r); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
@@ -0,0 +1,57 @@
+package eventlog
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestLog_WriteAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out", DefaultFile)
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := l.Write(Record{URL: "https://example.com/", Kind: "page", Depth: i, Status: 200, Bytes: 10})
+			if err != nil {
+				t.Errorf("Write returned error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err = l.Write(Record{URL: "https://example.com/missing", Kind: "page", Error: "not found"}); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+	if err = l.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	records, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if len(records) != 21 {
+		t.Fatalf("got %d records, want 21", len(records))
+	}
+	last := records[20]
+	if last.Error != "not found" || last.Time.IsZero() {
+		t.Errorf("unexpected last record %+v", last)
+	}
+}
+
+func TestLog_Nil(t *testing.T) {
+	var l *Log
+	if err := l.Write(Record{URL: "https://example.com/"}); err != nil {
+		t.Errorf("nil log Write returned error: %v", err)
+	}
+	if err := l.Close(); err != nil {
+		t.Errorf("nil log Close returned error: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"site-mirror/internal/progress"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrUnknownType = errors.New("unknown event type")
+
+type Type string
+
+const (
+	TaskQueued     Type = "task_queued"
+	FetchStarted   Type = "fetch_started"
+	FetchCompleted Type = "fetch_completed"
+	Saved          Type = "saved"
+	Skipped        Type = "skipped"
+	Failed         Type = "failed"
+	// Removed - update удалил копию: страница ответила 404/410 или на неё больше нет ссылок.
+	Removed       Type = "removed"
+	CrawlFinished Type = "crawl_finished"
+)
+
+var Types = []Type{TaskQueued, FetchStarted, FetchCompleted, Saved, Skipped, Failed, Removed, CrawlFinished}
+
+// ParseTypes разбирает список типов через запятую, пустая строка - все типы.
+func ParseTypes(s string) ([]Type, error) {
+	var types []Type
+	for _, part := range strings.Split(s, ",") {
+		name := Type(strings.TrimSpace(part))
+		if name == "" {
+			continue
+		}
+		known := false
+		for _, t := range Types {
+			known = known || t == name
+		}
+		if !known {
+			return nil, fmt.Errorf("%w %q", ErrUnknownType, name)
+		}
+		types = append(types, name)
+	}
+	return types, nil
+}
+
+// Event - событие обхода. Поля заполняются по типу: Reason - у Skipped, Failed
+// и Removed, Path, Body и Raw - у Saved, Result - у CrawlFinished.
+type Event struct {
+	Type        Type              `json:"type"`
+	Time        time.Time         `json:"time"`
+	URL         string            `json:"url,omitempty"`
+	Kind        string            `json:"kind,omitempty"`
+	Depth       int               `json:"depth"`
+	Parent      string            `json:"parent,omitempty"`
+	Status      int               `json:"status,omitempty"`
+	Bytes       int64             `json:"bytes,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	Path        string            `json:"path,omitempty"`
+	Reason      string            `json:"reason,omitempty"`
+	Result      *progress.Summary `json:"result,omitempty"`
+	Redirects   []string          `json:"redirects,omitempty"`
+	// Body - сохранённое содержимое, Raw - ответ сервера до преобразований.
+	// Передаются только подписчикам в процессе.
+	Body []byte `json:"-"`
+	Raw  []byte `json:"-"`
+}
+
+type subscriber struct {
+	handler func(Event)
+	types   map[Type]bool
+}
+
+// Bus рассылает события подписчикам синхронно, в горутине, где событие возникло.
+type Bus struct {
+	mu   sync.RWMutex
+	subs []subscriber
+}
+
+// Subscribe подписывает handler на события указанных типов, без типов - на все.
+func (b *Bus) Subscribe(handler func(Event), types ...Type) {
+	s := subscriber{handler: handler}
+	if len(types) > 0 {
+		s.types = make(map[Type]bool, len(types))
+		for _, t := range types {
+			s.types[t] = true
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs = append(b.subs, s)
+}
+
+func (b *Bus) Emit(e Event) {
+	b.mu.RLock()
+	subs := b.subs
+	b.mu.RUnlock()
+	if len(subs) == 0 {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	for _, s := range subs {
+		if s.types == nil || s.types[e.Type] {
+			s.handler(e)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package events
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBus_Subscribe(t *testing.T) {
+	var b Bus
+	var all, saved []Type
+	b.Subscribe(func(e Event) { all = append(all, e.Type) })
+	b.Subscribe(func(e Event) {
+		if e.Time.IsZero() {
+			t.Error("expected event time to be set")
+		}
+		saved = append(saved, e.Type)
+	}, Saved)
+
+	b.Emit(Event{Type: TaskQueued})
+	b.Emit(Event{Type: Saved})
+
+	if len(all) != 2 || len(saved) != 1 || saved[0] != Saved {
+		t.Errorf("unexpected deliveries all=%v saved=%v", all, saved)
+	}
+}
+
+func TestParseTypes(t *testing.T) {
+	types, err := ParseTypes("saved, failed")
+	if err != nil || len(types) != 2 || types[1] != Failed {
+		t.Errorf("unexpected types %v (%v)", types, err)
+	}
+	if types, err = ParseTypes(""); err != nil || len(types) != 0 {
+		t.Errorf("expected no types for empty list, got %v (%v)", types, err)
+	}
+	if _, err = ParseTypes("saved,downloaded"); !errors.Is(err, ErrUnknownType) {
+		t.Errorf("expected ErrUnknownType, got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+// Package fsutil - запись служебных файлов зеркала без риска оставить их
+// наполовину записанными.
+package fsutil
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic записывает data во временный файл рядом с path и
+// переименовывает его поверх path: прерванная запись не портит прежний файл,
+// а параллельные записи не мешают друг другу. Каталог создаётся при необходимости.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := createTemp(path)
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err == nil {
+		err = os.Chmod(tmp, perm)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
+
+// WriteJSON записывает v в JSON с отступами через WriteFileAtomic.
+func WriteJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(path, append(data, '\n'), 0644)
+}
+
+// Replace создаёт новый файл через create под уникальным временным именем
+// рядом с path и переименовывает его поверх path. create получает свободное
+// имя, поэтому может создать и ссылку.
+func Replace(path string, create func(tmp string) error) error {
+	f, err := createTemp(path)
+	if err != nil {
+		return err
+	}
+	// Файл только резервирует имя: ссылке нужно свободное.
+	tmp := f.Name()
+	_ = f.Close()
+	if err = os.Remove(tmp); err != nil {
+		return err
+	}
+	if err = create(tmp); err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
+
+// CheckWritable создаёт каталог dir и проверяет, что в нём можно создавать файлы.
+func CheckWritable(dir string) error {
+	f, err := createTemp(filepath.Join(dir, "write-check"))
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	_ = f.Close()
+	return os.Remove(name)
+}
+
+// createTemp создаёт скрытый временный файл в каталоге path, создавая каталог.
+func createTemp(path string) (*os.File, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+}
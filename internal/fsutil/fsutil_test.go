@@ -0,0 +1,78 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sub", "state.json")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := WriteFileAtomic(path, []byte("same content"), 0644); err != nil {
+				t.Errorf("WriteFileAtomic returned error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got, err := os.ReadFile(path); err != nil || string(got) != "same content" {
+		t.Errorf("unexpected file %q %v", got, err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("expected no temporary files left, got %v", entries)
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "a", "b")
+	if err := CheckWritable(dir); err != nil {
+		t.Fatalf("CheckWritable returned error: %v", err)
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 0 {
+		t.Errorf("expected empty created dir, got %v %v", entries, err)
+	}
+
+	file := filepath.Join(t.TempDir(), "out")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckWritable(file); err == nil {
+		t.Error("expected error for a file")
+	}
+
+	readOnly := filepath.Join(t.TempDir(), "ro")
+	if err := os.Mkdir(readOnly, 0o555); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckWritable(filepath.Join(readOnly, "site")); err == nil && os.Geteuid() != 0 {
+		t.Error("expected error for a read-only parent")
+	}
+}
+
+func TestReplace(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target")
+	link := filepath.Join(dir, "link")
+	if err := os.WriteFile(target, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(link, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Replace(link, func(tmp string) error { return os.Symlink("target", tmp) }); err != nil {
+		t.Fatalf("Replace returned error: %v", err)
+	}
+	if got, err := os.Readlink(link); err != nil || got != "target" {
+		t.Errorf("expected symlink to target, got %q %v", got, err)
+	}
+}
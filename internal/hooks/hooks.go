@@ -0,0 +1,135 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"site-mirror/internal/events"
+	"sync"
+	"time"
+)
+
+var ErrDeliveryFailed = errors.New("hook delivery failed")
+
+// EventEnv - переменная окружения с типом события для Exec.
+const EventEnv = "SITE_MIRROR_EVENT"
+
+// Sink доставляет JSON-описание события во внешнюю систему.
+type Sink interface {
+	Deliver(ctx context.Context, eventType string, payload []byte) error
+}
+
+// Exec запускает команду через "sh -c" на каждое событие: JSON передаётся
+// на stdin, тип события - в SITE_MIRROR_EVENT.
+type Exec struct {
+	Command string
+}
+
+func (e Exec) Deliver(ctx context.Context, eventType string, payload []byte) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", e.Command)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(os.Environ(), EventEnv+"="+eventType)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s: %v: %s", ErrDeliveryFailed, e.Command, err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// Webhook отправляет событие POST-запросом с JSON в теле.
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+func (w Webhook) Deliver(ctx context.Context, eventType string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Site-Mirror-Event", eventType)
+
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%w: %s answered %d", ErrDeliveryFailed, w.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+// Dispatcher доставляет события приёмникам в фоне и по порядку. Медленный
+// приёмник задерживает обход, только когда заполнится буфер.
+type Dispatcher struct {
+	Logger  *slog.Logger
+	Timeout time.Duration
+
+	sinks  []Sink
+	mu     sync.Mutex
+	closed bool
+	queue  chan events.Event
+	done   chan struct{}
+}
+
+func NewDispatcher(sinks ...Sink) *Dispatcher {
+	d := &Dispatcher{
+		Logger:  slog.Default(),
+		Timeout: 30 * time.Second,
+		sinks:   sinks,
+		queue:   make(chan events.Event, 1024),
+		done:    make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+// Handle ставит событие в очередь доставки; подходит как обработчик events.Bus.
+func (d *Dispatcher) Handle(e events.Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return
+	}
+	d.queue <- e
+}
+
+// Close дожидается доставки событий из очереди.
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+	}
+	d.mu.Unlock()
+	<-d.done
+}
+
+func (d *Dispatcher) run() {
+	defer close(d.done)
+	for e := range d.queue {
+		payload, err := json.Marshal(e)
+		if err != nil {
+			d.Logger.Error("encoding hook event", "type", e.Type, "err", err)
+			continue
+		}
+		for _, s := range d.sinks {
+			ctx, cancel := context.WithTimeout(context.Background(), d.Timeout)
+			if err = s.Deliver(ctx, string(e.Type), payload); err != nil {
+				d.Logger.Warn("hook delivery failed", "type", e.Type, "url", e.URL, "err", err)
+			}
+			cancel()
+		}
+	}
+}
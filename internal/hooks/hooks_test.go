@@ -0,0 +1,84 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"site-mirror/internal/events"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWebhook_Deliver(t *testing.T) {
+	var mu sync.Mutex
+	var got []events.Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("X-Site-Mirror-Event") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var e events.Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		got = append(got, e)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	d := NewDispatcher(Webhook{URL: server.URL})
+	d.Handle(events.Event{Type: events.Saved, URL: "https://example.com/a", Body: []byte("secret")})
+	d.Handle(events.Event{Type: events.Failed, URL: "https://example.com/b", Reason: "timeout"})
+	d.Close()
+	d.Handle(events.Event{Type: events.Saved})
+
+	if len(got) != 2 || got[0].URL != "https://example.com/a" || got[1].Reason != "timeout" {
+		t.Fatalf("unexpected deliveries %+v", got)
+	}
+	if got[0].Body != nil {
+		t.Error("body should not be sent to hooks")
+	}
+}
+
+func TestWebhook_DeliverStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	err := Webhook{URL: server.URL}.Deliver(context.Background(), "saved", []byte("{}"))
+	if !errors.Is(err, ErrDeliveryFailed) {
+		t.Errorf("expected ErrDeliveryFailed, got %v", err)
+	}
+}
+
+func TestExec_Deliver(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "events")
+	e := Exec{Command: `{ echo "$` + EventEnv + `"; cat; echo; } >> ` + out}
+
+	if err := e.Deliver(context.Background(), "saved", []byte(`{"type":"saved"}`)); err != nil {
+		t.Fatalf("Deliver returned error: %v", err)
+	}
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, _ := io.ReadAll(f)
+	if string(data) != "saved\n{\"type\":\"saved\"}\n" {
+		t.Errorf("unexpected command output %q", data)
+	}
+
+	err = Exec{Command: "echo broken >&2; exit 3"}.Deliver(context.Background(), "saved", nil)
+	if !errors.Is(err, ErrDeliveryFailed) || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("expected ErrDeliveryFailed with output, got %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+// Package integrity проверяет зеркало на диске по манифесту.
+package integrity
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"path/filepath"
+	"site-mirror/internal/mediatype"
+	"site-mirror/internal/parser"
+	"site-mirror/internal/storage"
+	"strings"
+)
+
+type Kind string
+
+const (
+	Missing    Kind = "missing"
+	Modified   Kind = "modified"
+	Extra      Kind = "extra"
+	BrokenLink Kind = "broken-link"
+)
+
+type Problem struct {
+	Kind   Kind   `json:"kind"`
+	Path   string `json:"path,omitempty"`
+	URL    string `json:"url,omitempty"`
+	Link   string `json:"link,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func (p Problem) String() string {
+	switch p.Kind {
+	case Missing:
+		return fmt.Sprintf("missing  %s (%s)", p.Path, p.URL)
+	case Modified:
+		return fmt.Sprintf("modified %s (%s): %s", p.Path, p.URL, p.Detail)
+	case Extra:
+		return fmt.Sprintf("extra    %s", p.Path)
+	default:
+		return fmt.Sprintf("broken   %s -> %s", p.URL, p.Link)
+	}
+}
+
+type Report struct {
+	Files    int       `json:"files"`
+	Links    int       `json:"links"`
+	Problems []Problem `json:"problems"`
+}
+
+// Check сверяет файлы в dir с манифестом: наличие, размер и SHA-256, лишние файлы
+// в каталогах хостов и, с links, ссылки сохранённых HTML-страниц на тот же хост,
+// которых нет в зеркале. Файлы в корне dir (журналы, манифест) и блобы
+// дедупликации не проверяются.
+func Check(dir string, m *storage.Manifest, links bool) (Report, error) {
+	report := Report{Problems: []Problem{}}
+	entries := m.Entries()
+	known := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		known[e.Path] = true
+	}
+
+	for _, e := range entries {
+		report.Files++
+		content, err := storage.ReadEntry(dir, e)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			report.Problems = append(report.Problems, Problem{Kind: Missing, Path: e.Path, URL: e.URL})
+			continue
+		case err != nil:
+			return report, err
+		case int64(len(content)) != e.Size:
+			report.Problems = append(report.Problems, Problem{Kind: Modified, Path: e.Path, URL: e.URL,
+				Detail: fmt.Sprintf("%d bytes, recorded %d", len(content), e.Size)})
+			continue
+		case storage.Checksum(content) != e.SHA256:
+			report.Problems = append(report.Problems, Problem{Kind: Modified, Path: e.Path, URL: e.URL,
+				Detail: "SHA-256 differs"})
+			continue
+		}
+		if links && mediatype.IsHTML(e.ContentType) {
+			n, broken := brokenLinks(m, known, e, content)
+			report.Links += n
+			report.Problems = append(report.Problems, broken...)
+		}
+	}
+
+	extra, err := extraFiles(dir, known)
+	if err != nil {
+		return report, err
+	}
+	report.Problems = append(report.Problems, extra...)
+	return report, nil
+}
+
+// brokenLinks разбирает страницу и ищет цели ссылок в манифесте: по URL или,
+// для ссылок, переписанных rewrite-links, по пути файла.
+func brokenLinks(m *storage.Manifest, known map[string]bool, e storage.ManifestEntry, content []byte) (int, []Problem) {
+	u, err := url.Parse(e.URL)
+	if err != nil {
+		return 0, nil
+	}
+	pages, resources, err := parser.NewParser().ParseHTML(content, u)
+	if err != nil {
+		return 0, nil
+	}
+
+	var problems []Problem
+	seen := make(map[string]bool)
+	for _, link := range append(pages, resources...) {
+		link.Fragment = ""
+		s := link.String()
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		if _, ok := m.Get(s); ok || known[path.Join(link.Host, link.Path)] {
+			continue
+		}
+		problems = append(problems, Problem{Kind: BrokenLink, Path: e.Path, URL: e.URL, Link: s})
+	}
+	return len(seen), problems
+}
+
+func extraFiles(dir string, known map[string]bool) ([]Problem, error) {
+	var extra []Problem
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if rel == storage.BlobDir || rel == storage.SnapshotDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.Contains(rel, "/") && !known[rel] {
+			extra = append(extra, Problem{Kind: Extra, Path: rel})
+		}
+		return nil
+	})
+	return extra, err
+}
@@ -0,0 +1,104 @@
+package integrity
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"site-mirror/internal/storage"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	st := storage.NewStorage(dir)
+	st.Manifest = storage.NewManifest()
+	files := []struct{ url, contentType, body string }{
+		{"https://example.com/", "text/html",
+			`<a href="/docs/a">a</a><a href="/gone">gone</a><a href="docs/local.html">rewritten</a><img src="/logo.png"><a href="https://other.com/">ext</a>`},
+		{"https://example.com/docs/a", "text/html", `<a href="/">home</a>`},
+		{"https://example.com/docs/local", "text/html", `local`},
+		{"https://example.com/logo.png", "image/png", "PNG"},
+		{"https://example.com/style.css", "text/css", "body{}"},
+		{"https://example.com/script.js", "application/javascript", "1"},
+	}
+	for _, f := range files {
+		u, _ := url.Parse(f.url)
+		if err := st.Save(u, []byte(f.body), f.contentType); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write := func(rel, content string) {
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(rel)), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("example.com/style.css", "body{color:red}")
+	write("example.com/script.js", "2")
+	write("example.com/extra.txt", "extra")
+	write(storage.DefaultManifestFile, "[]")
+	if err := os.Remove(filepath.Join(dir, "example.com", "logo.png")); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Check(dir, st.Manifest, true)
+	if err != nil {
+		t.Fatalf("Check returned error: %v", err)
+	}
+	want := []Problem{
+		{Kind: BrokenLink, Path: "example.com/index.html", URL: "https://example.com/", Link: "https://example.com/gone"},
+		{Kind: Missing, Path: "example.com/logo.png", URL: "https://example.com/logo.png"},
+		{Kind: Modified, Path: "example.com/script.js", URL: "https://example.com/script.js", Detail: "SHA-256 differs"},
+		{Kind: Modified, Path: "example.com/style.css", URL: "https://example.com/style.css", Detail: "15 bytes, recorded 6"},
+		{Kind: Extra, Path: "example.com/extra.txt"},
+	}
+	if len(report.Problems) != len(want) {
+		t.Fatalf("got %d problems, want %d: %+v", len(report.Problems), len(want), report.Problems)
+	}
+	for i := range want {
+		if report.Problems[i] != want[i] {
+			t.Errorf("problem %d = %+v, want %+v", i, report.Problems[i], want[i])
+		}
+	}
+	if report.Files != 6 || report.Links != 5 {
+		t.Errorf("checked %d files and %d links, want 6 and 5", report.Files, report.Links)
+	}
+
+	report, err = Check(dir, st.Manifest, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Links != 0 || len(report.Problems) != 4 {
+		t.Errorf("expected no link checks without links, got %+v", report)
+	}
+}
+
+func TestCheck_Dedup(t *testing.T) {
+	dir := t.TempDir()
+	st := storage.NewStorage(dir)
+	st.Manifest = storage.NewManifest()
+	st.Dedup = storage.DedupPointer
+	for _, raw := range []string{"https://example.com/a.png", "https://example.com/b.png"} {
+		u, _ := url.Parse(raw)
+		if err := st.Save(u, []byte("PNG"), "image/png"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Снимки лежат в своём каталоге со своими манифестами.
+	snapshot := filepath.Join(dir, storage.SnapshotDir, "20240301T120000Z", "example.com")
+	if err := os.MkdirAll(snapshot, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(snapshot, "a.png"), []byte("PNG"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Check(dir, st.Manifest, true)
+	if err != nil {
+		t.Fatalf("Check returned error: %v", err)
+	}
+	if report.Files != 2 || len(report.Problems) != 0 {
+		t.Errorf("expected pointers to resolve to the blob without extra files in blobs or snapshots, got %+v", report)
+	}
+}
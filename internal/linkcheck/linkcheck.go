@@ -0,0 +1,268 @@
+// Package linkcheck ищет битые ссылки по событиям обхода без сохранения файлов.
+// Страницы своего хоста скачивает обход, остальные цели ссылок проверяются
+// запросом HEAD после него.
+package linkcheck
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"site-mirror/internal/downloader"
+	"site-mirror/internal/events"
+	"site-mirror/internal/mediatype"
+	"site-mirror/internal/parser"
+	"site-mirror/internal/queue"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Prober выполняет одиночный запрос к цели ссылки, см. downloader.Downloader.Probe.
+type Prober interface {
+	Probe(u *url.URL, method string) (*downloader.Response, error)
+}
+
+// target - итог проверки одного URL без фрагмента.
+type target struct {
+	status    int
+	err       string
+	redirects []string
+	// ids - якоря HTML-страницы, nil - тело не читалось или это не HTML.
+	ids map[string]bool
+	// skipped - URL не проверялся, например запрещён robots.txt.
+	skipped bool
+}
+
+type source struct {
+	url   string
+	links []parser.Link
+}
+
+// Checker собирает ссылки страниц из событий Saved и результаты скачивания
+// страниц из Failed и Skipped. Handle безопасен для вызова из воркеров обхода.
+type Checker struct {
+	// External - проверять ссылки на другие хосты.
+	External bool
+	// Workers - число одновременных проверок в Check.
+	Workers int
+	Logger  *slog.Logger
+
+	host    string
+	pars    *parser.Parser
+	mu      sync.Mutex
+	sources []source
+	targets map[string]*target
+}
+
+func New(start *url.URL) *Checker {
+	return &Checker{
+		External: true,
+		Workers:  1,
+		Logger:   slog.Default(),
+		host:     start.Host,
+		pars:     parser.NewParser(),
+		targets:  make(map[string]*target),
+	}
+}
+
+// Handle принимает событие обхода страниц.
+func (c *Checker) Handle(e events.Event) {
+	if e.Kind != queue.KindPage.String() {
+		return
+	}
+	switch e.Type {
+	case events.Saved:
+		c.page(e)
+	case events.Failed:
+		c.set(e.URL, &target{status: e.Status, err: e.Reason, redirects: e.Redirects})
+	case events.Skipped:
+		if e.Reason == downloader.ErrDisallowed.Error() {
+			c.set(e.URL, &target{skipped: true})
+		}
+	}
+}
+
+func (c *Checker) page(e events.Event) {
+	t := &target{status: e.Status, redirects: e.Redirects}
+	if !mediatype.IsHTML(e.ContentType) {
+		c.set(e.URL, t)
+		return
+	}
+
+	// Относительные ссылки страницы, на которую перенаправили, считаются от её адреса.
+	base, err := url.Parse(e.URL)
+	if len(e.Redirects) > 0 {
+		base, err = url.Parse(e.Redirects[len(e.Redirects)-1])
+	}
+	if err != nil {
+		c.set(e.URL, t)
+		return
+	}
+	links, err := c.pars.ParseLinks(e.Body, base)
+	if err == nil {
+		t.ids, err = c.pars.ParseIDs(e.Body)
+	}
+	if err != nil {
+		c.logger().Warn("parse failed", "url", e.URL, "err", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.targets[e.URL] = t
+	c.sources = append(c.sources, source{url: e.URL, links: links})
+}
+
+func (c *Checker) set(u string, t *target) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.targets[u] = t
+}
+
+// Check проверяет цели ссылок, которых не было в обходе, и возвращает отчёт.
+// Вызывается после завершения обхода.
+func (c *Checker) Check(prober Prober) *Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sort.Slice(c.sources, func(i, j int) bool { return c.sources[i].url < c.sources[j].url })
+	pending := make(map[string]bool)
+	for _, src := range c.sources {
+		for _, l := range src.links {
+			if !c.External && l.URL.Host != c.host {
+				continue
+			}
+			key := withoutFragment(l.URL)
+			if _, known := c.targets[key]; known {
+				continue
+			}
+			// Тело нужно, только чтобы найти якорь на странице другого хоста.
+			pending[key] = pending[key] || l.URL.Fragment != ""
+		}
+	}
+	c.probeAll(prober, pending)
+
+	report := &Report{Targets: len(c.targets)}
+	for _, src := range c.sources {
+		page := Page{URL: src.url}
+		seen := make(map[string]bool)
+		for _, l := range src.links {
+			if !c.External && l.URL.Host != c.host {
+				continue
+			}
+			if seen[l.URL.String()] {
+				continue
+			}
+			seen[l.URL.String()] = true
+			t := c.targets[withoutFragment(l.URL)]
+			if t == nil || t.skipped {
+				continue
+			}
+			page.Links = append(page.Links, Link{
+				URL:       l.URL.String(),
+				Element:   l.Element + "[" + l.Attr + "]",
+				Text:      l.Text,
+				Status:    t.status,
+				Redirects: t.redirects,
+				Error:     t.problem(l.URL.Fragment),
+			})
+		}
+		report.Pages = append(report.Pages, page)
+	}
+	return report
+}
+
+func (c *Checker) probeAll(prober Prober, pending map[string]bool) {
+	keys := make([]string, 0, len(pending))
+	for key := range pending {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	workers := max(c.Workers, 1)
+	jobs := make(chan string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range jobs {
+				t := c.probe(prober, key, pending[key])
+				mu.Lock()
+				c.targets[key] = t
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, key := range keys {
+		jobs <- key
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// probe проверяет URL запросом HEAD, а если сервер его отклонил или нужны
+// якоря страницы - запросом GET.
+func (c *Checker) probe(prober Prober, key string, needBody bool) *target {
+	u, err := url.Parse(key)
+	if err != nil {
+		return &target{err: err.Error()}
+	}
+	method := http.MethodHead
+	if needBody {
+		method = http.MethodGet
+	}
+	resp, err := prober.Probe(u, method)
+	// Многие серверы отвечают на HEAD 403, 404 или 405, хотя GET работает.
+	if method == http.MethodHead && err == nil && resp.StatusCode >= http.StatusBadRequest {
+		c.logger().Debug("HEAD rejected, retrying with GET", "url", key, "status", resp.StatusCode)
+		resp, err = prober.Probe(u, http.MethodGet)
+	}
+
+	t := &target{}
+	if resp != nil {
+		t.status = resp.StatusCode
+		t.redirects = resp.Redirects
+	}
+	if err != nil {
+		t.err = err.Error()
+		return t
+	}
+	if len(resp.Body) > 0 && mediatype.IsHTML(resp.ContentType) {
+		if t.ids, err = c.pars.ParseIDs(resp.Body); err != nil {
+			c.logger().Warn("parse failed", "url", key, "err", err)
+		}
+	}
+	return t
+}
+
+// problem описывает, почему ссылка на цель с фрагментом битая; пустая строка - ссылка рабочая.
+func (t *target) problem(fragment string) string {
+	switch {
+	case t.status >= http.StatusBadRequest:
+		return fmt.Sprintf("%d %s", t.status, http.StatusText(t.status))
+	case t.err != "":
+		return t.err
+	case fragment == "" || strings.EqualFold(fragment, "top") || t.ids == nil:
+		// Пустой фрагмент и #top браузер прокручивает к началу страницы.
+		return ""
+	case !t.ids[fragment]:
+		return "missing anchor #" + fragment
+	}
+	return ""
+}
+
+func (c *Checker) logger() *slog.Logger {
+	if c.Logger == nil {
+		return slog.Default()
+	}
+	return c.Logger
+}
+
+func withoutFragment(u *url.URL) string {
+	v := *u
+	v.Fragment = ""
+	v.RawFragment = ""
+	return v.String()
+}
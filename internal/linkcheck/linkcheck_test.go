@@ -0,0 +1,182 @@
+package linkcheck
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/url"
+	"site-mirror/internal/downloader"
+	"site-mirror/internal/events"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeProber отвечает по таблице и запоминает запросы. HEAD к /head-rejected
+// получает 405, как у серверов без поддержки HEAD.
+type fakeProber struct {
+	mu       sync.Mutex
+	pages    map[string]downloader.Response
+	requests []string
+}
+
+func (f *fakeProber) Probe(u *url.URL, method string) (*downloader.Response, error) {
+	f.mu.Lock()
+	f.requests = append(f.requests, method+" "+u.String())
+	f.mu.Unlock()
+
+	resp, ok := f.pages[u.String()]
+	switch {
+	case !ok:
+		return &downloader.Response{URL: u}, errors.New("connection refused")
+	case method == http.MethodHead && strings.HasSuffix(u.Path, "/head-rejected"):
+		return &downloader.Response{URL: u, StatusCode: http.StatusMethodNotAllowed}, nil
+	case method == http.MethodHead:
+		resp.Body = nil
+	}
+	resp.URL = u
+	return &resp, nil
+}
+
+func page(u, body string) events.Event {
+	return events.Event{Type: events.Saved, Kind: "page", URL: u, Status: http.StatusOK, ContentType: "text/html", Body: []byte(body)}
+}
+
+func TestChecker_Check(t *testing.T) {
+	start, _ := url.Parse("https://example.com/")
+	c := New(start)
+	c.Workers = 2
+
+	c.Handle(page("https://example.com/", `<h2 id="news">News</h2>
+<a href="/docs">Docs</a>
+<a href="/docs#install">Install</a>
+<a href="/docs#missing">Missing anchor</a>
+<a href="#news">News</a>
+<a href="/gone">Gone</a>
+<a href="/private">Private</a>
+<img src="/logo.png">
+<a href="https://other.com/head-rejected">Other</a>
+<a href="https://other.com/guide#intro">Guide</a>
+<a href="https://down.example.org/">Down</a>`))
+	c.Handle(page("https://example.com/docs", `<p id="install">Install</p><a href="/">home</a>`))
+	c.Handle(events.Event{Type: events.Failed, Kind: "page", URL: "https://example.com/gone",
+		Status: http.StatusNotFound, Reason: "too many requests", Redirects: []string{"https://example.com/gone/"}})
+	c.Handle(events.Event{Type: events.Skipped, Kind: "page", URL: "https://example.com/private", Reason: downloader.ErrDisallowed.Error()})
+
+	prober := &fakeProber{pages: map[string]downloader.Response{
+		"https://example.com/logo.png":      {StatusCode: http.StatusOK, ContentType: "image/png"},
+		"https://other.com/head-rejected":   {StatusCode: http.StatusOK, ContentType: "text/html"},
+		"https://other.com/guide":           {StatusCode: http.StatusOK, ContentType: "text/html", Body: []byte(`<h1 id="intro">Intro</h1>`)},
+		"https://example.com/unused-target": {StatusCode: http.StatusOK},
+	}}
+	report := c.Check(prober)
+
+	if len(report.Pages) != 2 || report.Pages[0].URL != "https://example.com/" {
+		t.Fatalf("expected 2 pages sorted by URL, got %+v", report.Pages)
+	}
+	var broken []string
+	for _, l := range report.Pages[0].Broken() {
+		broken = append(broken, l.URL+": "+l.Error)
+	}
+	want := []string{
+		"https://example.com/docs#missing: missing anchor #missing",
+		"https://example.com/gone: 404 Not Found",
+		"https://down.example.org/: connection refused",
+	}
+	if strings.Join(broken, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected broken links:\n%s\nwant:\n%s", strings.Join(broken, "\n"), strings.Join(want, "\n"))
+	}
+	if len(report.Pages[0].Links) != 9 || report.Broken() != 3 {
+		t.Errorf("expected 9 links without the disallowed one and 3 broken, got %d and %d", len(report.Pages[0].Links), report.Broken())
+	}
+
+	wantRequests := map[string]bool{
+		"HEAD https://example.com/logo.png":    true,
+		"HEAD https://other.com/head-rejected": true,
+		"GET https://other.com/head-rejected":  true,
+		"GET https://other.com/guide":          true,
+		"HEAD https://down.example.org/":       true,
+	}
+	if len(prober.requests) != len(wantRequests) {
+		t.Errorf("expected requests %v, got %v", wantRequests, prober.requests)
+	}
+	for _, r := range prober.requests {
+		if !wantRequests[r] {
+			t.Errorf("unexpected request %s", r)
+		}
+	}
+}
+
+func TestChecker_SameHostOnly(t *testing.T) {
+	start, _ := url.Parse("https://example.com/")
+	c := New(start)
+	c.External = false
+	c.Handle(page("https://example.com/", `<a href="https://other.com/">other</a><a href="/">home</a>`))
+
+	prober := &fakeProber{}
+	report := c.Check(prober)
+	if len(prober.requests) != 0 || report.Links() != 1 || report.Broken() != 0 {
+		t.Errorf("expected only the same-host link, got %d requests and %+v", len(prober.requests), report.Pages)
+	}
+}
+
+func testReport() *Report {
+	return &Report{
+		Targets: 3,
+		Pages: []Page{
+			{URL: "https://example.com/", Links: []Link{
+				{URL: "https://example.com/ok", Element: "a[href]", Status: 200},
+				{URL: "https://example.com/old", Element: "a[href]", Text: "Old", Status: 404, Error: "404 Not Found",
+					Redirects: []string{"https://example.com/new"}},
+			}},
+			{URL: "https://example.com/ok", Links: []Link{{URL: "https://example.com/", Element: "a[href]", Status: 200}}},
+		},
+	}
+}
+
+func TestReport_Write(t *testing.T) {
+	var text bytes.Buffer
+	if err := testReport().Write(&text, FormatText); err != nil {
+		t.Fatal(err)
+	}
+	wantText := "https://example.com/\n" +
+		"  a[href] https://example.com/old: 404 Not Found (\"Old\")\n" +
+		"    redirected: https://example.com/new\n" +
+		"2 pages, 3 links to 3 URLs checked, 1 broken\n"
+	if text.String() != wantText {
+		t.Errorf("unexpected text report:\n%s", text.String())
+	}
+
+	var js bytes.Buffer
+	if err := testReport().Write(&js, FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Broken  int    `json:"broken"`
+		Sources []Page `json:"sources"`
+	}
+	if err := json.Unmarshal(js.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Broken != 1 || len(decoded.Sources) != 1 || len(decoded.Sources[0].Links) != 1 {
+		t.Errorf("expected only the broken link in JSON, got %s", js.String())
+	}
+
+	var junit bytes.Buffer
+	if err := testReport().Write(&junit, FormatJUnit); err != nil {
+		t.Fatal(err)
+	}
+	var suites junitSuites
+	if err := xml.Unmarshal(junit.Bytes(), &suites); err != nil {
+		t.Fatal(err)
+	}
+	if suites.Tests != 3 || suites.Failures != 1 || len(suites.Suites) != 2 || suites.Suites[0].Cases[1].Failure == nil {
+		t.Errorf("unexpected JUnit report:\n%s", junit.String())
+	}
+
+	if err := testReport().Write(&text, "html"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("expected ErrUnknownFormat, got %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package linkcheck
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var ErrUnknownFormat = errors.New("unknown report format")
+
+// Форматы отчёта.
+const (
+	FormatText  = "text"
+	FormatJSON  = "json"
+	FormatJUnit = "junit"
+)
+
+// Link - проверенная ссылка страницы. Непустой Error означает, что ссылка битая.
+type Link struct {
+	URL       string   `json:"url"`
+	Element   string   `json:"element"`
+	Text      string   `json:"text,omitempty"`
+	Status    int      `json:"status,omitempty"`
+	Redirects []string `json:"redirects,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// Page - ссылки одной страницы в порядке появления, без повторов.
+type Page struct {
+	URL   string `json:"url"`
+	Links []Link `json:"links"`
+}
+
+// Broken возвращает битые ссылки страницы.
+func (p Page) Broken() []Link {
+	var broken []Link
+	for _, l := range p.Links {
+		if l.Error != "" {
+			broken = append(broken, l)
+		}
+	}
+	return broken
+}
+
+// Report - итог проверки, страницы отсортированы по URL.
+type Report struct {
+	Pages []Page
+	// Targets - число проверенных URL без учёта фрагментов.
+	Targets int
+}
+
+// Links возвращает общее число проверенных ссылок.
+func (r *Report) Links() int {
+	n := 0
+	for _, p := range r.Pages {
+		n += len(p.Links)
+	}
+	return n
+}
+
+// Broken возвращает число битых ссылок.
+func (r *Report) Broken() int {
+	n := 0
+	for _, p := range r.Pages {
+		n += len(p.Broken())
+	}
+	return n
+}
+
+// Write выводит отчёт в формате text, json или junit.
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatText:
+		return r.WriteText(w)
+	case FormatJSON:
+		return r.WriteJSON(w)
+	case FormatJUnit:
+		return r.WriteJUnit(w)
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+}
+
+// WriteText выводит битые ссылки, сгруппированные по страницам.
+func (r *Report) WriteText(w io.Writer) error {
+	var b strings.Builder
+	for _, p := range r.Pages {
+		broken := p.Broken()
+		if len(broken) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "%s\n", p.URL)
+		for _, l := range broken {
+			fmt.Fprintf(&b, "  %s %s: %s", l.Element, l.URL, l.Error)
+			if l.Text != "" {
+				fmt.Fprintf(&b, " (%q)", l.Text)
+			}
+			b.WriteString("\n")
+			if len(l.Redirects) > 0 {
+				fmt.Fprintf(&b, "    redirected: %s\n", strings.Join(l.Redirects, " -> "))
+			}
+		}
+	}
+	fmt.Fprintf(&b, "%d pages, %d links to %d URLs checked, %d broken\n",
+		len(r.Pages), r.Links(), r.Targets, r.Broken())
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON выводит итоги и только страницы с битыми ссылками.
+func (r *Report) WriteJSON(w io.Writer) error {
+	out := struct {
+		Pages   int    `json:"pages"`
+		Links   int    `json:"links"`
+		Targets int    `json:"targets"`
+		Broken  int    `json:"broken"`
+		Sources []Page `json:"sources"`
+	}{Pages: len(r.Pages), Links: r.Links(), Targets: r.Targets, Broken: r.Broken(), Sources: []Page{}}
+	for _, p := range r.Pages {
+		if broken := p.Broken(); len(broken) > 0 {
+			out.Sources = append(out.Sources, Page{URL: p.URL, Links: broken})
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit выводит отчёт JUnit XML для CI: страница - набор тестов, ссылка - тест.
+func (r *Report) WriteJUnit(w io.Writer) error {
+	suites := junitSuites{Name: "site-mirror check", Tests: r.Links(), Failures: r.Broken()}
+	for _, p := range r.Pages {
+		suite := junitSuite{Name: p.URL, Tests: len(p.Links)}
+		for _, l := range p.Links {
+			c := junitCase{Name: l.Element + " " + l.URL, ClassName: p.URL}
+			if l.Error != "" {
+				suite.Failures++
+				text := l.Error
+				if len(l.Redirects) > 0 {
+					text += "\nredirected: " + strings.Join(l.Redirects, " -> ")
+				}
+				c.Failure = &junitFailure{Message: l.Error, Text: text}
+			}
+			suite.Cases = append(suite.Cases, c)
+		}
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,172 @@
+package linkgraph
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"site-mirror/internal/queue"
+	"strconv"
+	"strings"
+)
+
+// Форматы выгрузки графа.
+const (
+	FormatCSV     = "csv"
+	FormatGraphML = "graphml"
+	FormatDOT     = "dot"
+)
+
+// Write выгружает граф в формате csv, graphml или dot.
+func (g *Graph) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatCSV:
+		return g.WriteCSV(w)
+	case FormatGraphML:
+		return g.WriteGraphML(w)
+	case FormatDOT:
+		return g.WriteDOT(w)
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+}
+
+// WriteCSV выгружает список рёбер с заголовком.
+func (g *Graph) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"source", "target", "element", "attribute", "text", "rel"}); err != nil {
+		return err
+	}
+	for _, e := range g.Edges() {
+		if err := cw.Write([]string{e.Source, e.Target, e.Element, e.Attr, e.Text, e.Rel}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   struct {
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+var graphMLKeys = []graphMLKey{
+	{ID: "url", For: "node", Name: "url", Type: "string"},
+	{ID: "kind", For: "node", Name: "kind", Type: "string"},
+	{ID: "depth", For: "node", Name: "depth", Type: "int"},
+	{ID: "status", For: "node", Name: "status", Type: "int"},
+	{ID: "sitemap", For: "node", Name: "sitemap", Type: "boolean"},
+	{ID: "element", For: "edge", Name: "element", Type: "string"},
+	{ID: "attribute", For: "edge", Name: "attribute", Type: "string"},
+	{ID: "text", For: "edge", Name: "text", Type: "string"},
+	{ID: "rel", For: "edge", Name: "rel", Type: "string"},
+}
+
+// WriteGraphML выгружает граф в GraphML. Цели без узла, например на
+// другие хосты, получают узел только с url.
+func (g *Graph) WriteGraphML(w io.Writer) error {
+	out := graphML{XMLNS: "http://graphml.graphdrawing.org/xmlns", Keys: graphMLKeys}
+	out.Graph.EdgeDefault = "directed"
+
+	ids := make(map[string]string)
+	addNode := func(u string, data ...graphMLData) string {
+		v := "n" + strconv.Itoa(len(ids))
+		ids[u] = v
+		data = append([]graphMLData{{Key: "url", Value: u}}, data...)
+		out.Graph.Nodes = append(out.Graph.Nodes, graphMLNode{ID: v, Data: data})
+		return v
+	}
+	id := func(u string) string {
+		if v, ok := ids[u]; ok {
+			return v
+		}
+		return addNode(u)
+	}
+	for _, n := range g.Nodes() {
+		addNode(n.URL,
+			graphMLData{Key: "kind", Value: n.Kind},
+			graphMLData{Key: "depth", Value: strconv.Itoa(n.Depth)},
+			graphMLData{Key: "status", Value: strconv.Itoa(n.Status)},
+			graphMLData{Key: "sitemap", Value: strconv.FormatBool(n.Sitemap)})
+	}
+	for _, e := range g.Edges() {
+		edge := graphMLEdge{Source: id(e.Source), Target: id(e.Target)}
+		data := []graphMLData{
+			{Key: "element", Value: e.Element},
+			{Key: "attribute", Value: e.Attr},
+			{Key: "text", Value: e.Text},
+			{Key: "rel", Value: e.Rel},
+		}
+		for _, d := range data {
+			if d.Value != "" {
+				edge.Data = append(edge.Data, d)
+			}
+		}
+		out.Graph.Edges = append(out.Graph.Edges, edge)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteDOT выгружает граф для Graphviz: ресурсы - прямоугольники, подпись
+// ребра - элемент ссылки.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph links {\n")
+	for _, n := range g.Nodes() {
+		shape := "ellipse"
+		if n.Kind == queue.KindResource.String() {
+			shape = "box"
+		}
+		fmt.Fprintf(&b, "  %s [shape=%s];\n", dotQuote(n.URL), shape)
+	}
+	for _, e := range g.Edges() {
+		fmt.Fprintf(&b, "  %s -> %s [label=%s];\n", dotQuote(e.Source), dotQuote(e.Target), dotQuote(e.Element))
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
@@ -0,0 +1,148 @@
+// Package linkgraph хранит граф ссылок обхода: какие страницы ссылаются на какие
+// страницы и ресурсы, и выгружает его для внешних инструментов.
+package linkgraph
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"site-mirror/internal/fsutil"
+	"sort"
+	"sync"
+)
+
+// DefaultFile - граф ссылок в каталоге вывода.
+const DefaultFile = "link-graph.json"
+
+var ErrUnknownFormat = errors.New("unknown graph format")
+
+// Edge - ссылка со страницы Source на Target, адреса без фрагмента.
+// Element и Attr - где найдена ссылка, у ссылок из CSS Element - css.
+type Edge struct {
+	Source  string `json:"source"`
+	Target  string `json:"target"`
+	Element string `json:"element"`
+	Attr    string `json:"attr,omitempty"`
+	Text    string `json:"text,omitempty"`
+	Rel     string `json:"rel,omitempty"`
+}
+
+// Node - URL, обработанный обходом. Цели ссылок, которые не скачивались,
+// например на другие хосты, узлов не имеют.
+type Node struct {
+	URL    string `json:"url"`
+	Kind   string `json:"kind"`
+	Depth  int    `json:"depth"`
+	Status int    `json:"status,omitempty"`
+	// Sitemap - URL попал в очередь из sitemap.xml.
+	Sitemap bool `json:"sitemap,omitempty"`
+}
+
+// Graph накапливает узлы и рёбра во время обхода. Методы безопасны для
+// вызова из воркеров, у nil-графа ничего не делают.
+type Graph struct {
+	mu      sync.Mutex
+	nodes   map[string]Node
+	sitemap map[string]bool
+	edges   []Edge
+	seen    map[Edge]bool
+}
+
+func New() *Graph {
+	return &Graph{nodes: make(map[string]Node), sitemap: make(map[string]bool), seen: make(map[Edge]bool)}
+}
+
+// AddNode добавляет или заменяет узел; отметка sitemap сохраняется.
+func (g *Graph) AddNode(n Node) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	n.Sitemap = n.Sitemap || g.sitemap[n.URL]
+	g.nodes[n.URL] = n
+}
+
+// MarkSitemap отмечает URL, найденный в sitemap.xml, до или после его обработки.
+func (g *Graph) MarkSitemap(u string) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.sitemap[u] = true
+	if n, ok := g.nodes[u]; ok {
+		n.Sitemap = true
+		g.nodes[u] = n
+	}
+}
+
+// AddEdge добавляет ребро, точные повторы пропускаются.
+func (g *Graph) AddEdge(e Edge) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.seen[e] {
+		return
+	}
+	g.seen[e] = true
+	g.edges = append(g.edges, e)
+}
+
+// Nodes возвращает узлы, упорядоченные по URL.
+func (g *Graph) Nodes() []Node {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	nodes := make([]Node, 0, len(g.nodes))
+	for _, n := range g.nodes {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].URL < nodes[j].URL })
+	return nodes
+}
+
+// Edges возвращает рёбра, упорядоченные по источнику и цели.
+func (g *Graph) Edges() []Edge {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	edges := append([]Edge(nil), g.edges...)
+	sort.SliceStable(edges, func(i, j int) bool {
+		if edges[i].Source != edges[j].Source {
+			return edges[i].Source < edges[j].Source
+		}
+		return edges[i].Target < edges[j].Target
+	})
+	return edges
+}
+
+type file struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+}
+
+// Read читает граф, записанный WriteFile.
+func Read(path string) (*Graph, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f file
+	if err = json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	g := New()
+	for _, n := range f.Nodes {
+		g.AddNode(n)
+	}
+	for _, e := range f.Edges {
+		g.AddEdge(e)
+	}
+	return g, nil
+}
+
+// WriteFile записывает граф в JSON через временный файл.
+func (g *Graph) WriteFile(path string) error {
+	return fsutil.WriteJSON(path, file{Nodes: g.Nodes(), Edges: g.Edges()})
+}
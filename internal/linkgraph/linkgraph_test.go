@@ -0,0 +1,118 @@
+package linkgraph
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testGraph() *Graph {
+	g := New()
+	g.MarkSitemap("https://example.com/orphan")
+	g.AddNode(Node{URL: "https://example.com/", Kind: "page", Depth: 0, Status: 200})
+	g.AddNode(Node{URL: "https://example.com/a", Kind: "page", Depth: 1, Status: 200})
+	g.AddNode(Node{URL: "https://example.com/orphan", Kind: "page", Depth: 1, Status: 200})
+	g.AddNode(Node{URL: "https://example.com/style.css", Kind: "resource", Depth: 1, Status: 200})
+	g.AddNode(Node{URL: "https://example.com/linked", Kind: "page", Depth: 2, Status: 200})
+	g.MarkSitemap("https://example.com/linked")
+
+	g.AddEdge(Edge{Source: "https://example.com/", Target: "https://example.com/a", Element: "a", Attr: "href", Text: `Say "hi"`})
+	g.AddEdge(Edge{Source: "https://example.com/", Target: "https://example.com/a", Element: "a", Attr: "href", Text: `Say "hi"`})
+	g.AddEdge(Edge{Source: "https://example.com/", Target: "https://example.com/style.css", Element: "link", Attr: "href", Rel: "stylesheet"})
+	g.AddEdge(Edge{Source: "https://example.com/a", Target: "https://example.com/style.css", Element: "link", Attr: "href", Rel: "stylesheet"})
+	g.AddEdge(Edge{Source: "https://example.com/a", Target: "https://example.com/linked", Element: "a", Attr: "href"})
+	g.AddEdge(Edge{Source: "https://example.com/a", Target: "https://example.com/a", Element: "a", Attr: "href", Text: "self"})
+	g.AddEdge(Edge{Source: "https://example.com/a", Target: "https://other.com/", Element: "a", Attr: "href", Rel: "nofollow"})
+	return g
+}
+
+func TestGraph_Stats(t *testing.T) {
+	s := testGraph().Stats(2)
+
+	if s.Nodes != 5 || s.Edges != 6 {
+		t.Errorf("expected 5 nodes and 6 edges without the repeated one, got %d and %d", s.Nodes, s.Edges)
+	}
+	if len(s.InDegree) != 2 || s.InDegree[0] != (Degree{URL: "https://example.com/style.css", In: 2}) {
+		t.Errorf("expected style.css first with 2 sources, got %+v", s.InDegree)
+	}
+	if len(s.Orphans) != 1 || s.Orphans[0] != "https://example.com/orphan" {
+		t.Errorf("expected only /orphan as orphan, got %v", s.Orphans)
+	}
+	if s.ByDepth[0] != 1 || s.ByDepth[1] != 2 || s.ByDepth[2] != 1 {
+		t.Errorf("unexpected pages by depth %v", s.ByDepth)
+	}
+
+	var text bytes.Buffer
+	if err := s.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text.String(), "Orphan pages (only in sitemap): 1\n  https://example.com/orphan\n") {
+		t.Errorf("unexpected stats text:\n%s", text.String())
+	}
+}
+
+func TestGraph_Write(t *testing.T) {
+	g := testGraph()
+
+	var buf bytes.Buffer
+	if err := g.Write(&buf, FormatCSV); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 7 || rows[0][0] != "source" || rows[1][4] != `Say "hi"` {
+		t.Errorf("unexpected CSV rows %q", rows)
+	}
+
+	buf.Reset()
+	if err = g.Write(&buf, FormatGraphML); err != nil {
+		t.Fatal(err)
+	}
+	var doc graphML
+	if err = xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid GraphML: %v\n%s", err, buf.String())
+	}
+	// Внешняя цель получает узел без данных обхода.
+	if len(doc.Graph.Nodes) != 6 || len(doc.Graph.Edges) != 6 || len(doc.Graph.Nodes[5].Data) != 1 {
+		t.Errorf("unexpected GraphML:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err = g.Write(&buf, FormatDOT); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"digraph links {\n",
+		`  "https://example.com/style.css" [shape=box];`,
+		`  "https://example.com/" -> "https://example.com/a" [label="a"];`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected %q in DOT:\n%s", want, buf.String())
+		}
+	}
+
+	if err = g.Write(&buf, "svg"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("expected ErrUnknownFormat, got %v", err)
+	}
+}
+
+func TestGraph_WriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultFile)
+	g := testGraph()
+	if err := g.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Nodes()) != len(g.Nodes()) || len(read.Edges()) != len(g.Edges()) || !read.Nodes()[3].Sitemap {
+		t.Errorf("graph changed after round trip: %+v", read.Nodes())
+	}
+}
@@ -0,0 +1,102 @@
+package linkgraph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"site-mirror/internal/queue"
+	"sort"
+	"strings"
+)
+
+// Degree - число страниц, ссылающихся на URL.
+type Degree struct {
+	URL string `json:"url"`
+	In  int    `json:"in"`
+}
+
+// Stats - сводка по графу.
+type Stats struct {
+	Nodes int `json:"nodes"`
+	Edges int `json:"edges"`
+	// InDegree - цели с наибольшим числом ссылающихся страниц, по убыванию.
+	InDegree []Degree `json:"in_degree"`
+	// Orphans - страницы из sitemap.xml, на которые не ссылается ни одна другая страница.
+	Orphans []string `json:"orphans"`
+	// ByDepth - число страниц на каждой глубине обхода.
+	ByDepth map[int]int `json:"by_depth"`
+}
+
+// Stats считает сводку, в InDegree попадают top целей.
+func (g *Graph) Stats(top int) Stats {
+	nodes, edges := g.Nodes(), g.Edges()
+	s := Stats{Nodes: len(nodes), Edges: len(edges), InDegree: []Degree{}, Orphans: []string{}, ByDepth: make(map[int]int)}
+
+	// Ссылки страницы на саму себя и повторные ссылки с одной страницы не считаются.
+	sources := make(map[string]map[string]bool)
+	for _, e := range edges {
+		if e.Source == e.Target {
+			continue
+		}
+		if sources[e.Target] == nil {
+			sources[e.Target] = make(map[string]bool)
+		}
+		sources[e.Target][e.Source] = true
+	}
+	for target, from := range sources {
+		s.InDegree = append(s.InDegree, Degree{URL: target, In: len(from)})
+	}
+	sort.Slice(s.InDegree, func(i, j int) bool {
+		if s.InDegree[i].In != s.InDegree[j].In {
+			return s.InDegree[i].In > s.InDegree[j].In
+		}
+		return s.InDegree[i].URL < s.InDegree[j].URL
+	})
+	if len(s.InDegree) > top {
+		s.InDegree = s.InDegree[:top]
+	}
+
+	for _, n := range nodes {
+		if n.Kind != queue.KindPage.String() {
+			continue
+		}
+		s.ByDepth[n.Depth]++
+		if n.Sitemap && len(sources[n.URL]) == 0 {
+			s.Orphans = append(s.Orphans, n.URL)
+		}
+	}
+	return s
+}
+
+func (s Stats) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+func (s Stats) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d nodes, %d edges\n", s.Nodes, s.Edges)
+
+	b.WriteString("Most linked:\n")
+	for _, d := range s.InDegree {
+		fmt.Fprintf(&b, "  %6d %s\n", d.In, d.URL)
+	}
+
+	fmt.Fprintf(&b, "Orphan pages (only in sitemap): %d\n", len(s.Orphans))
+	for _, u := range s.Orphans {
+		fmt.Fprintf(&b, "  %s\n", u)
+	}
+
+	b.WriteString("Pages by depth:\n")
+	depths := make([]int, 0, len(s.ByDepth))
+	for d := range s.ByDepth {
+		depths = append(depths, d)
+	}
+	sort.Ints(depths)
+	for _, d := range depths {
+		fmt.Fprintf(&b, "  %-6d %d\n", d, s.ByDepth[d])
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
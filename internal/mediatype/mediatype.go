@@ -0,0 +1,24 @@
+// Package mediatype разбирает заголовок Content-Type.
+package mediatype
+
+import (
+	"mime"
+	"strings"
+)
+
+// Of возвращает тип содержимого без параметров в нижнем регистре, например
+// text/html для "text/html; charset=utf-8". Неразборчивый заголовок
+// обрезается по первой точке с запятой.
+func Of(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	}
+	return mt
+}
+
+// IsHTML сообщает, HTML ли содержимое, включая XHTML.
+func IsHTML(contentType string) bool {
+	mt := Of(contentType)
+	return mt == "text/html" || mt == "application/xhtml+xml"
+}
@@ -0,0 +1,20 @@
+package mediatype
+
+import "testing"
+
+func TestOf(t *testing.T) {
+	tests := map[string]string{
+		"text/html; charset=utf-8": "text/html",
+		"Text/CSS":                 "text/css",
+		"text/html; charset":       "text/html",
+		"":                         "",
+	}
+	for in, want := range tests {
+		if got := Of(in); got != want {
+			t.Errorf("Of(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if !IsHTML("application/xhtml+xml") || IsHTML("text/plain") {
+		t.Error("IsHTML misdetects types")
+	}
+}
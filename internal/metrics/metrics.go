@@ -0,0 +1,244 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metrics - минимальный интерфейс, через который пакеты сообщают метрики.
+// labels передаются парами ключ-значение.
+type Metrics interface {
+	Add(name string, v float64, labels ...string)
+	Set(name string, v float64, labels ...string)
+	Observe(name string, v float64, labels ...string)
+}
+
+const (
+	RequestsTotal   = "site_mirror_requests_total"
+	RequestDuration = "site_mirror_request_duration_seconds"
+	DownloadedBytes = "site_mirror_downloaded_bytes_total"
+	RetriesTotal    = "site_mirror_retries_total"
+	RobotsDenied    = "site_mirror_robots_denied_total"
+	QueueDepth      = "site_mirror_queue_depth"
+	VisitedURLs     = "site_mirror_visited_urls"
+	ActiveWorkers   = "site_mirror_active_workers"
+	SavedFilesTotal = "site_mirror_saved_files_total"
+	SavedBytesTotal = "site_mirror_saved_bytes_total"
+	SaveErrorsTotal = "site_mirror_save_errors_total"
+	DedupFilesTotal = "site_mirror_dedup_files_total"
+	DedupBytesTotal = "site_mirror_dedup_bytes_total"
+
+	HostConcurrency    = "site_mirror_host_concurrency"
+	ConcurrencyChanges = "site_mirror_concurrency_adjustments_total"
+
+	CircuitState = "site_mirror_circuit_state"
+	ParkedTasks  = "site_mirror_parked_tasks"
+)
+
+const (
+	kindCounter   = "counter"
+	kindGauge     = "gauge"
+	kindHistogram = "histogram"
+)
+
+var DefaultBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+var help = map[string]string{
+	RequestsTotal:   "HTTP requests by response status, including retries.",
+	RequestDuration: "HTTP request latency in seconds.",
+	DownloadedBytes: "Response body bytes downloaded.",
+	RetriesTotal:    "Request retries.",
+	RobotsDenied:    "URLs skipped because robots.txt disallows them.",
+	QueueDepth:      "Tasks waiting in the crawl frontier.",
+	VisitedURLs:     "URLs in the visited set.",
+	ActiveWorkers:   "Workers currently processing a task.",
+	SavedFilesTotal: "Files written by storage.",
+	SavedBytesTotal: "Bytes written by storage.",
+	SaveErrorsTotal: "Storage write errors.",
+	DedupFilesTotal: "Files whose content was already in the blob store.",
+	DedupBytesTotal: "Bytes not written because the blob store already had them.",
+
+	HostConcurrency:    "Adaptive concurrency limit per host.",
+	ConcurrencyChanges: "Adaptive concurrency limit changes by direction.",
+
+	CircuitState: "Circuit breaker state per host: 0 closed, 1 open, 2 half-open, 3 dead.",
+	ParkedTasks:  "Tasks parked while their host circuit is open.",
+}
+
+type Nop struct{}
+
+func (Nop) Add(string, float64, ...string)     {}
+func (Nop) Set(string, float64, ...string)     {}
+func (Nop) Observe(string, float64, ...string) {}
+
+func Inc(m Metrics, name string, labels ...string) {
+	m.Add(name, 1, labels...)
+}
+
+type series struct {
+	labels  string
+	value   float64
+	counts  []uint64
+	sum     float64
+	samples uint64
+}
+
+type family struct {
+	kind   string
+	series map[string]*series
+}
+
+// Registry хранит метрики в памяти и отдаёт их в текстовом формате Prometheus.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+	buckets  []float64
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family), buckets: DefaultBuckets}
+}
+
+func (r *Registry) get(name, kind string, labels []string) *series {
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{kind: kind, series: make(map[string]*series)}
+		r.families[name] = f
+	}
+	key := renderLabels(labels)
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: key}
+		if kind == kindHistogram {
+			s.counts = make([]uint64, len(r.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (r *Registry) Add(name string, v float64, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.get(name, kindCounter, labels).value += v
+}
+
+func (r *Registry) Set(name string, v float64, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.get(name, kindGauge, labels).value = v
+}
+
+func (r *Registry) Observe(name string, v float64, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.get(name, kindHistogram, labels)
+	for i, b := range r.buckets {
+		if v <= b {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.samples++
+}
+
+// Value возвращает значение счётчика или gauge, для гистограммы - число наблюдений.
+func (r *Registry) Value(name string, labels ...string) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, ok := r.families[name]
+	if !ok {
+		return 0
+	}
+	s, ok := f.series[renderLabels(labels)]
+	if !ok {
+		return 0
+	}
+	if f.kind == kindHistogram {
+		return float64(s.samples)
+	}
+	return s.value
+}
+
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		f := r.families[name]
+		if h, ok := help[name]; ok {
+			fmt.Fprintf(&b, "# HELP %s %s\n", name, h)
+		}
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, f.kind)
+
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := f.series[key]
+			if f.kind != kindHistogram {
+				fmt.Fprintf(&b, "%s%s %s\n", name, s.labels, formatFloat(s.value))
+				continue
+			}
+			for i, bound := range r.buckets {
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", name, withLabel(s.labels, "le", formatFloat(bound)), s.counts[i])
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", name, withLabel(s.labels, "le", "+Inf"), s.samples)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", name, s.labels, formatFloat(s.sum))
+			fmt.Fprintf(&b, "%s_count%s %d\n", name, s.labels, s.samples)
+		}
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = r.WriteTo(w)
+}
+
+func renderLabels(labels []string) string {
+	if len(labels) < 2 {
+		return ""
+	}
+	parts := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		parts = append(parts, labels[i]+`="`+escape(labels[i+1])+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func withLabel(rendered, key, value string) string {
+	label := key + `="` + value + `"`
+	if rendered == "" {
+		return "{" + label + "}"
+	}
+	return rendered[:len(rendered)-1] + "," + label + "}"
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
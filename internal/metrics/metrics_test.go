@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRegistry_Counters(t *testing.T) {
+	r := NewRegistry()
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Inc(r, RequestsTotal, "status", "200")
+		}()
+	}
+	wg.Wait()
+	r.Add(RequestsTotal, 2, "status", "404")
+	r.Add(DownloadedBytes, 1024)
+
+	if got := r.Value(RequestsTotal, "status", "200"); got != 50 {
+		t.Errorf("requests{status=200} = %v, want 50", got)
+	}
+	if got := r.Value(RequestsTotal, "status", "404"); got != 2 {
+		t.Errorf("requests{status=404} = %v, want 2", got)
+	}
+	if got := r.Value(DownloadedBytes); got != 1024 {
+		t.Errorf("bytes = %v, want 1024", got)
+	}
+	if got := r.Value("missing"); got != 0 {
+		t.Errorf("missing metric = %v, want 0", got)
+	}
+}
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	Inc(r, RequestsTotal, "status", "200")
+	r.Set(QueueDepth, 7)
+	r.Observe(RequestDuration, 0.25)
+	r.Observe(RequestDuration, 3)
+	r.Set("custom_gauge", 1, "path", `a"b`)
+
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo returned error: %v", err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		"# HELP site_mirror_requests_total ",
+		"# TYPE site_mirror_requests_total counter\n",
+		`site_mirror_requests_total{status="200"} 1` + "\n",
+		"# TYPE site_mirror_queue_depth gauge\n",
+		"site_mirror_queue_depth 7\n",
+		"# TYPE site_mirror_request_duration_seconds histogram\n",
+		`site_mirror_request_duration_seconds_bucket{le="0.05"} 0` + "\n",
+		`site_mirror_request_duration_seconds_bucket{le="0.25"} 1` + "\n",
+		`site_mirror_request_duration_seconds_bucket{le="5"} 2` + "\n",
+		`site_mirror_request_duration_seconds_bucket{le="+Inf"} 2` + "\n",
+		"site_mirror_request_duration_seconds_sum 3.25\n",
+		"site_mirror_request_duration_seconds_count 2\n",
+		`custom_gauge{path="a\"b"} 1` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "# HELP custom_gauge") {
+		t.Error("unexpected HELP for unknown metric")
+	}
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	r := NewRegistry()
+	r.Set(ActiveWorkers, 3)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("unexpected content type %q", rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), "site_mirror_active_workers 3") {
+		t.Errorf("unexpected body %q", rec.Body.String())
+	}
+}
+
+func TestWithLabel(t *testing.T) {
+	if got := withLabel(`{status="200"}`, "le", "1"); got != `{status="200",le="1"}` {
+		t.Errorf("withLabel = %q", got)
+	}
+	if got := withLabel("", "le", "1"); got != `{le="1"}` {
+		t.Errorf("withLabel = %q", got)
+	}
+}
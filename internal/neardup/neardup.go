@@ -0,0 +1,165 @@
+package neardup
+
+import (
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"math/bits"
+	"os"
+	"site-mirror/internal/fsutil"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// DefaultFile - отчёт о почти одинаковых страницах в каталоге вывода.
+const DefaultFile = "near-duplicates.json"
+
+var ErrInvalidThreshold = errors.New("near-duplicate threshold must be between 0 and 1")
+
+// minWords - страницы с меньшим числом слов не сравниваются: у коротких
+// страниц вроде пустых результатов поиска сходство ничего не значит.
+const minWords = 10
+
+// shingle - число подряд идущих слов в одном признаке SimHash.
+const shingle = 3
+
+// Fingerprint возвращает 64-битный SimHash текста по шинглам из трёх слов.
+// Регистр и знаки препинания не учитываются. false - слишком короткий текст.
+func Fingerprint(lines []string) (uint64, bool) {
+	words := strings.FieldsFunc(strings.ToLower(strings.Join(lines, " ")), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) < minWords {
+		return 0, false
+	}
+
+	var weights [64]int
+	for i := 0; i+shingle <= len(words); i++ {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(strings.Join(words[i:i+shingle], " ")))
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+	var fp uint64
+	for bit, w := range weights {
+		if w > 0 {
+			fp |= 1 << bit
+		}
+	}
+	return fp, true
+}
+
+// Similarity - доля совпадающих битов отпечатков, от 0 до 1.
+func Similarity(a, b uint64) float64 {
+	return 1 - float64(bits.OnesCount64(a^b))/64
+}
+
+// Duplicate - страница, почти совпадающая с первой страницей кластера.
+type Duplicate struct {
+	URL        string  `json:"url"`
+	Similarity float64 `json:"similarity"`
+}
+
+// Cluster - первая найденная страница и её почти точные копии.
+type Cluster struct {
+	URL        string      `json:"url"`
+	Duplicates []Duplicate `json:"duplicates"`
+}
+
+type page struct {
+	url string
+	fp  uint64
+}
+
+// Index находит почти одинаковые страницы обхода. Методы безопасны для
+// вызова из нескольких воркеров и для nil.
+type Index struct {
+	threshold float64
+
+	mu       sync.Mutex
+	pages    int
+	firsts   []page
+	clusters map[string][]Duplicate
+}
+
+func NewIndex(threshold float64) (*Index, error) {
+	if threshold <= 0 || threshold > 1 {
+		return nil, ErrInvalidThreshold
+	}
+	return &Index{threshold: threshold, clusters: make(map[string][]Duplicate)}, nil
+}
+
+// Add запоминает страницу и возвращает первую страницу, на которую она похожа
+// не меньше чем на порог, если такая есть. Страница сравнивается только с
+// первыми страницами кластеров, копии копий не накапливают расхождение.
+func (x *Index) Add(u string, fp uint64) (Duplicate, bool) {
+	if x == nil {
+		return Duplicate{}, false
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.pages++
+
+	best := Duplicate{}
+	for _, p := range x.firsts {
+		if sim := Similarity(p.fp, fp); sim >= x.threshold && sim > best.Similarity {
+			best = Duplicate{URL: p.url, Similarity: sim}
+		}
+	}
+	if best.URL == "" {
+		x.firsts = append(x.firsts, page{url: u, fp: fp})
+		return Duplicate{}, false
+	}
+	x.clusters[best.URL] = append(x.clusters[best.URL], Duplicate{URL: u, Similarity: best.Similarity})
+	return best, true
+}
+
+// Report возвращает кластеры от больших к меньшим.
+func (x *Index) Report() *Report {
+	if x == nil {
+		return nil
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	r := &Report{Threshold: x.threshold, Pages: x.pages, Clusters: []Cluster{}}
+	for u, dups := range x.clusters {
+		c := Cluster{URL: u, Duplicates: append([]Duplicate(nil), dups...)}
+		sort.Slice(c.Duplicates, func(i, j int) bool { return c.Duplicates[i].URL < c.Duplicates[j].URL })
+		r.Clusters = append(r.Clusters, c)
+		r.Duplicates += len(dups)
+	}
+	sort.Slice(r.Clusters, func(i, j int) bool {
+		if len(r.Clusters[i].Duplicates) != len(r.Clusters[j].Duplicates) {
+			return len(r.Clusters[i].Duplicates) > len(r.Clusters[j].Duplicates)
+		}
+		return r.Clusters[i].URL < r.Clusters[j].URL
+	})
+	return r
+}
+
+// Read читает отчёт, записанный обходом.
+func Read(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &Report{}
+	if err = json.Unmarshal(data, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// WriteFile записывает отчёт в JSON через временный файл.
+func (r *Report) WriteFile(path string) error {
+	return fsutil.WriteJSON(path, r)
+}
@@ -0,0 +1,79 @@
+package neardup
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const article = "The committee published the new rules for banks on Monday. " +
+	"Banks must report large transfers within three days and keep records for five years. " +
+	"The rules take effect next year after a public consultation."
+
+func TestFingerprint(t *testing.T) {
+	a, ok := Fingerprint([]string{article})
+	if !ok {
+		t.Fatal("expected fingerprint of the article")
+	}
+	printable, _ := Fingerprint([]string{"Print version", article})
+	other, _ := Fingerprint([]string{"Weather today: sunny in the morning, rain expected in the evening across the north of the country."})
+
+	if sim := Similarity(a, printable); sim < 0.85 {
+		t.Errorf("expected printer-friendly variant to be similar, got %.2f", sim)
+	}
+	if sim := Similarity(a, other); sim > 0.8 {
+		t.Errorf("expected different text to differ, got %.2f", sim)
+	}
+	if _, ok = Fingerprint([]string{"No results"}); ok {
+		t.Error("expected no fingerprint for a short page")
+	}
+}
+
+func TestIndex(t *testing.T) {
+	if _, err := NewIndex(1.5); !errors.Is(err, ErrInvalidThreshold) {
+		t.Errorf("expected ErrInvalidThreshold, got %v", err)
+	}
+	x, err := NewIndex(0.9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp, _ := Fingerprint([]string{article})
+	other, _ := Fingerprint([]string{"Weather today: sunny in the morning, rain expected in the evening across the north of the country."})
+
+	if _, found := x.Add("https://example.com/rules", fp); found {
+		t.Error("first page can't be a duplicate")
+	}
+	x.Add("https://example.com/weather", other)
+	for _, u := range []string{"https://example.com/rules?print=1", "https://example.com/rules?sid=42"} {
+		if dup, found := x.Add(u, fp); !found || dup.URL != "https://example.com/rules" || dup.Similarity != 1 {
+			t.Errorf("expected %s to duplicate /rules, got %+v %v", u, dup, found)
+		}
+	}
+
+	r := x.Report()
+	if r.Pages != 4 || r.Duplicates != 2 || len(r.Clusters) != 1 || len(r.Clusters[0].Duplicates) != 2 {
+		t.Errorf("unexpected report %+v", r)
+	}
+	path := filepath.Join(t.TempDir(), DefaultFile)
+	if err = r.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = read.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "2 near-duplicates of 4 pages in 1 clusters (similarity >= 0.90)\nhttps://example.com/rules\n  1.00 https://example.com/rules?print=1\n") {
+		t.Errorf("unexpected report text:\n%s", buf.String())
+	}
+
+	var nilIndex *Index
+	if _, found := nilIndex.Add("https://example.com/", fp); found || nilIndex.Report() != nil {
+		t.Error("nil index must do nothing")
+	}
+}
@@ -0,0 +1,37 @@
+package neardup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Report - кластеры почти одинаковых страниц обхода.
+type Report struct {
+	Threshold float64 `json:"threshold"`
+	// Pages - страницы с отпечатком, короткие страницы не считаются.
+	Pages      int       `json:"pages"`
+	Duplicates int       `json:"duplicates"`
+	Clusters   []Cluster `json:"clusters"`
+}
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func (r *Report) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d near-duplicates of %d pages in %d clusters (similarity >= %.2f)\n",
+		r.Duplicates, r.Pages, len(r.Clusters), r.Threshold)
+	for _, c := range r.Clusters {
+		fmt.Fprintf(&b, "%s\n", c.URL)
+		for _, d := range c.Duplicates {
+			fmt.Fprintf(&b, "  %.2f %s\n", d.Similarity, d.URL)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,484 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"site-mirror/internal/adaptive"
+	"site-mirror/internal/config"
+	"site-mirror/internal/control"
+	"site-mirror/internal/eventlog"
+	"site-mirror/internal/events"
+	"site-mirror/internal/logging"
+	"site-mirror/internal/neardup"
+	"site-mirror/internal/queue"
+	"site-mirror/internal/ratelimit"
+	"site-mirror/internal/storage"
+	"site-mirror/internal/transform"
+	"site-mirror/internal/units"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrInvalidMIMEBudget = errors.New("invalid MIME budget")
+	ErrUnknownFormat     = errors.New("unknown output format")
+	ErrUnexpectedArgs    = errors.New("unexpected arguments")
+	ErrInvalidHookURL    = errors.New("hook URL must be an absolute http(s) URL")
+)
+
+// Флаги, которые управляют самой загрузкой конфигурации и не задаются в файле.
+var metaFlags = map[string]bool{"config": true, "profile": true, "format": true}
+
+// rawArgs - значения флагов, которые разбираются после объединения всех источников.
+type rawArgs struct {
+	url, bandwidth, schedule, maxBytes, mimeBytes, patterns string
+	hookEvents, dedup                                       string
+	configFile, profile                                     string
+}
+
+func newFlagSet(name, usage string, cfg *config.Config, raw *rawArgs) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	if usage != "" {
+		fs.Usage = func() {
+			_, _ = fmt.Fprint(fs.Output(), usage)
+			fs.PrintDefaults()
+		}
+	}
+	fs.StringVar(&raw.configFile, "config", "", "Config file: .yaml, .toml or .json (env "+config.EnvName("config")+")")
+	fs.StringVar(&raw.profile, "profile", "", "Profile from the config file (env "+config.EnvName("profile")+")")
+	fs.StringVar(&raw.url, "url", "", "Start Url")
+	fs.IntVar(&cfg.Depth, "depth", 5, "Depth")
+	fs.StringVar(&cfg.OutputDir, "out", "./", "Output Directory")
+	fs.IntVar(&cfg.Concurrency, "concurrency", 5, "Max concurrency download")
+	fs.BoolVar(&cfg.UseRobots, "robots", false, "Use Robot API")
+	fs.Float64Var(&cfg.RateLimit, "rate", 0, "Max requests per second for all workers (0 - unlimited)")
+	fs.StringVar(&raw.bandwidth, "bandwidth", "0", "Max bandwidth for all workers, e.g. 512KB (0 - unlimited)")
+	fs.StringVar(&raw.schedule, "rate-schedule", "", "Time-of-day limits, e.g. 09:00-18:00=2/256KB,22:00-06:00=0/0")
+	fs.IntVar(&cfg.MaxPages, "max-pages", 0, "Stop admitting pages to the queue after this many, failed ones included (0 - unlimited)")
+	fs.StringVar(&raw.maxBytes, "max-bytes", "0", "Stop after downloading this many bytes, e.g. 1GB (0 - unlimited)")
+	fs.StringVar(&raw.mimeBytes, "max-mime-bytes", "", "Bytes budget per MIME type, e.g. image/*=100MB,text/html=10MB")
+	fs.DurationVar(&cfg.MaxDuration, "max-duration", 0, "Stop crawl after this wall-clock duration, e.g. 30m (0 - unlimited)")
+	fs.StringVar(&cfg.CrawlOrder, "order", queue.OrderBFS, "Crawl order: bfs, dfs or priority")
+	fs.StringVar(&raw.patterns, "priority-patterns", "", "URL regexp weights for priority order, e.g. /docs/=10,/tag/=-5")
+	fs.BoolVar(&cfg.ResourcesFirst, "resources-first", false, "Prefer resources over pages in priority order")
+	fs.BoolVar(&cfg.UseSitemap, "sitemap", false, "Seed crawl from /sitemap.xml, its <priority> feeds priority order")
+	fs.IntVar(&cfg.PageConcurrency, "page-concurrency", 0, "Max concurrent page downloads (0 - up to -concurrency)")
+	fs.IntVar(&cfg.ResourceConcurrency, "resource-concurrency", 0, "Max concurrent resource downloads (0 - up to -concurrency)")
+	fs.BoolVar(&cfg.Adaptive, "adaptive", false, "Adjust concurrency per host by latency and errors (AIMD), starting from -concurrency")
+	fs.IntVar(&cfg.MinConcurrency, "min-concurrency", 1, "Min concurrent requests per host with -adaptive")
+	fs.IntVar(&cfg.MaxConcurrency, "max-concurrency", 20, "Max concurrent requests per host with -adaptive")
+	fs.IntVar(&cfg.BreakerThreshold, "breaker-threshold", 5, "Consecutive failures before a host's circuit opens (0 - disabled)")
+	fs.DurationVar(&cfg.BreakerCooldown, "breaker-cooldown", 30*time.Second, "Pause before probing a failed host, doubled after each failed probe")
+	fs.IntVar(&cfg.BreakerProbes, "breaker-probes", 3, "Failed probes before a host's parked tasks are reported as failed")
+	fs.Var((*RegexpList)(&cfg.PageFilter.Include), "page-include", "Only crawl pages matching regexp (repeatable)")
+	fs.Var((*RegexpList)(&cfg.PageFilter.Exclude), "page-exclude", "Skip pages matching regexp (repeatable)")
+	fs.Var((*RegexpList)(&cfg.ResourceFilter.Include), "resource-include", "Only fetch resources matching regexp (repeatable)")
+	fs.Var((*RegexpList)(&cfg.ResourceFilter.Exclude), "resource-exclude", "Skip resources matching regexp (repeatable)")
+	fs.StringVar(&cfg.LogLevel, "log-level", "info", "Log level: debug, info, warn or error")
+	fs.StringVar(&cfg.LogFormat, "log-format", logging.FormatText, "Log format: text or json")
+	fs.StringVar(&cfg.EventLog, "event-log", eventlog.DefaultFile, "Per-URL JSONL event log, relative to -out (empty - disabled)")
+	fs.StringVar(&cfg.Manifest, "manifest", storage.DefaultManifestFile, "Manifest of saved files with sizes and SHA-256, relative to -out (empty - disabled)")
+	fs.StringVar(&raw.dedup, "dedup", "", "Store identical files once in "+storage.BlobDir+" and link paths to them: hardlink, symlink or pointer (manifest only)")
+	fs.BoolVar(&cfg.Snapshot, "snapshot", false, "Save the run to -out/"+storage.SnapshotDir+"/<UTC time>, sharing unchanged files with earlier snapshots (-dedup hardlink by default)")
+	fs.StringVar(&cfg.LinkGraph, "link-graph", "", "Record the link graph of the crawl to this file, relative to -out (empty - disabled)")
+	fs.Float64Var(&cfg.NearDup, "near-dup", 0, "Report pages whose visible text is at least this similar to an earlier page, e.g. 0.95 (0 - disabled)")
+	fs.BoolVar(&cfg.NearDupSkipLinks, "near-dup-skip-links", false, "Don't follow page links from near-duplicate pages")
+	fs.StringVar(&cfg.NearDupReport, "near-dup-report", neardup.DefaultFile, "Clusters of near-duplicate pages with -near-dup, relative to -out (empty - disabled)")
+	fs.BoolVar(&cfg.Progress, "progress", true, "Show live progress on stderr")
+	fs.StringVar(&cfg.SummaryJSON, "summary-json", "", "Write end-of-run summary as JSON to this file, relative to -out")
+	fs.StringVar(&cfg.HookExec, "hook-exec", "", "Run shell command per crawl event with JSON on stdin, event type in $SITE_MIRROR_EVENT")
+	fs.StringVar(&cfg.HookURL, "hook-url", "", "POST JSON per crawl event to this URL, e.g. http://127.0.0.1:8000/events")
+	fs.StringVar(&raw.hookEvents, "hook-events", "", "Events for -hook-exec and -hook-url, e.g. saved,failed (empty - all)")
+	fs.Var((*transformList)(&cfg.Transforms), "transform", "Transform files before saving: name[,name][@url-regexp] (repeatable), names: "+strings.Join(transform.Names(), ", "))
+	fs.Var((*RegexpList)(&cfg.TrackerPatterns), "tracker-pattern", "Extra script regexp for strip-trackers (repeatable)")
+	fs.StringVar(&cfg.AdminAddr, "admin-addr", "", "Serve /metrics, /healthz and /status on this address, e.g. 127.0.0.1:9090")
+	fs.StringVar(&cfg.ControlAddr, "control-addr", "", "Serve control API on loopback address or unix:/path, e.g. "+control.DefaultAddr)
+	fs.StringVar(&cfg.ControlTokenFile, "control-token-file", control.DefaultTokenFile, "File for the control API token (mode 0600), relative to -out")
+	fs.StringVar(&cfg.CheckpointFile, "checkpoint", queue.DefaultCheckpointFile, "Checkpoint written on graceful stop, relative to -out")
+	fs.BoolVar(&cfg.Resume, "resume", false, "Continue crawl from -checkpoint instead of -url")
+	return fs
+}
+
+func ParseArgs() (*config.Config, error) {
+	return LoadConfig(os.Args[1:], os.Getenv)
+}
+
+// LoadConfig собирает конфигурацию по возрастанию приоритета: значения по умолчанию,
+// файл -config (с профилем -profile), переменные окружения SITE_MIRROR_*, флаги.
+func LoadConfig(args []string, getenv func(string) string) (*config.Config, error) {
+	return LoadCommand("site-mirror", "", args, getenv)
+}
+
+// LoadCommand - LoadConfig для подкоманды обхода: name и usage задают заголовок справки.
+func LoadCommand(name, usage string, args []string, getenv func(string) string) (*config.Config, error) {
+	return LoadCommandFlags(name, usage, args, getenv, nil)
+}
+
+// LoadCommandFlags - LoadCommand для подкоманды со своими флагами, их добавляет extra.
+func LoadCommandFlags(name, usage string, args []string, getenv func(string) string, extra func(fs *flag.FlagSet)) (*config.Config, error) {
+	cfg, fs, err := load(name, usage, args, getenv, extra)
+	if err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedArgs, strings.Join(fs.Args(), " "))
+	}
+	return cfg, nil
+}
+
+func load(name, usage string, args []string, getenv func(string) string, extra func(fs *flag.FlagSet)) (*config.Config, *flag.FlagSet, error) {
+	// Первый проход только находит файл и профиль, ошибки разбора покажет второй.
+	var probe rawArgs
+	fs := newFlagSet(name, usage, &config.Config{}, &probe)
+	if extra != nil {
+		extra(fs)
+	}
+	fs.SetOutput(io.Discard)
+	_ = fs.Parse(args)
+	var cli []string
+	fs.Visit(func(f *flag.Flag) { cli = append(cli, f.Name) })
+
+	path, profile := probe.configFile, probe.profile
+	if path == "" {
+		path = getenv(config.EnvName("config"))
+	}
+	if profile == "" {
+		profile = getenv(config.EnvName("profile"))
+	}
+
+	cfg := &config.Config{}
+	var raw rawArgs
+	fs = newFlagSet(name, usage, cfg, &raw)
+	if extra != nil {
+		extra(fs)
+	}
+
+	switch {
+	case path != "":
+		if err := applyFile(fs, path, profile); err != nil {
+			return nil, nil, err
+		}
+	case profile != "":
+		return nil, nil, fmt.Errorf("%w %q: no config file given", config.ErrUnknownProfile, profile)
+	}
+	if err := applyEnv(fs, getenv); err != nil {
+		return nil, nil, err
+	}
+	for _, name := range cli {
+		resetList(fs, name)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if err := finish(cfg, &raw); err != nil {
+		return nil, nil, err
+	}
+	return cfg, fs, nil
+}
+
+func applyFile(fs *flag.FlagSet, path, profile string) error {
+	file, err := config.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	settings, err := file.Resolve(profile)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	set := setter(fs)
+	for _, key := range keys {
+		f := fs.Lookup(key)
+		if f == nil || metaFlags[key] {
+			return fmt.Errorf("%w %q in %s", config.ErrUnknownKey, key, path)
+		}
+		values, err := config.FlagValues(settings[key])
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", path, key, err)
+		}
+		// Повторяемые флаги получают элементы списка по одному.
+		switch f.Value.(type) {
+		case *RegexpList, *transformList:
+		default:
+			values = []string{strings.Join(values, ",")}
+		}
+		for _, v := range values {
+			if err = set(key, v); err != nil {
+				return fmt.Errorf("%w: %s: %s: %v", config.ErrInvalidValue, path, key, err)
+			}
+		}
+	}
+	return nil
+}
+
+func applyEnv(fs *flag.FlagSet, getenv func(string) string) error {
+	var err error
+	set := setter(fs)
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || metaFlags[f.Name] {
+			return
+		}
+		name := config.EnvName(f.Name)
+		if v := getenv(name); v != "" {
+			if errSet := set(f.Name, v); errSet != nil {
+				err = fmt.Errorf("%w: %s: %v", config.ErrInvalidValue, name, errSet)
+			}
+		}
+	})
+	return err
+}
+
+// listValue - значение повторяемого флага. Список задаёт целиком один источник:
+// источник с большим приоритетом заменяет значения файла или окружения, а не
+// дописывает к ним.
+type listValue interface {
+	flag.Value
+	Reset()
+}
+
+// setter возвращает fs.Set для одного источника конфигурации: первое значение
+// повторяемого флага из источника сбрасывает список.
+func setter(fs *flag.FlagSet) func(name, value string) error {
+	seen := make(map[string]bool)
+	return func(name, value string) error {
+		if !seen[name] {
+			seen[name] = true
+			resetList(fs, name)
+		}
+		return fs.Set(name, value)
+	}
+}
+
+func resetList(fs *flag.FlagSet, name string) {
+	if f := fs.Lookup(name); f != nil {
+		if l, ok := f.Value.(listValue); ok {
+			l.Reset()
+		}
+	}
+}
+
+func finish(cfg *config.Config, raw *rawArgs) error {
+	var err error
+	cfg.StartURL, err = url.Parse(raw.url)
+	if err != nil {
+		return err
+	}
+
+	cfg.BandwidthLimit, err = units.ParseBytes(raw.bandwidth)
+	if err != nil {
+		return err
+	}
+
+	cfg.RateSchedule, err = ratelimit.ParseSchedule(raw.schedule)
+	if err != nil {
+		return err
+	}
+
+	cfg.MaxBytes, err = units.ParseBytes(raw.maxBytes)
+	if err != nil {
+		return err
+	}
+
+	cfg.MaxBytesPerMIME, err = parseMIMEBudget(raw.mimeBytes)
+	if err != nil {
+		return err
+	}
+
+	if _, err = queue.NewFrontier(cfg.CrawlOrder, nil); err != nil {
+		return err
+	}
+
+	cfg.PriorityPatterns, err = queue.ParsePatternWeights(raw.patterns)
+	if err != nil {
+		return err
+	}
+
+	if _, err = logging.New(io.Discard, cfg.LogLevel, cfg.LogFormat); err != nil {
+		return err
+	}
+
+	if cfg.Adaptive {
+		bounds := adaptive.Config{Min: cfg.MinConcurrency, Max: cfg.MaxConcurrency}
+		if err = bounds.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if cfg.ControlAddr != "" {
+		if err = control.ValidateAddr(cfg.ControlAddr); err != nil {
+			return err
+		}
+	}
+
+	cfg.Dedup, err = storage.ParseDedup(raw.dedup)
+	if err != nil {
+		return err
+	}
+
+	cfg.HookEvents, err = events.ParseTypes(raw.hookEvents)
+	if err != nil {
+		return err
+	}
+	if cfg.HookURL != "" {
+		if err = CheckHookURL(cfg.HookURL); err != nil {
+			return err
+		}
+	}
+
+	return cfg.Validate()
+}
+
+// CheckHookURL проверяет адрес webhook: абсолютный URL http или https.
+func CheckHookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("%w: %q", ErrInvalidHookURL, raw)
+	}
+	return nil
+}
+
+// PrintConfig выводит итоговую конфигурацию после объединения всех источников
+// в формате -format (yaml, json или toml). Вывод годится как файл для -config.
+func PrintConfig(w io.Writer, usage string, args []string, getenv func(string) string) error {
+	var format string
+	_, fs, err := load("config print", usage, args, getenv, func(fs *flag.FlagSet) {
+		fs.StringVar(&format, "format", "yaml", "Output format: yaml, json or toml")
+	})
+	if err != nil {
+		return err
+	}
+
+	settings := make(map[string]any)
+	fs.VisitAll(func(f *flag.Flag) {
+		if metaFlags[f.Name] {
+			return
+		}
+		v := f.Value.(flag.Getter).Get()
+		if d, ok := v.(time.Duration); ok {
+			v = d.String()
+		}
+		settings[f.Name] = v
+	})
+
+	switch format {
+	case "yaml":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err = enc.Encode(settings); err != nil {
+			return err
+		}
+		return enc.Close()
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(settings)
+	case "toml":
+		return toml.NewEncoder(w).Encode(settings)
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+}
+
+// RegexpList - значения повторяемого флага с регулярными выражениями, например
+// fs.Var((*parser.RegexpList)(&patterns), ...). Как и у флагов обхода, список из
+// источника с большим приоритетом заменяет списки из файла и окружения.
+type RegexpList []*regexp.Regexp
+
+func (l *RegexpList) String() string {
+	if l == nil {
+		return ""
+	}
+	parts := make([]string, len(*l))
+	for i, re := range *l {
+		parts[i] = re.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l *RegexpList) Set(s string) error {
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, re)
+	return nil
+}
+
+func (l *RegexpList) Reset() {
+	*l = nil
+}
+
+func (l *RegexpList) Get() any {
+	patterns := make([]string, 0, len(*l))
+	for _, re := range *l {
+		patterns = append(patterns, re.String())
+	}
+	return patterns
+}
+
+// transformList - значения повторяемого флага -transform.
+type transformList []transform.Spec
+
+func (l *transformList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(l.Get().([]string), " ")
+}
+
+func (l *transformList) Set(s string) error {
+	spec, err := transform.ParseSpec(s)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, spec)
+	return nil
+}
+
+func (l *transformList) Reset() {
+	*l = nil
+}
+
+func (l *transformList) Get() any {
+	specs := make([]string, 0, len(*l))
+	for _, spec := range *l {
+		specs = append(specs, spec.String())
+	}
+	return specs
+}
+
+func parseMIMEBudget(s string) (map[string]int64, error) {
+	budget := make(map[string]int64)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		mimeType, sizeRaw, ok := strings.Cut(part, "=")
+		if !ok || !strings.Contains(mimeType, "/") {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidMIMEBudget, part)
+		}
+		size, err := units.ParseBytes(sizeRaw)
+		if err != nil {
+			return nil, err
+		}
+		budget[strings.ToLower(strings.TrimSpace(mimeType))] = size
+	}
+	return budget, nil
+}
@@ -0,0 +1,220 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"site-mirror/internal/config"
+	"testing"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "mirror.yaml")
+	content := `url: https://example.com
+depth: 2
+concurrency: 3
+out: ` + dir + `
+max-mime-bytes:
+  image/*: 10MB
+page-exclude: [/private/, /tmp/]
+transform: [rewrite-links, banner@/blog/]
+profiles:
+  fast:
+    concurrency: 20
+    rate: 5
+`
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bad := filepath.Join(dir, "bad.toml")
+	if err := os.WriteFile(bad, []byte("depht = 3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		wantErr error
+		checks  func(t *testing.T, cfg *config.Config)
+	}{
+		{
+			name: "file values",
+			args: []string{"-config", file},
+			checks: func(t *testing.T, cfg *config.Config) {
+				if cfg.StartURL.Host != "example.com" || cfg.Depth != 2 || cfg.Concurrency != 3 {
+					t.Errorf("unexpected file values %v/%d/%d", cfg.StartURL, cfg.Depth, cfg.Concurrency)
+				}
+				if cfg.MaxBytesPerMIME["image/*"] != 10<<20 || len(cfg.PageFilter.Exclude) != 2 {
+					t.Errorf("unexpected table and list values %v/%v", cfg.MaxBytesPerMIME, cfg.PageFilter.Exclude)
+				}
+				if len(cfg.Transforms) != 2 || cfg.Transforms[1].String() != "banner@/blog/" {
+					t.Errorf("unexpected transforms %v", cfg.Transforms)
+				}
+			},
+		},
+		{
+			name: "profile over file",
+			args: []string{"-config", file, "-profile", "fast"},
+			checks: func(t *testing.T, cfg *config.Config) {
+				if cfg.Concurrency != 20 || cfg.RateLimit != 5 || cfg.Depth != 2 {
+					t.Errorf("unexpected profile values %d/%v/%d", cfg.Concurrency, cfg.RateLimit, cfg.Depth)
+				}
+			},
+		},
+		{
+			name: "env over profile, flags over env",
+			args: []string{"-depth", "4"},
+			env: map[string]string{
+				"SITE_MIRROR_CONFIG":      file,
+				"SITE_MIRROR_PROFILE":     "fast",
+				"SITE_MIRROR_CONCURRENCY": "7",
+				"SITE_MIRROR_DEPTH":       "9",
+			},
+			checks: func(t *testing.T, cfg *config.Config) {
+				if cfg.Concurrency != 7 || cfg.Depth != 4 || cfg.RateLimit != 5 {
+					t.Errorf("unexpected precedence %d/%d/%v", cfg.Concurrency, cfg.Depth, cfg.RateLimit)
+				}
+			},
+		},
+		{
+			name: "lists replaced by higher-priority source",
+			args: []string{"-page-exclude", "/cli-1/", "-page-exclude", "/cli-2/"},
+			env: map[string]string{
+				"SITE_MIRROR_CONFIG":       file,
+				"SITE_MIRROR_PAGE_EXCLUDE": "/env/",
+				"SITE_MIRROR_TRANSFORM":    "strip-trackers",
+			},
+			checks: func(t *testing.T, cfg *config.Config) {
+				if got := (*RegexpList)(&cfg.PageFilter.Exclude).String(); got != "/cli-1/,/cli-2/" {
+					t.Errorf("expected page-exclude from flags only, got %s", got)
+				}
+				if len(cfg.Transforms) != 1 || cfg.Transforms[0].String() != "strip-trackers" {
+					t.Errorf("expected transforms from env only, got %v", cfg.Transforms)
+				}
+			},
+		},
+		{
+			name:    "unknown key",
+			args:    []string{"-config", bad},
+			wantErr: config.ErrUnknownKey,
+		},
+		{
+			name:    "unknown profile",
+			args:    []string{"-config", file, "-profile", "slow"},
+			wantErr: config.ErrUnknownProfile,
+		},
+		{
+			name:    "profile without file",
+			args:    []string{"-url", "https://example.com", "-profile", "fast"},
+			wantErr: config.ErrUnknownProfile,
+		},
+		{
+			name:    "invalid env value",
+			args:    []string{"-url", "https://example.com"},
+			env:     map[string]string{"SITE_MIRROR_DEPTH": "deep"},
+			wantErr: config.ErrInvalidValue,
+		},
+		{
+			name:    "unknown transformer",
+			args:    []string{"-url", "https://example.com"},
+			env:     map[string]string{"SITE_MIRROR_TRANSFORM": "minify"},
+			wantErr: config.ErrInvalidValue,
+		},
+		{
+			name:    "negative depth",
+			args:    []string{"-config", file, "-depth", "-1"},
+			wantErr: config.ErrInvalidConfig,
+		},
+		{
+			name:    "positional arguments",
+			args:    []string{"-url", "https://example.com", "extra"},
+			wantErr: ErrUnexpectedArgs,
+		},
+		{
+			name:    "missing URL",
+			args:    []string{"-depth", "1"},
+			wantErr: config.ErrInvalidConfig,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadConfig(tt.args, env(tt.env))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig returned error: %v", err)
+			}
+			tt.checks(t, cfg)
+		})
+	}
+}
+
+func TestPrintConfig(t *testing.T) {
+	dir := t.TempDir()
+	args := []string{"-url", "https://example.com", "-out", dir, "-max-duration", "30m", "-page-exclude", "/private/"}
+
+	var buf bytes.Buffer
+	if err := PrintConfig(&buf, "", append([]string{"-format", "json"}, args...), env(nil)); err != nil {
+		t.Fatalf("PrintConfig returned error: %v", err)
+	}
+	var printed map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &printed); err != nil {
+		t.Fatalf("invalid JSON output: %v", err)
+	}
+	if printed["url"] != "https://example.com" || printed["max-duration"] != "30m0s" || printed["depth"] != float64(5) {
+		t.Errorf("unexpected printed config %v", printed)
+	}
+	if _, ok := printed["format"]; ok {
+		t.Error("meta flags should not be printed")
+	}
+
+	// Напечатанная конфигурация читается обратно как файл.
+	for _, format := range []string{"yaml", "toml", "json"} {
+		buf.Reset()
+		if err := PrintConfig(&buf, "", append([]string{"-format", format}, args...), env(nil)); err != nil {
+			t.Fatalf("%s: PrintConfig returned error: %v", format, err)
+		}
+		file := filepath.Join(dir, "printed."+format)
+		if err := os.WriteFile(file, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := LoadConfig([]string{"-config", file}, env(nil))
+		if err != nil {
+			t.Fatalf("%s: printed config does not load: %v", format, err)
+		}
+		if cfg.MaxDuration.String() != "30m0s" || len(cfg.PageFilter.Exclude) != 1 {
+			t.Errorf("%s: unexpected round trip %v/%v", format, cfg.MaxDuration, cfg.PageFilter.Exclude)
+		}
+	}
+
+	if err := PrintConfig(&buf, "", append([]string{"-format", "xml"}, args...), env(nil)); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("expected ErrUnknownFormat, got %v", err)
+	}
+}
+
+func TestCheckHookURL(t *testing.T) {
+	for raw, wantErr := range map[string]bool{
+		"http://127.0.0.1:8000/events": false,
+		"https://hooks.example.com/x":  false,
+		"localhost:8000":               true,
+		"/events":                      true,
+		"ftp://example.com/":           true,
+	} {
+		if err := CheckHookURL(raw); (err != nil) != wantErr || (err != nil && !errors.Is(err, ErrInvalidHookURL)) {
+			t.Errorf("CheckHookURL(%q) error = %v, wantErr %v", raw, err, wantErr)
+		}
+	}
+}
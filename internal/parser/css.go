@@ -0,0 +1,39 @@
+package parser
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	cssURLRe    = regexp.MustCompile(`url\(\s*['"]?([^'")]+?)['"]?\s*\)`)
+	cssImportRe = regexp.MustCompile(`@import\s+['"]([^'"]+)['"]`)
+)
+
+// ParseCSS извлекает ресурсы из url(...) и @import того же хоста.
+func (p *Parser) ParseCSS(content []byte, base *url.URL) (resources []*url.URL) {
+	var refs []string
+	for _, m := range cssImportRe.FindAllSubmatch(content, -1) {
+		refs = append(refs, string(m[1]))
+	}
+	for _, m := range cssURLRe.FindAllSubmatch(content, -1) {
+		refs = append(refs, string(m[1]))
+	}
+
+	for _, ref := range refs {
+		ref = strings.TrimSpace(ref)
+		if ref == "" || strings.HasPrefix(ref, "data:") || strings.HasPrefix(ref, "#") {
+			continue
+		}
+		res, err := url.Parse(ref)
+		if err != nil {
+			continue
+		}
+		absRes := base.ResolveReference(res)
+		if absRes.Host == base.Host {
+			resources = append(resources, absRes)
+		}
+	}
+	return resources
+}
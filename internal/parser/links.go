@@ -0,0 +1,138 @@
+package parser
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Link - ссылка из HTML вместе с местом, где она найдена.
+type Link struct {
+	// URL - абсолютный http(s) адрес, фрагмент сохраняется.
+	URL *url.URL
+	// Element и Attr - элемент и атрибут ссылки, например a и href.
+	Element string
+	Attr    string
+	// Text - текст ссылки у a или alt у area и img.
+	Text string
+	Rel  string
+}
+
+// linkAttrs - атрибуты со ссылками, которые возвращает ParseLinks.
+var linkAttrs = map[string][]string{
+	"a":      {"href"},
+	"area":   {"href"},
+	"link":   {"href"},
+	"script": {"src"},
+	"img":    {"src"},
+	"iframe": {"src"},
+	"source": {"src"},
+	"audio":  {"src"},
+	"video":  {"src", "poster"},
+	"embed":  {"src"},
+	"track":  {"src"},
+}
+
+// ParseLinks возвращает все http(s) ссылки страницы, включая ссылки на другие
+// хосты и якоря, в порядке появления. Учитывается <base href>.
+func (p *Parser) ParseLinks(content []byte, base *url.URL) ([]Link, error) {
+	doc, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	var links []Link
+	var traverse func(*html.Node)
+	traverse = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if n.Data == "base" {
+				if href, ok := attrValue(n, "href"); ok {
+					if u, errParse := url.Parse(strings.TrimSpace(href)); errParse == nil {
+						base = base.ResolveReference(u)
+					}
+				}
+			}
+			for _, key := range linkAttrs[n.Data] {
+				val, ok := attrValue(n, key)
+				if !ok {
+					continue
+				}
+				ref, errParse := url.Parse(strings.TrimSpace(val))
+				if errParse != nil || val == "" {
+					continue
+				}
+				abs := base.ResolveReference(ref)
+				if abs.Scheme != "http" && abs.Scheme != "https" {
+					continue
+				}
+				rel, _ := attrValue(n, "rel")
+				links = append(links, Link{URL: abs, Element: n.Data, Attr: key, Text: linkText(n), Rel: rel})
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			traverse(c)
+		}
+	}
+	traverse(doc)
+	return links, nil
+}
+
+// ParseIDs возвращает якоря страницы: значения id и name у a.
+func (p *Parser) ParseIDs(content []byte) (map[string]bool, error) {
+	doc, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]bool)
+	var traverse func(*html.Node)
+	traverse = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if id, ok := attrValue(n, "id"); ok && id != "" {
+				ids[id] = true
+			}
+			if name, ok := attrValue(n, "name"); ok && name != "" && n.Data == "a" {
+				ids[name] = true
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			traverse(c)
+		}
+	}
+	traverse(doc)
+	return ids, nil
+}
+
+func attrValue(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func linkText(n *html.Node) string {
+	switch n.Data {
+	case "a":
+		var b strings.Builder
+		var collect func(*html.Node)
+		collect = func(n *html.Node) {
+			if n.Type == html.TextNode {
+				b.WriteString(n.Data)
+				b.WriteByte(' ')
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				collect(c)
+			}
+		}
+		collect(n)
+		return strings.Join(strings.Fields(b.String()), " ")
+	case "area", "img":
+		alt, _ := attrValue(n, "alt")
+		return strings.TrimSpace(alt)
+	}
+	return ""
+}
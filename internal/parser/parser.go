@@ -2,9 +2,7 @@ package parser
 
 import (
 	"bytes"
-	"flag"
 	"net/url"
-	"site-mirror/internal/config"
 
 	"golang.org/x/net/html"
 )
@@ -15,12 +13,34 @@ func NewParser() *Parser {
 	return &Parser{}
 }
 
+// Page - разобранная страница: ссылки, как у ParseHTML, и видимый текст, как у TextLines.
+type Page struct {
+	Pages     []*url.URL
+	Resources []*url.URL
+	Text      []string
+}
+
 func (p *Parser) ParseHTML(content []byte, base *url.URL) (pages []*url.URL, resources []*url.URL, err error) {
 	doc, err := html.Parse(bytes.NewReader(content))
 	if err != nil {
 		return nil, nil, err
 	}
+	pages, resources = htmlLinks(doc, base)
+	return pages, resources, nil
+}
+
+// ParsePage - ParseHTML и TextLines без селекторов за один разбор документа.
+func (p *Parser) ParsePage(content []byte, base *url.URL) (*Page, error) {
+	doc, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	page := &Page{Text: textLines(doc, nil)}
+	page.Pages, page.Resources = htmlLinks(doc, base)
+	return page, nil
+}
 
+func htmlLinks(doc *html.Node, base *url.URL) (pages []*url.URL, resources []*url.URL) {
 	var traverse func(*html.Node)
 	traverse = func(n *html.Node) {
 		if n.Type == html.ElementNode {
@@ -72,25 +92,5 @@ func (p *Parser) ParseHTML(content []byte, base *url.URL) (pages []*url.URL, res
 		}
 	}
 	traverse(doc)
-	return pages, resources, nil
-}
-
-func ParseArgs() (*config.Config, error) {
-	cfg := &config.Config{}
-	var err error
-	var urlRaw string
-
-	flag.StringVar(&urlRaw, "url", "", "Start Url")
-	flag.IntVar(&cfg.Depth, "depth", 5, "Depth")
-	flag.StringVar(&cfg.OutputDir, "out", "./", "Output Directory")
-	flag.IntVar(&cfg.Concurrency, "concurrency", 5, "Max concurrency download")
-	flag.BoolVar(&cfg.UseRobots, "robots", false, "Use Robot API")
-	flag.Parse()
-
-	cfg.StartURL, err = url.Parse(urlRaw)
-	if err != nil {
-		return nil, err
-	}
-
-	return cfg, nil
+	return pages, resources
 }
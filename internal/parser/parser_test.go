@@ -1,11 +1,14 @@
 package parser
 
 import (
+	"errors"
 	"flag"
 	"net/url"
 	"os"
 	"site-mirror/internal/config"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParser_ParseHTML(t *testing.T) {
@@ -189,6 +192,15 @@ func TestParseArgs(t *testing.T) {
 				if cfg.UseRobots {
 					t.Error("expected UseRobots to be false by default")
 				}
+				if !cfg.Progress || cfg.SummaryJSON != "" {
+					t.Error("expected progress on and no JSON summary by default")
+				}
+				if cfg.AdminAddr != "" || cfg.ControlAddr != "" {
+					t.Errorf("expected admin and control servers off by default, got %q/%q", cfg.AdminAddr, cfg.ControlAddr)
+				}
+				if cfg.CheckpointFile != "crawl-checkpoint.json" || cfg.Resume {
+					t.Errorf("unexpected checkpoint defaults %q/%v", cfg.CheckpointFile, cfg.Resume)
+				}
 			},
 		},
 		{
@@ -196,6 +208,181 @@ func TestParseArgs(t *testing.T) {
 			args:    []string{"-url", "://invalid-url"},
 			wantErr: true,
 		},
+		{
+			name:    "rate limits",
+			args:    []string{"-url", "https://example.com", "-rate", "2.5", "-bandwidth", "512KB", "-rate-schedule", "09:00-18:00=1/64KB"},
+			wantErr: false,
+			checks: func(t *testing.T, cfg *config.Config) {
+				if cfg.RateLimit != 2.5 {
+					t.Errorf("expected rate 2.5, got %v", cfg.RateLimit)
+				}
+				if cfg.BandwidthLimit != 512<<10 {
+					t.Errorf("expected bandwidth %d, got %d", 512<<10, cfg.BandwidthLimit)
+				}
+				if len(cfg.RateSchedule) != 1 || cfg.RateSchedule[0].BytesPerSec != 64<<10 {
+					t.Errorf("unexpected schedule %+v", cfg.RateSchedule)
+				}
+			},
+		},
+		{
+			name:    "crawl budgets",
+			args:    []string{"-url", "https://example.com", "-max-pages", "100", "-max-bytes", "1GB", "-max-mime-bytes", "image/*=100MB, text/html=10MB", "-max-duration", "30m"},
+			wantErr: false,
+			checks: func(t *testing.T, cfg *config.Config) {
+				if cfg.MaxPages != 100 {
+					t.Errorf("unexpected page budget %d", cfg.MaxPages)
+				}
+				if cfg.MaxBytes != 1<<30 {
+					t.Errorf("expected max bytes %d, got %d", 1<<30, cfg.MaxBytes)
+				}
+				if cfg.MaxBytesPerMIME["image/*"] != 100<<20 || cfg.MaxBytesPerMIME["text/html"] != 10<<20 {
+					t.Errorf("unexpected MIME budget %v", cfg.MaxBytesPerMIME)
+				}
+				if cfg.MaxDuration != 30*time.Minute {
+					t.Errorf("expected max duration 30m, got %v", cfg.MaxDuration)
+				}
+			},
+		},
+		{
+			name:    "crawl order",
+			args:    []string{"-url", "https://example.com", "-order", "priority", "-priority-patterns", "/docs/=10", "-resources-first", "-sitemap"},
+			wantErr: false,
+			checks: func(t *testing.T, cfg *config.Config) {
+				if cfg.CrawlOrder != "priority" {
+					t.Errorf("expected priority order, got %q", cfg.CrawlOrder)
+				}
+				if len(cfg.PriorityPatterns) != 1 || cfg.PriorityPatterns[0].Weight != 10 {
+					t.Errorf("unexpected priority patterns %+v", cfg.PriorityPatterns)
+				}
+				if !cfg.ResourcesFirst || !cfg.UseSitemap {
+					t.Error("expected -resources-first and -sitemap to be set")
+				}
+			},
+		},
+		{
+			name:    "per-kind concurrency and filters",
+			args:    []string{"-url", "https://example.com", "-page-concurrency", "2", "-resource-concurrency", "8", "-page-include", "/docs/", "-page-exclude", "/private/", "-page-exclude", `\?print=`, "-resource-exclude", `\.mp4$`},
+			wantErr: false,
+			checks: func(t *testing.T, cfg *config.Config) {
+				if cfg.PageConcurrency != 2 || cfg.ResourceConcurrency != 8 {
+					t.Errorf("unexpected per-kind concurrency %d/%d", cfg.PageConcurrency, cfg.ResourceConcurrency)
+				}
+				if len(cfg.PageFilter.Include) != 1 || len(cfg.PageFilter.Exclude) != 2 {
+					t.Errorf("unexpected page filter %+v", cfg.PageFilter)
+				}
+				if len(cfg.ResourceFilter.Include) != 0 || len(cfg.ResourceFilter.Exclude) != 1 {
+					t.Errorf("unexpected resource filter %+v", cfg.ResourceFilter)
+				}
+			},
+		},
+		{
+			name:    "logging",
+			args:    []string{"-url", "https://example.com", "-log-level", "debug", "-log-format", "json", "-event-log", "/var/log/events.jsonl"},
+			wantErr: false,
+			checks: func(t *testing.T, cfg *config.Config) {
+				if cfg.LogLevel != "debug" || cfg.LogFormat != "json" {
+					t.Errorf("unexpected log settings %q/%q", cfg.LogLevel, cfg.LogFormat)
+				}
+				if cfg.EventLog != "/var/log/events.jsonl" {
+					t.Errorf("unexpected event log %q", cfg.EventLog)
+				}
+			},
+		},
+		{
+			name:    "admin address",
+			args:    []string{"-url", "https://example.com", "-admin-addr", "127.0.0.1:9090"},
+			wantErr: false,
+			checks: func(t *testing.T, cfg *config.Config) {
+				if cfg.AdminAddr != "127.0.0.1:9090" {
+					t.Errorf("expected admin addr 127.0.0.1:9090, got %q", cfg.AdminAddr)
+				}
+			},
+		},
+		{
+			name:    "adaptive concurrency",
+			args:    []string{"-url", "https://example.com", "-adaptive", "-min-concurrency", "2", "-max-concurrency", "32"},
+			wantErr: false,
+			checks: func(t *testing.T, cfg *config.Config) {
+				if !cfg.Adaptive || cfg.MinConcurrency != 2 || cfg.MaxConcurrency != 32 {
+					t.Errorf("unexpected adaptive config %v/%d/%d", cfg.Adaptive, cfg.MinConcurrency, cfg.MaxConcurrency)
+				}
+			},
+		},
+		{
+			name:    "invalid adaptive bounds",
+			args:    []string{"-url", "https://example.com", "-adaptive", "-min-concurrency", "10", "-max-concurrency", "5"},
+			wantErr: true,
+		},
+		{
+			name:    "circuit breaker",
+			args:    []string{"-url", "https://example.com", "-breaker-threshold", "3", "-breaker-cooldown", "1m", "-breaker-probes", "5"},
+			wantErr: false,
+			checks: func(t *testing.T, cfg *config.Config) {
+				if cfg.BreakerThreshold != 3 || cfg.BreakerCooldown != time.Minute || cfg.BreakerProbes != 5 {
+					t.Errorf("unexpected breaker config %d/%v/%d", cfg.BreakerThreshold, cfg.BreakerCooldown, cfg.BreakerProbes)
+				}
+			},
+		},
+		{
+			name:    "control API",
+			args:    []string{"-url", "https://example.com", "-control-addr", "unix:/tmp/mirror.sock", "-checkpoint", "cp.json", "-resume"},
+			wantErr: false,
+			checks: func(t *testing.T, cfg *config.Config) {
+				if cfg.ControlAddr != "unix:/tmp/mirror.sock" || cfg.CheckpointFile != "cp.json" || !cfg.Resume {
+					t.Errorf("unexpected control config %q/%q/%v", cfg.ControlAddr, cfg.CheckpointFile, cfg.Resume)
+				}
+			},
+		},
+		{
+			name:    "non-local control address",
+			args:    []string{"-url", "https://example.com", "-control-addr", "0.0.0.0:9091"},
+			wantErr: true,
+		},
+		{
+			name:    "event hooks",
+			args:    []string{"-url", "https://example.com", "-hook-exec", "./index.sh", "-hook-url", "http://127.0.0.1:8000/events", "-hook-events", "saved,failed"},
+			wantErr: false,
+			checks: func(t *testing.T, cfg *config.Config) {
+				if cfg.HookExec != "./index.sh" || cfg.HookURL != "http://127.0.0.1:8000/events" || len(cfg.HookEvents) != 2 {
+					t.Errorf("unexpected hooks %q/%q/%v", cfg.HookExec, cfg.HookURL, cfg.HookEvents)
+				}
+			},
+		},
+		{
+			name:    "unknown hook event",
+			args:    []string{"-url", "https://example.com", "-hook-exec", "true", "-hook-events", "downloaded"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid hook URL",
+			args:    []string{"-url", "https://example.com", "-hook-url", "localhost:8000"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid log level",
+			args:    []string{"-url", "https://example.com", "-log-level", "loud"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown crawl order",
+			args:    []string{"-url", "https://example.com", "-order", "random"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid MIME budget",
+			args:    []string{"-url", "https://example.com", "-max-mime-bytes", "images=10MB"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid bandwidth",
+			args:    []string{"-url", "https://example.com", "-bandwidth", "fast"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid rate schedule",
+			args:    []string{"-url", "https://example.com", "-rate-schedule", "always"},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -216,3 +403,170 @@ func TestParseArgs(t *testing.T) {
 		})
 	}
 }
+
+func TestParser_ParseSitemap(t *testing.T) {
+	base, _ := url.Parse("https://example.com/sitemap.xml")
+	p := NewParser()
+
+	t.Run("urlset", func(t *testing.T) {
+		content := `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<url><loc>https://example.com/</loc><priority>1.0</priority></url>
+	<url><loc>https://example.com/about</loc></url>
+	<url><loc>https://other.com/page</loc><priority>0.9</priority></url>
+</urlset>`
+		entries, sitemaps, err := p.ParseSitemap([]byte(content), base)
+		if err != nil {
+			t.Fatalf("ParseSitemap() error = %v", err)
+		}
+		if len(sitemaps) != 0 {
+			t.Errorf("expected no nested sitemaps, got %v", sitemaps)
+		}
+		if len(entries) != 2 {
+			t.Fatalf("got %d entries, want 2", len(entries))
+		}
+		if entries[0].URL.String() != "https://example.com/" || entries[0].Priority != 1.0 {
+			t.Errorf("unexpected first entry %v %v", entries[0].URL, entries[0].Priority)
+		}
+		if entries[1].URL.String() != "https://example.com/about" || entries[1].Priority != 0.5 {
+			t.Errorf("unexpected second entry %v %v", entries[1].URL, entries[1].Priority)
+		}
+	})
+
+	t.Run("sitemap index", func(t *testing.T) {
+		content := `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<sitemap><loc>/sitemap-pages.xml</loc></sitemap>
+</sitemapindex>`
+		entries, sitemaps, err := p.ParseSitemap([]byte(content), base)
+		if err != nil {
+			t.Fatalf("ParseSitemap() error = %v", err)
+		}
+		if len(entries) != 0 {
+			t.Errorf("expected no entries, got %d", len(entries))
+		}
+		if len(sitemaps) != 1 || sitemaps[0].String() != "https://example.com/sitemap-pages.xml" {
+			t.Errorf("unexpected nested sitemaps %v", sitemaps)
+		}
+	})
+
+	t.Run("invalid XML", func(t *testing.T) {
+		if _, _, err := p.ParseSitemap([]byte("not xml"), base); err == nil {
+			t.Error("expected error for invalid XML")
+		}
+	})
+}
+
+func TestParser_ParseCSS(t *testing.T) {
+	content := `@import "reset.css";
+@import url('/fonts/font.css');
+body { background: url(/img/bg.png) no-repeat; }
+.logo { background-image: url( "../img/logo.svg" ); }
+.inline { background: url(data:image/png;base64,AAAA); }
+.cdn { background: url(https://cdn.com/x.png); }`
+
+	base, _ := url.Parse("https://example.com/css/main.css")
+	resources := NewParser().ParseCSS([]byte(content), base)
+
+	want := []string{
+		"https://example.com/css/reset.css",
+		"https://example.com/fonts/font.css",
+		"https://example.com/img/bg.png",
+		"https://example.com/img/logo.svg",
+	}
+	if len(resources) != len(want) {
+		t.Fatalf("ParseCSS() got %v, want %v", resources, want)
+	}
+	for i, w := range want {
+		if resources[i].String() != w {
+			t.Errorf("ParseCSS() resource[%d] = %v, want %v", i, resources[i], w)
+		}
+	}
+}
+
+func TestParser_ParseLinks(t *testing.T) {
+	content := `<html><head><base href="/docs/">
+<link rel="stylesheet" href="style.css"></head>
+<body id="top">
+<a href="intro#setup">Read   the <b>intro</b></a>
+<a href="https://other.com/">other</a>
+<a href="mailto:me@example.com">mail</a>
+<a href="#faq" rel="nofollow">FAQ</a>
+<a name="faq"></a>
+<img src="logo.png" alt="Logo">
+</body></html>`
+
+	base, _ := url.Parse("https://example.com/index.html")
+	links, err := NewParser().ParseLinks([]byte(content), base)
+	if err != nil {
+		t.Fatalf("ParseLinks() error = %v", err)
+	}
+
+	want := []Link{
+		{Element: "link", Attr: "href", Rel: "stylesheet"},
+		{Element: "a", Attr: "href", Text: "Read the intro"},
+		{Element: "a", Attr: "href", Text: "other"},
+		{Element: "a", Attr: "href", Text: "FAQ", Rel: "nofollow"},
+		{Element: "img", Attr: "src", Text: "Logo"},
+	}
+	urls := []string{
+		"https://example.com/docs/style.css",
+		"https://example.com/docs/intro#setup",
+		"https://other.com/",
+		"https://example.com/docs/#faq",
+		"https://example.com/docs/logo.png",
+	}
+	if len(links) != len(want) {
+		t.Fatalf("ParseLinks() got %d links, want %d: %+v", len(links), len(want), links)
+	}
+	for i, w := range want {
+		got := links[i]
+		if got.URL.String() != urls[i] || got.Element != w.Element || got.Attr != w.Attr || got.Text != w.Text || got.Rel != w.Rel {
+			t.Errorf("ParseLinks() link[%d] = %v %+v, want %v %+v", i, got.URL, got, urls[i], w)
+		}
+	}
+
+	ids, err := NewParser().ParseIDs([]byte(content))
+	if err != nil {
+		t.Fatalf("ParseIDs() error = %v", err)
+	}
+	if !ids["top"] || !ids["faq"] || len(ids) != 2 {
+		t.Errorf("ParseIDs() = %v, want top and faq", ids)
+	}
+}
+
+func TestParser_TextLines(t *testing.T) {
+	content := `<html><head><title>News</title><script>var t = 1</script></head>
+<body><p>Hello,
+   <b>world</b>!</p><!-- build 42 -->
+<ul><li>one</li><li class="ad promo">buy</li></ul>
+<footer>Built <time>2026-10-18</time></footer>
+<meta name="csrf-token" content="x"></body></html>`
+
+	ignore, err := ParseSelectors("time, li.ad, meta[name=csrf-token]")
+	if err != nil {
+		t.Fatalf("ParseSelectors() error = %v", err)
+	}
+	lines, err := NewParser().TextLines([]byte(content), ignore)
+	if err != nil {
+		t.Fatalf("TextLines() error = %v", err)
+	}
+	want := []string{"News", "Hello, world!", "one", "Built"}
+	if strings.Join(lines, "|") != strings.Join(want, "|") {
+		t.Errorf("TextLines() = %q, want %q", lines, want)
+	}
+
+	base, _ := url.Parse("https://example.com/")
+	page, err := NewParser().ParsePage([]byte(content+`<a href="/next">next</a>`), base)
+	if err != nil {
+		t.Fatalf("ParsePage() error = %v", err)
+	}
+	if len(page.Pages) != 1 || page.Pages[0].String() != "https://example.com/next" || len(page.Text) != 6 {
+		t.Errorf("ParsePage() = %v %q", page.Pages, page.Text)
+	}
+
+	for _, s := range []string{"div p", "a[href", ".", "li > a"} {
+		if _, err = ParseSelector(s); !errors.Is(err, ErrInvalidSelector) {
+			t.Errorf("ParseSelector(%q) error = %v, want ErrInvalidSelector", s, err)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/url"
+	"strings"
+)
+
+type SitemapEntry struct {
+	URL      *url.URL
+	Priority float64
+}
+
+type sitemapDoc struct {
+	XMLName xml.Name
+	URLs    []struct {
+		Loc      string   `xml:"loc"`
+		Priority *float64 `xml:"priority"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// defaultSitemapPriority - значение <priority> по умолчанию из протокола sitemaps.org.
+const defaultSitemapPriority = 0.5
+
+// ParseSitemap разбирает urlset или sitemapindex. Для индекса возвращаются
+// ссылки на вложенные sitemap, которые нужно скачать отдельно.
+func (p *Parser) ParseSitemap(content []byte, base *url.URL) (entries []SitemapEntry, sitemaps []*url.URL, err error) {
+	var doc sitemapDoc
+	if err = xml.NewDecoder(bytes.NewReader(content)).Decode(&doc); err != nil {
+		return nil, nil, err
+	}
+
+	for _, u := range doc.URLs {
+		loc, errParse := url.Parse(strings.TrimSpace(u.Loc))
+		if errParse != nil {
+			continue
+		}
+		loc = base.ResolveReference(loc)
+		if loc.Host != base.Host {
+			continue
+		}
+		priority := defaultSitemapPriority
+		if u.Priority != nil {
+			priority = *u.Priority
+		}
+		entries = append(entries, SitemapEntry{URL: loc, Priority: priority})
+	}
+
+	for _, sm := range doc.Sitemaps {
+		loc, errParse := url.Parse(strings.TrimSpace(sm.Loc))
+		if errParse != nil {
+			continue
+		}
+		sitemaps = append(sitemaps, base.ResolveReference(loc))
+	}
+	return entries, sitemaps, nil
+}
@@ -0,0 +1,210 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var ErrInvalidSelector = errors.New("invalid selector")
+
+// Selector - простой CSS-селектор без комбинаторов: тег, #id, .class и
+// [attr] или [attr=value], например div.ad или meta[name=csrf-token].
+type Selector struct {
+	raw     string
+	tag     string
+	id      string
+	classes []string
+	attrs   []attrMatch
+}
+
+type attrMatch struct {
+	key, val string
+	hasVal   bool
+}
+
+// ParseSelectors разбирает список селекторов через запятую, пустая строка - без селекторов.
+func ParseSelectors(list string) ([]Selector, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	var sels []Selector
+	for _, s := range strings.Split(list, ",") {
+		sel, err := ParseSelector(s)
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, sel)
+	}
+	return sels, nil
+}
+
+func ParseSelector(s string) (Selector, error) {
+	s = strings.TrimSpace(s)
+	sel := Selector{raw: s}
+	invalid := func() (Selector, error) {
+		return Selector{}, fmt.Errorf("%w: %q", ErrInvalidSelector, s)
+	}
+	if s == "" {
+		return invalid()
+	}
+
+	i := 0
+	name := func() string {
+		start := i
+		for i < len(s) && isNameChar(s[i]) {
+			i++
+		}
+		return s[start:i]
+	}
+	if s[0] == '*' {
+		i++
+	} else {
+		sel.tag = strings.ToLower(name())
+	}
+	for i < len(s) {
+		switch c := s[i]; c {
+		case '#', '.':
+			i++
+			v := name()
+			if v == "" {
+				return invalid()
+			}
+			if c == '#' {
+				sel.id = v
+			} else {
+				sel.classes = append(sel.classes, v)
+			}
+		case '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return invalid()
+			}
+			key, val, hasVal := strings.Cut(s[i+1:i+end], "=")
+			key = strings.ToLower(strings.TrimSpace(key))
+			if key == "" {
+				return invalid()
+			}
+			val = strings.Trim(strings.TrimSpace(val), `"'`)
+			sel.attrs = append(sel.attrs, attrMatch{key: key, val: val, hasVal: hasVal})
+			i += end + 1
+		default:
+			// Пробелы и >, + или ~ - комбинаторы, они не поддерживаются.
+			return invalid()
+		}
+	}
+	return sel, nil
+}
+
+func isNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_'
+}
+
+func (s Selector) String() string {
+	return s.raw
+}
+
+// Match сообщает, подходит ли элемент под селектор.
+func (s Selector) Match(n *html.Node) bool {
+	if n.Type != html.ElementNode || (s.tag != "" && n.Data != s.tag) {
+		return false
+	}
+	if s.id != "" {
+		if id, _ := attrValue(n, "id"); id != s.id {
+			return false
+		}
+	}
+	if len(s.classes) > 0 {
+		class, _ := attrValue(n, "class")
+		have := strings.Fields(class)
+		for _, c := range s.classes {
+			if !slices.Contains(have, c) {
+				return false
+			}
+		}
+	}
+	for _, a := range s.attrs {
+		val, ok := attrValue(n, a.key)
+		if !ok || (a.hasVal && val != a.val) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchAny(sels []Selector, n *html.Node) bool {
+	for _, s := range sels {
+		if s.Match(n) {
+			return true
+		}
+	}
+	return false
+}
+
+// hiddenElements - элементы, текст которых не показывается на странице.
+var hiddenElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true,
+}
+
+// blockElements начинают новую строку текста.
+var blockElements = map[string]bool{
+	"title": true, "p": true, "div": true, "br": true, "hr": true, "li": true, "dt": true, "dd": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"ul": true, "ol": true, "dl": true, "table": true, "tr": true, "td": true, "th": true,
+	"section": true, "article": true, "aside": true, "header": true, "footer": true, "nav": true,
+	"main": true, "blockquote": true, "pre": true, "form": true, "option": true,
+	"figure": true, "figcaption": true, "details": true, "summary": true,
+}
+
+// TextLines возвращает видимый текст страницы по строкам: блочные элементы
+// начинают новую строку, пробелы схлопываются, пустые строки пропускаются.
+// Скрипты, стили, комментарии и элементы под селекторами ignore не попадают в текст.
+func (p *Parser) TextLines(content []byte, ignore []Selector) ([]string, error) {
+	doc, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	return textLines(doc, ignore), nil
+}
+
+func textLines(doc *html.Node, ignore []Selector) []string {
+	var lines []string
+	var line strings.Builder
+	flush := func() {
+		if text := strings.Join(strings.Fields(line.String()), " "); text != "" {
+			lines = append(lines, text)
+		}
+		line.Reset()
+	}
+	var traverse func(*html.Node)
+	traverse = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			line.WriteString(n.Data)
+			return
+		case html.CommentNode:
+			return
+		case html.ElementNode:
+			if hiddenElements[n.Data] || matchAny(ignore, n) {
+				return
+			}
+		}
+		block := n.Type == html.ElementNode && blockElements[n.Data]
+		if block {
+			flush()
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			traverse(c)
+		}
+		if block {
+			flush()
+		}
+	}
+	traverse(doc)
+	flush()
+	return lines
+}
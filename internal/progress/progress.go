@@ -0,0 +1,373 @@
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"site-mirror/internal/eventlog"
+	"site-mirror/internal/units"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const topN = 10
+
+type URLStat struct {
+	URL        string  `json:"url"`
+	Bytes      int64   `json:"bytes"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+type MIMEStat struct {
+	Count int   `json:"count"`
+	Bytes int64 `json:"bytes"`
+}
+
+type Summary struct {
+	StartedAt  time.Time           `json:"started_at"`
+	Duration   float64             `json:"duration_seconds"`
+	Total      int                 `json:"total"`
+	Succeeded  int                 `json:"succeeded"`
+	Failed     int                 `json:"failed"`
+	Bytes      int64               `json:"bytes"`
+	ByStatus   map[int]int         `json:"by_status"`
+	ByMIME     map[string]MIMEStat `json:"by_mime"`
+	ByDepth    map[int]int         `json:"by_depth"`
+	Slowest    []URLStat           `json:"slowest"`
+	Largest    []URLStat           `json:"largest"`
+	BudgetHits []string            `json:"budget_hits,omitempty"`
+	// DedupFiles и DedupBytes - файлы и байты, которые не записывались, потому что
+	// содержимое уже было в блоб-хранилище.
+	DedupFiles int64 `json:"dedup_files,omitempty"`
+	DedupBytes int64 `json:"dedup_bytes,omitempty"`
+	// Snapshot - каталог снимка при обходе с -snapshot.
+	Snapshot string `json:"snapshot,omitempty"`
+	// NearDuplicates - страницы, почти совпавшие с уже скачанными, при -near-dup.
+	NearDuplicates int `json:"near_duplicates,omitempty"`
+}
+
+func newSummary(start time.Time) Summary {
+	return Summary{
+		StartedAt: start,
+		ByStatus:  make(map[int]int),
+		ByMIME:    make(map[string]MIMEStat),
+		ByDepth:   make(map[int]int),
+	}
+}
+
+func (s *Summary) add(rec eventlog.Record) {
+	s.Total++
+	if rec.Error != "" {
+		s.Failed++
+	} else {
+		s.Succeeded++
+	}
+	s.Bytes += rec.Bytes
+	s.ByStatus[rec.Status]++
+	s.ByDepth[rec.Depth]++
+
+	if rec.ContentType != "" {
+		mt, _, err := mime.ParseMediaType(rec.ContentType)
+		if err != nil {
+			mt = rec.ContentType
+		}
+		st := s.ByMIME[mt]
+		st.Count++
+		st.Bytes += rec.Bytes
+		s.ByMIME[mt] = st
+	}
+
+	stat := URLStat{URL: rec.URL, Bytes: rec.Bytes, DurationMS: rec.DurationMS}
+	s.Slowest = insertTop(s.Slowest, stat, func(a, b URLStat) bool { return a.DurationMS > b.DurationMS })
+	if rec.Error == "" {
+		s.Largest = insertTop(s.Largest, stat, func(a, b URLStat) bool { return a.Bytes > b.Bytes })
+	}
+}
+
+func insertTop(list []URLStat, stat URLStat, before func(a, b URLStat) bool) []URLStat {
+	i := sort.Search(len(list), func(i int) bool { return before(stat, list[i]) })
+	if i >= topN {
+		return list
+	}
+	list = append(list, URLStat{})
+	copy(list[i+1:], list[i:])
+	list[i] = stat
+	if len(list) > topN {
+		list = list[:topN]
+	}
+	return list
+}
+
+// Summarize собирает итог по записям журнала обхода, например для завершённого запуска.
+func Summarize(records []eventlog.Record) Summary {
+	var start, end time.Time
+	for _, rec := range records {
+		if start.IsZero() || rec.Time.Before(start) {
+			start = rec.Time
+		}
+		if rec.Time.After(end) {
+			end = rec.Time
+		}
+	}
+
+	s := newSummary(start)
+	for _, rec := range records {
+		s.add(rec)
+	}
+	s.Duration = end.Sub(start).Seconds()
+	return s
+}
+
+func (s Summary) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+func (s Summary) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Crawled %d URLs in %s: %d ok, %d failed, %s\n",
+		s.Total, seconds(s.Duration).Round(time.Millisecond), s.Succeeded, s.Failed, units.FormatBytes(s.Bytes))
+
+	b.WriteString("By status:\n")
+	for _, status := range sortedKeys(s.ByStatus) {
+		label := fmt.Sprint(status)
+		if status == 0 {
+			label = "no response"
+		}
+		fmt.Fprintf(&b, "  %-12s %d\n", label, s.ByStatus[status])
+	}
+
+	b.WriteString("By MIME type:\n")
+	mimes := make([]string, 0, len(s.ByMIME))
+	for mt := range s.ByMIME {
+		mimes = append(mimes, mt)
+	}
+	sort.Strings(mimes)
+	for _, mt := range mimes {
+		fmt.Fprintf(&b, "  %-24s %6d %10s\n", mt, s.ByMIME[mt].Count, units.FormatBytes(s.ByMIME[mt].Bytes))
+	}
+
+	b.WriteString("By depth:\n")
+	for _, depth := range sortedKeys(s.ByDepth) {
+		fmt.Fprintf(&b, "  %-4d %d\n", depth, s.ByDepth[depth])
+	}
+
+	b.WriteString("Slowest URLs:\n")
+	for _, st := range s.Slowest {
+		fmt.Fprintf(&b, "  %8.0fms %s\n", st.DurationMS, st.URL)
+	}
+	b.WriteString("Largest files:\n")
+	for _, st := range s.Largest {
+		fmt.Fprintf(&b, "  %10s %s\n", units.FormatBytes(st.Bytes), st.URL)
+	}
+
+	for _, hit := range s.BudgetHits {
+		fmt.Fprintf(&b, "Budget limit reached: %s\n", hit)
+	}
+	if s.DedupFiles > 0 {
+		fmt.Fprintf(&b, "Deduplicated: %d files, %s not written\n", s.DedupFiles, units.FormatBytes(s.DedupBytes))
+	}
+	if s.NearDuplicates > 0 {
+		fmt.Fprintf(&b, "Near-duplicate pages: %d\n", s.NearDuplicates)
+	}
+	if s.Snapshot != "" {
+		fmt.Fprintf(&b, "Snapshot: %s\n", s.Snapshot)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func sortedKeys(m map[int]int) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// Reporter получает события от воркеров и показывает прогресс: на терминале
+// перерисовывает строку состояния, иначе периодически печатает строки.
+type Reporter struct {
+	mu       sync.Mutex
+	summary  Summary
+	queued   int
+	inFlight int
+
+	out      io.Writer
+	tty      bool
+	interval time.Duration
+	now      func() time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewReporter(out io.Writer) *Reporter {
+	r := &Reporter{
+		out:      out,
+		tty:      isTerminal(out),
+		interval: 10 * time.Second,
+		now:      time.Now,
+	}
+	if r.tty {
+		r.interval = 200 * time.Millisecond
+	}
+	r.summary = newSummary(r.now())
+	return r
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+func (r *Reporter) Queued() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queued++
+}
+
+func (r *Reporter) Started() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inFlight++
+}
+
+func (r *Reporter) Finished(rec eventlog.Record) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inFlight--
+	r.summary.add(rec)
+}
+
+// Parked отмечает, что начатая задача отложена и будет выдана повторно.
+func (r *Reporter) Parked() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inFlight--
+}
+
+// Status - текущее состояние обхода, общее для строки прогресса и /status.
+type Status struct {
+	Queued     int     `json:"queued"`
+	InFlight   int     `json:"in_flight"`
+	Done       int     `json:"done"`
+	Failed     int     `json:"failed"`
+	Bytes      int64   `json:"bytes"`
+	Throughput float64 `json:"bytes_per_second"`
+	Elapsed    float64 `json:"elapsed_seconds"`
+	ETA        float64 `json:"eta_seconds,omitempty"`
+}
+
+func (r *Reporter) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	elapsed := r.now().Sub(r.summary.StartedAt)
+	finished := r.summary.Total
+	st := Status{
+		Queued:   r.queued - finished - r.inFlight,
+		InFlight: r.inFlight,
+		Done:     r.summary.Succeeded,
+		Failed:   r.summary.Failed,
+		Bytes:    r.summary.Bytes,
+		Elapsed:  elapsed.Seconds(),
+	}
+	if st.Elapsed > 0 {
+		st.Throughput = float64(r.summary.Bytes) / st.Elapsed
+		if finished > 0 {
+			perURL := elapsed / time.Duration(finished)
+			st.ETA = (perURL * time.Duration(st.Queued+st.InFlight)).Seconds()
+		}
+	}
+	return st
+}
+
+func (r *Reporter) Line() string {
+	st := r.Status()
+
+	eta := "?"
+	if st.Done+st.Failed > 0 && st.Elapsed > 0 {
+		eta = seconds(st.ETA).Round(time.Second).String()
+	}
+
+	return fmt.Sprintf("queued %d | in-flight %d | done %d | failed %d | %s | %s/s | elapsed %s | eta %s",
+		st.Queued, st.InFlight, st.Done, st.Failed,
+		units.FormatBytes(st.Bytes), units.FormatBytes(int64(st.Throughput)),
+		seconds(st.Elapsed).Round(time.Second), eta)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+func (r *Reporter) Start() {
+	if r == nil {
+		return
+	}
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.print()
+			case <-r.stop:
+				if r.tty {
+					_, _ = fmt.Fprint(r.out, "\r\033[K")
+				}
+				return
+			}
+		}
+	}()
+}
+
+func (r *Reporter) print() {
+	if r.tty {
+		_, _ = fmt.Fprint(r.out, "\r\033[K"+r.Line())
+		return
+	}
+	_, _ = fmt.Fprintln(r.out, r.Line())
+}
+
+func (r *Reporter) Stop() {
+	if r == nil || r.stop == nil {
+		return
+	}
+	close(r.stop)
+	<-r.done
+}
+
+func (r *Reporter) Summary() Summary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.summary
+	s.Duration = r.now().Sub(s.StartedAt).Seconds()
+	return s
+}
@@ -0,0 +1,188 @@
+package progress
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"site-mirror/internal/eventlog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testRecords() []eventlog.Record {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	return []eventlog.Record{
+		{Time: base, URL: "https://example.com/", Depth: 0, Status: 200, Bytes: 1000, DurationMS: 50, ContentType: "text/html; charset=utf-8"},
+		{Time: base.Add(time.Second), URL: "https://example.com/logo.png", Depth: 1, Status: 200, Bytes: 50000, DurationMS: 20, ContentType: "image/png"},
+		{Time: base.Add(2 * time.Second), URL: "https://example.com/slow", Depth: 1, Status: 200, Bytes: 2000, DurationMS: 900, ContentType: "text/html"},
+		{Time: base.Add(3 * time.Second), URL: "https://example.com/missing", Depth: 2, Status: 404, DurationMS: 10, Error: "too many requests"},
+		{Time: base.Add(4 * time.Second), URL: "https://example.com/down", Depth: 2, DurationMS: 3000, Error: "connection refused"},
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	s := Summarize(testRecords())
+
+	if s.Total != 5 || s.Succeeded != 3 || s.Failed != 2 {
+		t.Errorf("unexpected totals %d/%d/%d", s.Total, s.Succeeded, s.Failed)
+	}
+	if s.Bytes != 53000 {
+		t.Errorf("expected 53000 bytes, got %d", s.Bytes)
+	}
+	if s.Duration != 4 {
+		t.Errorf("expected duration 4s, got %v", s.Duration)
+	}
+	if s.ByStatus[200] != 3 || s.ByStatus[404] != 1 || s.ByStatus[0] != 1 {
+		t.Errorf("unexpected status breakdown %v", s.ByStatus)
+	}
+	if s.ByMIME["text/html"] != (MIMEStat{Count: 2, Bytes: 3000}) || s.ByMIME["image/png"].Count != 1 {
+		t.Errorf("unexpected MIME breakdown %v", s.ByMIME)
+	}
+	if s.ByDepth[0] != 1 || s.ByDepth[1] != 2 || s.ByDepth[2] != 2 {
+		t.Errorf("unexpected depth breakdown %v", s.ByDepth)
+	}
+	if s.Slowest[0].URL != "https://example.com/down" || s.Slowest[1].URL != "https://example.com/slow" {
+		t.Errorf("unexpected slowest %v", s.Slowest)
+	}
+	if len(s.Largest) != 3 || s.Largest[0].URL != "https://example.com/logo.png" {
+		t.Errorf("unexpected largest %v", s.Largest)
+	}
+}
+
+func TestSummary_TopNLimit(t *testing.T) {
+	var records []eventlog.Record
+	for i := range 25 {
+		records = append(records, eventlog.Record{URL: fmt.Sprintf("https://example.com/%d", i), Bytes: int64(i), DurationMS: float64(i)})
+	}
+
+	s := Summarize(records)
+
+	if len(s.Slowest) != topN || len(s.Largest) != topN {
+		t.Fatalf("expected top %d lists, got %d/%d", topN, len(s.Slowest), len(s.Largest))
+	}
+	if s.Slowest[0].DurationMS != 24 || s.Largest[topN-1].Bytes != 15 {
+		t.Errorf("unexpected top lists %v %v", s.Slowest, s.Largest)
+	}
+}
+
+func TestSummary_WriteJSON(t *testing.T) {
+	s := Summarize(testRecords())
+	s.BudgetHits = []string{"max pages budget exhausted: 5"}
+
+	var buf bytes.Buffer
+	if err := s.WriteJSON(&buf); err != nil {
+		t.Fatalf("WriteJSON returned error: %v", err)
+	}
+
+	var decoded Summary
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("summary is not valid JSON: %v", err)
+	}
+	if decoded.Total != 5 || decoded.ByStatus[404] != 1 || len(decoded.BudgetHits) != 1 {
+		t.Errorf("unexpected decoded summary %+v", decoded)
+	}
+}
+
+func TestSummary_WriteText(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Summarize(testRecords()).WriteText(&buf); err != nil {
+		t.Fatalf("WriteText returned error: %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{"Crawled 5 URLs", "no response", "image/png", "Slowest URLs:", "https://example.com/down"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("summary text missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestReporter_Line(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewReporter(&buf)
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return start }
+	r.summary.StartedAt = start
+
+	for range 4 {
+		r.Queued()
+	}
+	r.Started()
+	r.Started()
+	r.Finished(eventlog.Record{URL: "https://example.com/", Bytes: 2048, Status: 200})
+	r.Finished(eventlog.Record{URL: "https://example.com/x", Error: "boom"})
+	r.Started()
+	r.now = func() time.Time { return start.Add(2 * time.Second) }
+
+	line := r.Line()
+	for _, want := range []string{"queued 1", "in-flight 1", "done 1", "failed 1", "2.0KB", "1.0KB/s", "eta 2s"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("progress line %q missing %q", line, want)
+		}
+	}
+}
+
+func TestReporter_Status(t *testing.T) {
+	r := NewReporter(&bytes.Buffer{})
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return start.Add(4 * time.Second) }
+	r.summary.StartedAt = start
+
+	r.Queued()
+	r.Queued()
+	r.Queued()
+	r.Started()
+	r.Finished(eventlog.Record{URL: "https://example.com/", Bytes: 4000, Status: 200})
+	r.Started()
+	r.Parked()
+
+	st := r.Status()
+	want := Status{Queued: 2, Done: 1, Bytes: 4000, Throughput: 1000, Elapsed: 4, ETA: 8}
+	if st != want {
+		t.Errorf("expected %+v, got %+v", want, st)
+	}
+}
+
+func TestReporter_PeriodicLines(t *testing.T) {
+	var buf safeBuffer
+	r := NewReporter(&buf)
+	r.interval = 10 * time.Millisecond
+
+	r.Start()
+	time.Sleep(50 * time.Millisecond)
+	r.Stop()
+
+	out := buf.String()
+	if !strings.Contains(out, "\n") || strings.Contains(out, "\r") {
+		t.Errorf("expected plain periodic lines for non-TTY output, got %q", out)
+	}
+}
+
+func TestReporter_Nil(t *testing.T) {
+	var r *Reporter
+	r.Queued()
+	r.Started()
+	r.Finished(eventlog.Record{})
+	r.Parked()
+	r.Start()
+	r.Stop()
+}
+
+type safeBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *safeBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *safeBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,372 @@
+// Package proxy - записывающий HTTP-прокси: ответы, проходящие через него,
+// сохраняются в зеркало, так что сеанс в браузере превращается в копию сайта.
+package proxy
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"site-mirror/internal/downloader"
+	"site-mirror/internal/eventlog"
+	"site-mirror/internal/mediatype"
+	"site-mirror/internal/parser"
+	"site-mirror/internal/queue"
+	"sync"
+	"time"
+)
+
+// Заголовки соединения, которые прокси не передаёт дальше.
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// Saver - хранилище записанных ответов, например storage.Storage.
+type Saver interface {
+	Save(u *url.URL, content []byte, contentType string) error
+}
+
+// Fetcher скачивает ресурсы страниц при Requisites, например загрузчик обхода
+// из mirror.NewFetcher с его лимитами и выключателем.
+type Fetcher interface {
+	Fetch(u *url.URL, useRobots bool) (*downloader.Response, error)
+}
+
+// Proxy - HTTP-прокси для браузера. HTTPS читается, если задан CA, иначе
+// CONNECT туннелируется без записи.
+type Proxy struct {
+	Storage Saver
+	CA      *CA
+	// Transport ходит к сайтам; New ставит http.DefaultTransport без прокси из окружения.
+	Transport http.RoundTripper
+	// Filter отбирает записываемые URL, прокси пропускает все запросы.
+	Filter queue.Filter
+	// Requisites включает загрузку ресурсов записанных страниц (картинки,
+	// стили, скрипты), даже если браузер их не запросил.
+	Requisites bool
+	// Fetcher скачивает ресурсы при Requisites; nil - через Transport без лимитов.
+	Fetcher Fetcher
+	// OnRecord вызывается после сохранения каждого ответа.
+	OnRecord func(eventlog.Record)
+	Logger   *slog.Logger
+
+	pars   *parser.Parser
+	direct *downloader.Downloader
+	mu     sync.Mutex
+	seen   map[string]bool
+	wg     sync.WaitGroup
+	sem    chan struct{}
+}
+
+func New(store Saver) *Proxy {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	return &Proxy{
+		Storage:   store,
+		Transport: transport,
+		Logger:    slog.Default(),
+		pars:      parser.NewParser(),
+		seen:      make(map[string]bool),
+		sem:       make(chan struct{}, 4),
+	}
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.connect(w, r)
+		return
+	}
+	if !r.URL.IsAbs() {
+		http.Error(w, "site-mirror proxy: configure it as the browser's HTTP proxy", http.StatusBadRequest)
+		return
+	}
+	p.forward(w, r, r.URL)
+}
+
+// Wait дожидается загрузки ресурсов, начатой с Requisites.
+func (p *Proxy) Wait() {
+	p.wg.Wait()
+}
+
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request, u *url.URL) {
+	out := r.Clone(r.Context())
+	out.URL = u
+	out.RequestURI = ""
+	for _, h := range hopHeaders {
+		out.Header.Del(h)
+	}
+	// Без Accept-Encoding транспорт сам распакует gzip, и на диск попадёт исходный файл.
+	out.Header.Del("Accept-Encoding")
+
+	start := time.Now()
+	resp, err := p.Transport.RoundTrip(out)
+	if err != nil {
+		p.Logger.Warn("proxy request failed", "url", u.String(), "err", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, h := range hopHeaders {
+		resp.Header.Del(h)
+	}
+	resp.Header.Del("Content-Length")
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	// Ответ сразу уходит браузеру, копия для записи копится по пути.
+	var body bytes.Buffer
+	var src io.Reader = resp.Body
+	recording := r.Method == http.MethodGet && p.recordable(u, resp.StatusCode)
+	if recording {
+		src = io.TeeReader(resp.Body, &body)
+	}
+	if _, err = io.Copy(flushWriter{w: w, rc: http.NewResponseController(w)}, src); err != nil {
+		// Оборванный ответ не записывается, чтобы в зеркало не попал обрезанный файл.
+		p.Logger.Warn("proxy response interrupted", "url", u.String(), "err", err)
+		return
+	}
+	if recording {
+		p.record(u, resp.StatusCode, resp.Header.Get("Content-Type"), body.Bytes(), time.Since(start))
+	}
+}
+
+// flushWriter сразу отправляет браузеру каждый прочитанный кусок ответа.
+type flushWriter struct {
+	w  io.Writer
+	rc *http.ResponseController
+}
+
+func (f flushWriter) Write(b []byte) (int, error) {
+	n, err := f.w.Write(b)
+	if err == nil {
+		if err = f.rc.Flush(); errors.Is(err, http.ErrNotSupported) {
+			err = nil
+		}
+	}
+	return n, err
+}
+
+func (p *Proxy) recordable(u *url.URL, status int) bool {
+	return status == http.StatusOK && p.Filter.Allows(u)
+}
+
+// record сохраняет успешный ответ и, если нужно, ставит в загрузку его ресурсы.
+func (p *Proxy) record(u *url.URL, status int, contentType string, body []byte, took time.Duration) {
+	if !p.recordable(u, status) {
+		return
+	}
+	p.mu.Lock()
+	p.seen[u.String()] = true
+	p.mu.Unlock()
+
+	rec := eventlog.Record{
+		Time:        time.Now(),
+		URL:         u.String(),
+		Kind:        queue.KindResource.String(),
+		Status:      status,
+		Bytes:       int64(len(body)),
+		DurationMS:  float64(took.Microseconds()) / 1000,
+		ContentType: contentType,
+	}
+	html := mediatype.Of(contentType) == "text/html"
+	if html {
+		rec.Kind = queue.KindPage.String()
+	}
+	// Storage.Save сам отказывается писать за пределы каталога хоста.
+	if err := p.Storage.Save(u, body, contentType); err != nil {
+		p.Logger.Error("save failed", "url", rec.URL, "err", err)
+		return
+	}
+	if l, ok := p.Storage.(interface {
+		Path(u *url.URL, contentType string) string
+	}); ok {
+		rec.SavedPath = l.Path(u, contentType)
+	}
+	p.Logger.Info("recorded", "url", rec.URL, "bytes", rec.Bytes, "path", rec.SavedPath)
+	if p.OnRecord != nil {
+		p.OnRecord(rec)
+	}
+
+	if html && p.Requisites {
+		_, resources, err := p.pars.ParseHTML(body, u)
+		if err != nil {
+			p.Logger.Warn("parse failed", "url", rec.URL, "err", err)
+			return
+		}
+		for _, res := range resources {
+			p.fetch(res)
+		}
+	}
+}
+
+// fetch загружает ресурс страницы в фоне через Fetcher, если он ещё не записан.
+// Число одновременных загрузок ограничено, а темп и отказы хостов - забота Fetcher.
+func (p *Proxy) fetch(u *url.URL) {
+	if !p.Filter.Allows(u) {
+		return
+	}
+	p.mu.Lock()
+	if p.seen[u.String()] {
+		p.mu.Unlock()
+		return
+	}
+	p.seen[u.String()] = true
+	p.mu.Unlock()
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.sem <- struct{}{}
+		defer func() { <-p.sem }()
+
+		resp, err := p.fetcher().Fetch(u, false)
+		if err != nil {
+			p.Logger.Warn("requisite fetch failed", "url", u.String(), "err", err)
+			if errors.Is(err, downloader.ErrCircuitOpen) {
+				// Ресурс можно будет загрузить со следующей страницей, когда хост оживёт.
+				p.mu.Lock()
+				delete(p.seen, u.String())
+				p.mu.Unlock()
+			}
+			return
+		}
+		p.record(u, resp.StatusCode, resp.ContentType, resp.Body, resp.Duration)
+	}()
+}
+
+func (p *Proxy) fetcher() Fetcher {
+	if p.Fetcher != nil {
+		return p.Fetcher
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.direct == nil {
+		p.direct = &downloader.Downloader{Client: &http.Client{Transport: p.Transport, Timeout: 30 * time.Second}, Logger: p.Logger}
+	}
+	return p.direct
+}
+
+// connect обрабатывает CONNECT: с CA соединение расшифровывается и запросы
+// записываются как обычные, без CA байты передаются как есть.
+func (p *Proxy) connect(w http.ResponseWriter, r *http.Request) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+	var upstream net.Conn
+	if p.CA == nil {
+		var err error
+		if upstream, err = net.DialTimeout("tcp", r.Host, 30*time.Second); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		if upstream != nil {
+			_ = upstream.Close()
+		}
+		return
+	}
+	if _, err = io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		_ = conn.Close()
+		return
+	}
+
+	if upstream != nil {
+		tunnel(conn, upstream)
+		return
+	}
+
+	hostname, port, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		hostname, port = r.Host, "443"
+	}
+	tlsConn := tls.Server(conn, &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if hello.ServerName != "" {
+				return p.CA.Certificate(hello.ServerName)
+			}
+			return p.CA.Certificate(hostname)
+		},
+		NextProtos: []string{"http/1.1"},
+	})
+	host := hostname
+	if port != "443" {
+		host = net.JoinHostPort(hostname, port)
+	}
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			p.forward(w, req, &url.URL{Scheme: "https", Host: host, Path: req.URL.Path, RawPath: req.URL.RawPath, RawQuery: req.URL.RawQuery})
+		}),
+		ErrorLog:          slog.NewLogLogger(p.Logger.Handler(), slog.LevelDebug),
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+	_ = srv.Serve(newConnListener(tlsConn))
+}
+
+func tunnel(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	cp := func(dst, src net.Conn) {
+		_, _ = io.Copy(dst, src)
+		if c, ok := dst.(interface{ CloseWrite() error }); ok {
+			_ = c.CloseWrite()
+		}
+		done <- struct{}{}
+	}
+	go cp(a, b)
+	go cp(b, a)
+	<-done
+	<-done
+	_ = a.Close()
+	_ = b.Close()
+}
+
+// connListener отдаёт http.Server одно соединение и завершается, когда оно закрыто.
+type connListener struct {
+	conn   net.Conn
+	once   sync.Once
+	closed chan struct{}
+}
+
+func newConnListener(conn net.Conn) *connListener {
+	l := &connListener{closed: make(chan struct{})}
+	l.conn = &closeNotifyConn{Conn: conn, onClose: func() { l.once.Do(func() { close(l.closed) }) }}
+	return l
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	if c := l.conn; c != nil {
+		l.conn = nil
+		return c, nil
+	}
+	<-l.closed
+	return nil, net.ErrClosed
+}
+
+func (l *connListener) Close() error {
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return &net.TCPAddr{}
+}
+
+type closeNotifyConn struct {
+	net.Conn
+	onClose func()
+}
+
+func (c *closeNotifyConn) Close() error {
+	c.onClose()
+	return c.Conn.Close()
+}
@@ -0,0 +1,314 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"site-mirror/internal/downloader"
+	"site-mirror/internal/eventlog"
+	"site-mirror/internal/queue"
+	"site-mirror/internal/storage"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memStorage struct {
+	mu    sync.Mutex
+	files map[string]string
+}
+
+func (m *memStorage) Save(u *url.URL, content []byte, _ string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[u.String()] = string(content)
+	return nil
+}
+
+func (m *memStorage) get(u string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	body, ok := m.files[u]
+	return body, ok
+}
+
+func site() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = io.WriteString(w, `<link rel="stylesheet" href="/style.css"><img src="/logo.png"><a href="/next">next</a>`)
+		case "/style.css":
+			w.Header().Set("Content-Type", "text/css")
+			_, _ = io.WriteString(w, `body{}`)
+		case "/logo.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = io.WriteString(w, "PNG")
+		case "/private":
+			_, _ = io.WriteString(w, "secret")
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// newTestProxy запускает прокси, который ходит к server, и клиента, настроенного на прокси.
+func newTestProxy(t *testing.T, server *httptest.Server, ca *CA) (*Proxy, *memStorage, *http.Client) {
+	t.Helper()
+	store := &memStorage{files: make(map[string]string)}
+	p := New(store)
+	p.CA = ca
+	p.Transport = server.Client().Transport
+	proxySrv := httptest.NewServer(p)
+	t.Cleanup(proxySrv.Close)
+
+	proxyURL, _ := url.Parse(proxySrv.URL)
+	transport := &http.Transport{Proxy: http.ProxyURL(proxyURL)}
+	if ca != nil {
+		roots := x509.NewCertPool()
+		roots.AddCert(ca.Cert)
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	}
+	t.Cleanup(transport.CloseIdleConnections)
+	return p, store, &http.Client{Transport: transport}
+}
+
+func TestProxy_HTTP(t *testing.T) {
+	server := httptest.NewServer(site())
+	defer server.Close()
+	p, store, client := newTestProxy(t, server, nil)
+	p.Requisites = true
+	p.Filter = queue.Filter{Exclude: []*regexp.Regexp{regexp.MustCompile("/private")}}
+	var mu sync.Mutex
+	var records []eventlog.Record
+	p.OnRecord = func(rec eventlog.Record) {
+		mu.Lock()
+		defer mu.Unlock()
+		records = append(records, rec)
+	}
+
+	for _, path := range []string{"/", "/private", "/missing"} {
+		resp, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s through proxy: %v", path, err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+	p.Wait()
+
+	for _, path := range []string{"/", "/style.css", "/logo.png"} {
+		if _, ok := store.get(server.URL + path); !ok {
+			t.Errorf("expected %s to be recorded, got %v", path, store.files)
+		}
+	}
+	for _, path := range []string{"/private", "/missing", "/next"} {
+		if _, ok := store.get(server.URL + path); ok {
+			t.Errorf("expected %s not to be recorded", path)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(records) != 3 || records[0].Kind != "page" {
+		t.Errorf("unexpected records %+v", records)
+	}
+}
+
+type countingFetcher struct {
+	mu   sync.Mutex
+	urls []string
+	next Fetcher
+}
+
+func (f *countingFetcher) Fetch(u *url.URL, useRobots bool) (*downloader.Response, error) {
+	f.mu.Lock()
+	f.urls = append(f.urls, u.String())
+	f.mu.Unlock()
+	return f.next.Fetch(u, useRobots)
+}
+
+func TestProxy_RequisitesFetcher(t *testing.T) {
+	server := httptest.NewServer(site())
+	defer server.Close()
+	p, store, client := newTestProxy(t, server, nil)
+	p.Requisites = true
+	fetcher := &countingFetcher{next: &downloader.Downloader{Client: server.Client()}}
+	p.Fetcher = fetcher
+
+	resp, err := client.Get(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	p.Wait()
+
+	if len(fetcher.urls) != 2 {
+		t.Errorf("expected requisites through Fetcher, got %v", fetcher.urls)
+	}
+	if got, ok := store.get(server.URL + "/style.css"); !ok || got != "body{}" {
+		t.Errorf("expected style.css to be recorded, got %v", store.files)
+	}
+}
+
+func TestProxy_Streams(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "first ")
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+			_, _ = io.WriteString(w, "second")
+		case <-time.After(5 * time.Second):
+			_, _ = io.WriteString(w, "buffered")
+		}
+	}))
+	defer server.Close()
+	_, store, client := newTestProxy(t, server, nil)
+
+	resp, err := client.Get(server.URL + "/slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	first := make([]byte, len("first "))
+	if _, err = io.ReadFull(resp.Body, first); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	rest, _ := io.ReadAll(resp.Body)
+	if string(first)+string(rest) != "first second" {
+		t.Errorf("expected streamed body, got %q", string(first)+string(rest))
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if got, ok := store.get(server.URL + "/slow"); ok {
+			if got != "first second" {
+				t.Errorf("recorded %q", got)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the streamed response to be recorded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestProxy_Traversal(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "payload")
+	}))
+	defer server.Close()
+	root := t.TempDir()
+	p := New(storage.NewStorage(filepath.Join(root, "mirror")))
+	p.Transport = server.Client().Transport
+	proxySrv := httptest.NewServer(p)
+	defer proxySrv.Close()
+	proxyURL, _ := url.Parse(proxySrv.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	resp, err := client.Get(server.URL + "/a/../../../escaped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	entries, _ := os.ReadDir(root)
+	for _, e := range entries {
+		if e.Name() != "mirror" {
+			t.Errorf("proxy wrote %s outside the mirror", e.Name())
+		}
+	}
+}
+
+func TestProxy_HTTPS(t *testing.T) {
+	server := httptest.NewTLSServer(site())
+	defer server.Close()
+	ca, err := NewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, store, client := newTestProxy(t, server, ca)
+
+	resp, err := client.Get(server.URL + "/style.css?v=2")
+	if err != nil {
+		t.Fatalf("GET through MITM proxy: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if string(body) != "body{}" {
+		t.Errorf("unexpected body %q", body)
+	}
+	if resp.TLS == nil || resp.TLS.PeerCertificates[0].Issuer.CommonName != ca.Cert.Subject.CommonName {
+		t.Errorf("expected certificate issued by the proxy CA")
+	}
+	if got, ok := store.get(server.URL + "/style.css?v=2"); !ok || got != "body{}" {
+		t.Errorf("expected HTTPS response to be recorded, got %v", store.files)
+	}
+}
+
+func TestProxy_Tunnel(t *testing.T) {
+	server := httptest.NewTLSServer(site())
+	defer server.Close()
+	_, store, client := newTestProxy(t, server, nil)
+	client.Transport.(*http.Transport).TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+
+	resp, err := client.Get(server.URL + "/")
+	if err != nil {
+		t.Fatalf("GET through tunnel: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(store.files) != 0 {
+		t.Errorf("expected tunnel without recording, got %d and %v", resp.StatusCode, store.files)
+	}
+}
+
+func TestProxy_NotAProxyRequest(t *testing.T) {
+	p := New(&memStorage{files: make(map[string]string)})
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestCA_SaveLoad(t *testing.T) {
+	ca, err := NewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem")
+	if err = ca.Save(certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadCA(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("LoadCA returned error: %v", err)
+	}
+	if !loaded.Cert.Equal(ca.Cert) {
+		t.Error("loaded certificate differs")
+	}
+
+	leaf, err := loaded.Certificate("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(leaf.Certificate[0])
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+	if _, err = cert.Verify(x509.VerifyOptions{DNSName: "example.com", Roots: roots}); err != nil {
+		t.Errorf("leaf certificate does not verify: %v", err)
+	}
+	if _, err = LoadCA(keyFile, certFile); !errors.Is(err, ErrInvalidCA) {
+		t.Errorf("expected ErrInvalidCA for swapped files, got %v", err)
+	}
+}
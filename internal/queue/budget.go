@@ -0,0 +1,165 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMaxPages       = errors.New("max pages budget exhausted")
+	ErrMaxBytes       = errors.New("max bytes budget exhausted")
+	ErrMaxDuration    = errors.New("max duration budget exhausted")
+	ErrMIMEBytesLimit = errors.New("per-MIME bytes budget exhausted")
+)
+
+// Budget ограничивает обход; нулевые значения означают отсутствие лимита.
+// MaxPages считает страницы, принятые в очередь, а не скачанные: в него входят
+// и страницы, ответившие ошибкой. Очередь принимает только стартовый хост,
+// поэтому отдельный лимит на хост не нужен.
+// MaxBytesPerMIME принимает ключи вида "image/png" или "image/*".
+type Budget struct {
+	MaxPages        int
+	MaxBytes        int64
+	MaxBytesPerMIME map[string]int64
+	MaxDuration     time.Duration
+}
+
+type budgetTracker struct {
+	Budget
+	deadline  time.Time
+	pages     int
+	bytes     int64
+	mimeBytes map[string]int64
+	stopErr   error
+	hits      []error
+	hitSeen   map[string]bool
+}
+
+func newBudgetTracker(b Budget, now time.Time) *budgetTracker {
+	t := &budgetTracker{
+		Budget:    b,
+		mimeBytes: make(map[string]int64),
+		hitSeen:   make(map[string]bool),
+	}
+	if b.MaxDuration > 0 {
+		t.deadline = now.Add(b.MaxDuration)
+	}
+	return t
+}
+
+func (t *budgetTracker) hit(err error) error {
+	if !t.hitSeen[err.Error()] {
+		t.hitSeen[err.Error()] = true
+		t.hits = append(t.hits, err)
+	}
+	return err
+}
+
+func (t *budgetTracker) stop(err error) error {
+	if t.stopErr == nil {
+		t.stopErr = t.hit(err)
+	}
+	return t.stopErr
+}
+
+func (t *budgetTracker) checkDeadline(now time.Time) error {
+	if t.stopErr != nil {
+		return t.stopErr
+	}
+	if !t.deadline.IsZero() && !now.Before(t.deadline) {
+		return t.stop(fmt.Errorf("%w: %s", ErrMaxDuration, t.MaxDuration))
+	}
+	return nil
+}
+
+// admit учитывает новую задачу, вызывается под мьютексом очереди.
+// Лимит страниц распространяется только на задачи KindPage.
+func (t *budgetTracker) admit(kind Kind, now time.Time) error {
+	if err := t.checkDeadline(now); err != nil {
+		return err
+	}
+	if kind != KindPage {
+		return nil
+	}
+	if t.MaxPages > 0 && t.pages >= t.MaxPages {
+		return t.hit(fmt.Errorf("%w: %d", ErrMaxPages, t.MaxPages))
+	}
+	t.pages++
+	return nil
+}
+
+func (t *budgetTracker) addBytes(contentType string, n int64) error {
+	t.bytes += n
+	if t.MaxBytes > 0 && t.bytes >= t.MaxBytes {
+		return t.stop(fmt.Errorf("%w: %d", ErrMaxBytes, t.MaxBytes))
+	}
+
+	key, limit := t.mimeLimit(contentType)
+	if limit <= 0 {
+		return nil
+	}
+	if t.mimeBytes[key] >= limit {
+		return t.hit(fmt.Errorf("%w: %s: %d", ErrMIMEBytesLimit, key, limit))
+	}
+	t.mimeBytes[key] += n
+	return nil
+}
+
+func (t *budgetTracker) mimeLimit(contentType string) (string, int64) {
+	if len(t.MaxBytesPerMIME) == 0 {
+		return "", 0
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.TrimSpace(strings.Split(contentType, ";")[0])
+	}
+	if limit, ok := t.MaxBytesPerMIME[mediaType]; ok {
+		return mediaType, limit
+	}
+	major, _, _ := strings.Cut(mediaType, "/")
+	wildcard := major + "/*"
+	if limit, ok := t.MaxBytesPerMIME[wildcard]; ok {
+		return wildcard, limit
+	}
+	return "", 0
+}
+
+func (q *Queue) SetBudget(b Budget) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.budget = newBudgetTracker(b, time.Now())
+}
+
+// AddBytes учитывает скачанное тело. ErrMIMEBytesLimit означает, что тело этого типа
+// сохранять не нужно, остальные ошибки бюджета останавливают обход.
+func (q *Queue) AddBytes(contentType string, n int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.budget == nil {
+		return nil
+	}
+	return q.budget.addBytes(contentType, n)
+}
+
+// Stopped возвращает ошибку бюджета, после которой оставшиеся задачи нужно пропускать.
+func (q *Queue) Stopped() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.budget == nil {
+		return nil
+	}
+	return q.budget.checkDeadline(time.Now())
+}
+
+// BudgetHits возвращает сработавшие бюджеты в порядке срабатывания.
+func (q *Queue) BudgetHits() []error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.budget == nil {
+		return nil
+	}
+	return append([]error(nil), q.budget.hits...)
+}
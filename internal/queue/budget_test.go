@@ -0,0 +1,151 @@
+package queue
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestBudget_MaxPages(t *testing.T) {
+	t.Parallel()
+
+	q := NewQueue(10, "example.com")
+	q.SetBudget(Budget{MaxPages: 2})
+
+	for i, want := range []error{nil, nil, ErrMaxPages} {
+		u, _ := url.Parse("https://example.com/page" + string(rune('0'+i)))
+		err := q.Enqueue(Task{URL: u, Depth: 1, Kind: KindPage}, 5)
+		if !errors.Is(err, want) {
+			t.Errorf("Enqueue %d: got %v, want %v", i, err, want)
+		}
+	}
+
+	if err := q.Stopped(); err != nil {
+		t.Errorf("max pages should not drop queued tasks, got %v", err)
+	}
+	hits := q.BudgetHits()
+	if len(hits) != 1 || !errors.Is(hits[0], ErrMaxPages) {
+		t.Errorf("unexpected budget hits %v", hits)
+	}
+}
+
+func TestBudget_MaxBytes(t *testing.T) {
+	t.Parallel()
+
+	q := NewQueue(10, "example.com")
+	q.SetBudget(Budget{MaxBytes: 100})
+
+	if err := q.AddBytes("text/html", 60); err != nil {
+		t.Fatalf("AddBytes returned error: %v", err)
+	}
+	if err := q.AddBytes("text/html", 60); !errors.Is(err, ErrMaxBytes) {
+		t.Errorf("expected ErrMaxBytes, got %v", err)
+	}
+	if err := q.Stopped(); !errors.Is(err, ErrMaxBytes) {
+		t.Errorf("expected queue stopped with ErrMaxBytes, got %v", err)
+	}
+
+	u, _ := url.Parse("https://example.com/late")
+	if err := q.Enqueue(Task{URL: u, Depth: 1, Kind: KindPage}, 5); !errors.Is(err, ErrMaxBytes) {
+		t.Errorf("expected Enqueue to be rejected after stop, got %v", err)
+	}
+}
+
+func TestBudget_MaxBytesPerMIME(t *testing.T) {
+	t.Parallel()
+
+	q := NewQueue(10, "example.com")
+	q.SetBudget(Budget{MaxBytesPerMIME: map[string]int64{"image/*": 100, "text/css": 10}})
+
+	tests := []struct {
+		contentType string
+		n           int64
+		want        error
+	}{
+		{"image/png", 80, nil},
+		{"image/jpeg", 30, nil},
+		{"image/png", 1, ErrMIMEBytesLimit},
+		{"text/css; charset=utf-8", 20, nil},
+		{"text/css", 1, ErrMIMEBytesLimit},
+		{"text/html", 1000, nil},
+	}
+
+	for _, tt := range tests {
+		if err := q.AddBytes(tt.contentType, tt.n); !errors.Is(err, tt.want) {
+			t.Errorf("AddBytes(%q, %d) = %v, want %v", tt.contentType, tt.n, err, tt.want)
+		}
+	}
+
+	if err := q.Stopped(); err != nil {
+		t.Errorf("MIME budget should not stop the crawl, got %v", err)
+	}
+	if hits := q.BudgetHits(); len(hits) != 2 {
+		t.Errorf("expected 2 budget hits, got %v", hits)
+	}
+}
+
+func TestBudget_MaxDuration(t *testing.T) {
+	t.Parallel()
+
+	q := NewQueue(10, "example.com")
+	q.SetBudget(Budget{MaxDuration: 20 * time.Millisecond})
+
+	if err := q.Stopped(); err != nil {
+		t.Fatalf("expected queue running, got %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err := q.Stopped(); !errors.Is(err, ErrMaxDuration) {
+		t.Errorf("expected ErrMaxDuration, got %v", err)
+	}
+}
+
+func TestBudget_FullQueueDoesNotConsumeBudget(t *testing.T) {
+	t.Parallel()
+
+	q := NewQueue(1, "example.com")
+	q.SetBudget(Budget{MaxPages: 2})
+
+	for _, path := range []string{"/a", "/b"} {
+		u, _ := url.Parse("https://example.com" + path)
+		_ = q.Enqueue(Task{URL: u, Depth: 1, Kind: KindPage}, 5)
+	}
+	<-q.tasks
+	waitPending(t, q, 0)
+
+	u, _ := url.Parse("https://example.com/c")
+	if err := q.Enqueue(Task{URL: u, Depth: 1, Kind: KindPage}, 5); err != nil {
+		t.Errorf("expected budget slot to be released after ErrQueueFull, got %v", err)
+	}
+}
+
+func waitPending(t *testing.T, q *Queue, want int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		q.mu.Lock()
+		pending := q.pending
+		q.mu.Unlock()
+		if pending == want {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("pending tasks did not reach %d", want)
+}
+
+func TestBudget_ResourcesDoNotCountAsPages(t *testing.T) {
+	t.Parallel()
+
+	q := NewQueue(10, "example.com")
+	q.SetBudget(Budget{MaxPages: 1})
+
+	page, _ := url.Parse("https://example.com/page")
+	style, _ := url.Parse("https://example.com/style.css")
+	if err := q.Enqueue(Task{URL: page, Depth: 1, Kind: KindPage}, 5); err != nil {
+		t.Fatalf("page Enqueue returned error: %v", err)
+	}
+	if err := q.Enqueue(Task{URL: style, Depth: 2, Kind: KindResource}, 5); err != nil {
+		t.Errorf("resource Enqueue returned error: %v", err)
+	}
+}
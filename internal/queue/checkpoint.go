@@ -0,0 +1,134 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"site-mirror/internal/metrics"
+	"sort"
+)
+
+const DefaultCheckpointFile = "crawl-checkpoint.json"
+
+type CheckpointTask struct {
+	URL      string  `json:"url"`
+	Parent   string  `json:"parent,omitempty"`
+	Depth    int     `json:"depth"`
+	Kind     string  `json:"kind"`
+	Priority float64 `json:"priority,omitempty"`
+}
+
+// Checkpoint - состояние остановленного обхода: невыполненные задачи и посещённые URL.
+type Checkpoint struct {
+	Tasks   []CheckpointTask `json:"tasks"`
+	Visited []string         `json:"visited"`
+}
+
+func ParseKind(s string) (Kind, error) {
+	switch s {
+	case "page":
+		return KindPage, nil
+	case "resource":
+		return KindResource, nil
+	default:
+		return 0, fmt.Errorf("unknown task kind %q", s)
+	}
+}
+
+// Checkpoint забирает из очереди все невыданные и отложенные задачи. Вызывается после Halt
+// и завершения воркеров, очередь после этого пуста.
+func (q *Queue) Checkpoint() Checkpoint {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var cp Checkpoint
+	var tasks []Task
+	for {
+		t, ok := q.frontier.Pop()
+		if !ok {
+			break
+		}
+		q.pending--
+		tasks = append(tasks, t)
+	}
+	for host, parked := range q.parked {
+		tasks = append(tasks, parked...)
+		delete(q.parked, host)
+	}
+	for _, t := range tasks {
+		ct := CheckpointTask{URL: t.URL.String(), Depth: t.Depth, Kind: t.Kind.String(), Priority: t.Priority}
+		if t.Parent != nil {
+			ct.Parent = t.Parent.String()
+		}
+		cp.Tasks = append(cp.Tasks, ct)
+	}
+	for u := range q.visited {
+		cp.Visited = append(cp.Visited, u)
+	}
+	sort.Strings(cp.Visited)
+	return cp
+}
+
+// Restore ставит в очередь задачи из контрольной точки в обход фильтров и бюджетов
+// и помечает её URL посещёнными.
+func (q *Queue) Restore(cp Checkpoint) error {
+	tasks := make([]Task, 0, len(cp.Tasks))
+	for _, ct := range cp.Tasks {
+		t, err := ct.task()
+		if err != nil {
+			return err
+		}
+		tasks = append(tasks, t)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, u := range cp.Visited {
+		q.visited[u] = true
+	}
+	q.metrics.Set(metrics.VisitedURLs, float64(len(q.visited)))
+	for _, t := range tasks {
+		q.visited[t.URL.String()] = true
+		q.push(t)
+	}
+	return nil
+}
+
+func (ct CheckpointTask) task() (Task, error) {
+	u, err := url.Parse(ct.URL)
+	if err != nil {
+		return Task{}, err
+	}
+	kind, err := ParseKind(ct.Kind)
+	if err != nil {
+		return Task{}, err
+	}
+	t := Task{URL: u, Depth: ct.Depth, Kind: kind, Priority: ct.Priority}
+	if ct.Parent != "" {
+		if t.Parent, err = url.Parse(ct.Parent); err != nil {
+			return Task{}, err
+		}
+	}
+	return t, nil
+}
+
+func WriteCheckpoint(path string, cp Checkpoint) error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func ReadCheckpoint(path string) (Checkpoint, error) {
+	var cp Checkpoint
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cp, err
+	}
+	if err = json.Unmarshal(data, &cp); err != nil {
+		return cp, fmt.Errorf("invalid checkpoint %s: %w", path, err)
+	}
+	return cp, nil
+}
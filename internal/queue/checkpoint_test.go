@@ -0,0 +1,211 @@
+package queue
+
+import (
+	"errors"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+func receive(t *testing.T, q *Queue) (Task, bool) {
+	t.Helper()
+	select {
+	case task, ok := <-q.Dequeue():
+		return task, ok
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the dispatcher")
+		return Task{}, false
+	}
+}
+
+func TestQueue_PauseResume(t *testing.T) {
+	t.Parallel()
+
+	q := NewQueue(10, "example.com")
+	q.Pause()
+	if err := q.Enqueue(newTask(t, "https://example.com/a", 0, KindPage), 5); err != nil {
+		t.Fatalf("Enqueue returned error: %v", err)
+	}
+
+	select {
+	case task := <-q.Dequeue():
+		t.Fatalf("paused queue handed out %s", task.URL)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if !q.Paused() {
+		t.Error("expected queue to report paused")
+	}
+
+	q.Resume()
+	task, ok := receive(t, q)
+	if !ok || task.URL.Path != "/a" {
+		t.Errorf("expected /a after resume, got %v %v", task.URL, ok)
+	}
+}
+
+func TestQueue_AddExcludeDropsQueued(t *testing.T) {
+	t.Parallel()
+
+	q := NewQueue(10, "example.com")
+	q.Pause()
+	for _, raw := range []string{"https://example.com/private/a", "https://example.com/b"} {
+		if err := q.Enqueue(newTask(t, raw, 1, KindPage), 5); err != nil {
+			t.Fatalf("Enqueue returned error: %v", err)
+		}
+	}
+
+	q.AddExclude(KindPage, regexp.MustCompile("/private/"))
+	q.Resume()
+
+	task, _ := receive(t, q)
+	if task.URL.Path != "/b" {
+		t.Errorf("expected excluded task to be dropped, got %s", task.URL.Path)
+	}
+	q.Done()
+	q.WaitAndClose()
+
+	if err := q.Enqueue(newTask(t, "https://example.com/private/c", 1, KindPage), 5); !errors.Is(err, ErrFiltered) {
+		t.Errorf("expected ErrFiltered for new task, got %v", err)
+	}
+}
+
+func TestQueue_HaltCheckpointRestore(t *testing.T) {
+	t.Parallel()
+
+	q := NewQueue(10, "example.com")
+	q.Pause()
+	for _, raw := range []string{"https://example.com/a", "https://example.com/b"} {
+		if err := q.Enqueue(newTask(t, raw, 1, KindPage), 5); err != nil {
+			t.Fatalf("Enqueue returned error: %v", err)
+		}
+	}
+
+	q.Halt()
+	if _, ok := receive(t, q); ok {
+		t.Fatal("expected tasks channel to close after Halt")
+	}
+	q.WaitAndClose()
+
+	// Задачи, найденные воркерами после остановки, тоже попадают в контрольную точку.
+	res := newTask(t, "https://example.com/style.css", 2, KindResource)
+	res.Parent = newTask(t, "https://example.com/a", 1, KindPage).URL
+	if err := q.Enqueue(res, 5); err != nil {
+		t.Fatalf("Enqueue after Halt returned error: %v", err)
+	}
+
+	cp := q.Checkpoint()
+	if len(cp.Tasks) != 3 || len(cp.Visited) != 3 {
+		t.Fatalf("unexpected checkpoint %+v", cp)
+	}
+
+	path := filepath.Join(t.TempDir(), DefaultCheckpointFile)
+	if err := WriteCheckpoint(path, cp); err != nil {
+		t.Fatalf("WriteCheckpoint returned error: %v", err)
+	}
+	loaded, err := ReadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("ReadCheckpoint returned error: %v", err)
+	}
+
+	restored := NewQueue(10, "example.com")
+	if err = restored.Restore(loaded); err != nil {
+		t.Fatalf("Restore returned error: %v", err)
+	}
+	if err = restored.Enqueue(newTask(t, "https://example.com/a", 1, KindPage), 5); !errors.Is(err, ErrURLisVisited) {
+		t.Errorf("expected restored URL to be visited, got %v", err)
+	}
+
+	got := map[string]Task{}
+	for range 3 {
+		task, _ := receive(t, restored)
+		got[task.URL.Path] = task
+		restored.Done()
+	}
+	css := got["/style.css"]
+	if css.Kind != KindResource || css.Parent == nil || css.Parent.Path != "/a" {
+		t.Errorf("resource task not restored: %+v", css)
+	}
+	restored.WaitAndClose()
+}
+
+func TestQueue_ParkUnpark(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	down := map[string]bool{"down.example.com": true}
+	ready := func(host string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return !down[host]
+	}
+
+	q := NewQueue(10, "down.example.com")
+	q.SetGate(ready)
+	if err := q.Enqueue(newTask(t, "https://down.example.com/a", 1, KindPage), 5); err != nil {
+		t.Fatalf("Enqueue returned error: %v", err)
+	}
+
+	select {
+	case task := <-q.Dequeue():
+		t.Fatalf("task of a closed host was handed out: %s", task.URL)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	mu.Lock()
+	down["down.example.com"] = false
+	mu.Unlock()
+	if n := q.Unpark("down.example.com"); n != 1 {
+		t.Fatalf("expected 1 unparked task, got %d", n)
+	}
+	task, _ := receive(t, q)
+
+	// Воркер получил отказ выключателя и откладывает задачу снова.
+	mu.Lock()
+	down["down.example.com"] = true
+	mu.Unlock()
+	q.Park(task)
+	q.Done()
+
+	closed := make(chan struct{})
+	go func() {
+		q.WaitAndClose()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("parked task should hold WaitAndClose")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	dropped := q.DropParked("down.example.com")
+	if len(dropped) != 1 || dropped[0].URL.Path != "/a" {
+		t.Fatalf("unexpected dropped tasks %v", dropped)
+	}
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("WaitAndClose did not return after parked tasks were dropped")
+	}
+}
+
+func TestQueue_ParkReturnsTaskWhenHostReady(t *testing.T) {
+	t.Parallel()
+
+	q := NewQueue(10, "example.com")
+	q.SetGate(func(string) bool { return true })
+	if err := q.Enqueue(newTask(t, "https://example.com/a", 1, KindPage), 5); err != nil {
+		t.Fatalf("Enqueue returned error: %v", err)
+	}
+	task, _ := receive(t, q)
+	q.Park(task)
+	q.Done()
+
+	again, _ := receive(t, q)
+	if again.URL.Path != "/a" {
+		t.Errorf("expected parked task to be handed out again, got %s", again.URL)
+	}
+	q.Done()
+	q.WaitAndClose()
+}
@@ -0,0 +1,178 @@
+package queue
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ErrUnknownOrder = errors.New("unknown crawl order")
+
+const (
+	OrderBFS      = "bfs"
+	OrderDFS      = "dfs"
+	OrderPriority = "priority"
+)
+
+// Frontier хранит задачи, ожидающие выдачи воркерам, и определяет порядок обхода.
+// Вызовы сериализуются мьютексом очереди.
+type Frontier interface {
+	Push(t Task)
+	Pop() (Task, bool)
+	Len() int
+}
+
+func NewFrontier(order string, score ScoreFunc) (Frontier, error) {
+	switch order {
+	case OrderBFS, "":
+		return NewBFSFrontier(), nil
+	case OrderDFS:
+		return NewDFSFrontier(), nil
+	case OrderPriority:
+		return NewPriorityFrontier(score), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownOrder, order)
+	}
+}
+
+type item struct {
+	task  Task
+	score float64
+	seq   uint64
+}
+
+type itemHeap struct {
+	items []item
+	less  func(a, b item) bool
+}
+
+func (h *itemHeap) Len() int           { return len(h.items) }
+func (h *itemHeap) Less(i, j int) bool { return h.less(h.items[i], h.items[j]) }
+func (h *itemHeap) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *itemHeap) Push(x any)         { h.items = append(h.items, x.(item)) }
+func (h *itemHeap) Pop() any {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
+
+type heapFrontier struct {
+	h     *itemHeap
+	score ScoreFunc
+	seq   uint64
+}
+
+func (f *heapFrontier) Push(t Task) {
+	f.seq++
+	it := item{task: t, seq: f.seq}
+	if f.score != nil {
+		it.score = f.score(t)
+	}
+	heap.Push(f.h, it)
+}
+
+func (f *heapFrontier) Pop() (Task, bool) {
+	if f.h.Len() == 0 {
+		return Task{}, false
+	}
+	return heap.Pop(f.h).(item).task, true
+}
+
+func (f *heapFrontier) Len() int {
+	return f.h.Len()
+}
+
+// NewBFSFrontier выдаёт задачи строго по возрастанию глубины, внутри уровня - в порядке добавления.
+func NewBFSFrontier() Frontier {
+	return &heapFrontier{h: &itemHeap{less: func(a, b item) bool {
+		if a.task.Depth != b.task.Depth {
+			return a.task.Depth < b.task.Depth
+		}
+		return a.seq < b.seq
+	}}}
+}
+
+// NewDFSFrontier выдаёт последнюю добавленную задачу первой.
+func NewDFSFrontier() Frontier {
+	return &heapFrontier{h: &itemHeap{less: func(a, b item) bool {
+		return a.seq > b.seq
+	}}}
+}
+
+// NewPriorityFrontier выдаёт задачу с наибольшей оценкой, при равенстве - раньше добавленную.
+func NewPriorityFrontier(score ScoreFunc) Frontier {
+	if score == nil {
+		score = Scorer{}.Score
+	}
+	return &heapFrontier{score: score, h: &itemHeap{less: func(a, b item) bool {
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		return a.seq < b.seq
+	}}}
+}
+
+type ScoreFunc func(t Task) float64
+
+type PatternWeight struct {
+	Pattern *regexp.Regexp
+	Weight  float64
+}
+
+// Scorer - оценка по умолчанию для приоритетного обхода.
+// Task.Priority (например, из sitemap) умножается на PriorityWeight,
+// за каждый сегмент пути вычитается PathDepthWeight, к совпавшим шаблонам
+// добавляется их вес, ресурсы получают ResourceBonus.
+type Scorer struct {
+	PriorityWeight  float64
+	PathDepthWeight float64
+	Patterns        []PatternWeight
+	ResourceBonus   float64
+}
+
+func (s Scorer) Score(t Task) float64 {
+	score := t.Priority * s.PriorityWeight
+	if t.URL != nil {
+		path := strings.Trim(t.URL.Path, "/")
+		if path != "" {
+			score -= float64(strings.Count(path, "/")+1) * s.PathDepthWeight
+		}
+		for _, p := range s.Patterns {
+			if p.Pattern.MatchString(t.URL.String()) {
+				score += p.Weight
+			}
+		}
+	}
+	if t.Kind == KindResource {
+		score += s.ResourceBonus
+	}
+	return score
+}
+
+// ParsePatternWeights разбирает строку вида "/docs/=10,\.pdf$=-5".
+func ParsePatternWeights(s string) ([]PatternWeight, error) {
+	var weights []PatternWeight
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		idx := strings.LastIndex(part, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid pattern weight %q", part)
+		}
+		re, err := regexp.Compile(part[:idx])
+		if err != nil {
+			return nil, err
+		}
+		w, err := strconv.ParseFloat(part[idx+1:], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern weight %q: %w", part, err)
+		}
+		weights = append(weights, PatternWeight{Pattern: re, Weight: w})
+	}
+	return weights, nil
+}
@@ -0,0 +1,168 @@
+package queue
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func newTask(t *testing.T, raw string, depth int, kind Kind) Task {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("failed to parse URL %s: %v", raw, err)
+	}
+	return Task{URL: u, Depth: depth, Kind: kind}
+}
+
+func drain(f Frontier) []string {
+	var got []string
+	for {
+		task, ok := f.Pop()
+		if !ok {
+			return got
+		}
+		got = append(got, task.URL.Path)
+	}
+}
+
+func assertOrder(t *testing.T, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestBFSFrontier(t *testing.T) {
+	t.Parallel()
+
+	f := NewBFSFrontier()
+	f.Push(newTask(t, "https://example.com/d2a", 2, KindPage))
+	f.Push(newTask(t, "https://example.com/d1a", 1, KindPage))
+	f.Push(newTask(t, "https://example.com/d2b", 2, KindPage))
+	f.Push(newTask(t, "https://example.com/d1b", 1, KindPage))
+	f.Push(newTask(t, "https://example.com/d0", 0, KindPage))
+
+	if f.Len() != 5 {
+		t.Errorf("Len() = %d, want 5", f.Len())
+	}
+	assertOrder(t, drain(f), []string{"/d0", "/d1a", "/d1b", "/d2a", "/d2b"})
+}
+
+func TestDFSFrontier(t *testing.T) {
+	t.Parallel()
+
+	f := NewDFSFrontier()
+	f.Push(newTask(t, "https://example.com/a", 1, KindPage))
+	f.Push(newTask(t, "https://example.com/b", 1, KindPage))
+	f.Push(newTask(t, "https://example.com/b/c", 2, KindPage))
+
+	assertOrder(t, drain(f), []string{"/b/c", "/b", "/a"})
+}
+
+func TestPriorityFrontier(t *testing.T) {
+	t.Parallel()
+
+	scorer := Scorer{
+		PriorityWeight:  10,
+		PathDepthWeight: 1,
+		Patterns:        []PatternWeight{{Pattern: regexp.MustCompile(`/docs/`), Weight: 5}},
+		ResourceBonus:   100,
+	}
+	f := NewPriorityFrontier(scorer.Score)
+
+	sitemap := newTask(t, "https://example.com/news/2024/item", 3, KindPage)
+	sitemap.Priority = 0.9
+	f.Push(newTask(t, "https://example.com/blog/a/b/c", 1, KindPage))
+	f.Push(newTask(t, "https://example.com/docs/intro", 1, KindPage))
+	f.Push(sitemap)
+	f.Push(newTask(t, "https://example.com/style.css", 2, KindResource))
+	f.Push(newTask(t, "https://example.com/about", 1, KindPage))
+
+	assertOrder(t, drain(f), []string{"/style.css", "/news/2024/item", "/docs/intro", "/about", "/blog/a/b/c"})
+}
+
+func TestNewFrontier(t *testing.T) {
+	t.Parallel()
+
+	for _, order := range []string{"", OrderBFS, OrderDFS, OrderPriority} {
+		if _, err := NewFrontier(order, nil); err != nil {
+			t.Errorf("NewFrontier(%q) returned error: %v", order, err)
+		}
+	}
+	if _, err := NewFrontier("random", nil); !errors.Is(err, ErrUnknownOrder) {
+		t.Errorf("expected ErrUnknownOrder, got %v", err)
+	}
+}
+
+func TestParsePatternWeights(t *testing.T) {
+	t.Parallel()
+
+	weights, err := ParsePatternWeights(`/docs/=10, \.pdf$=-2.5`)
+	if err != nil {
+		t.Fatalf("ParsePatternWeights returned error: %v", err)
+	}
+	if len(weights) != 2 {
+		t.Fatalf("got %d weights, want 2", len(weights))
+	}
+	if weights[0].Pattern.String() != "/docs/" || weights[0].Weight != 10 {
+		t.Errorf("unexpected first weight %+v", weights[0])
+	}
+	if weights[1].Pattern.String() != `\.pdf$` || weights[1].Weight != -2.5 {
+		t.Errorf("unexpected second weight %+v", weights[1])
+	}
+
+	for _, bad := range []string{"/docs/", "/docs/=high", "([=1"} {
+		if _, err := ParsePatternWeights(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestQueue_DispatchOrder(t *testing.T) {
+	t.Parallel()
+
+	q := NewQueueWithFrontier(10, "example.com", NewBFSFrontier())
+	first := newTask(t, "https://example.com/first", 0, KindPage)
+	if err := q.Enqueue(first, 5); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	// Первая задача уже может быть у диспетчера, поэтому порядок проверяем для остальных.
+	deadline := time.Now().Add(time.Second)
+	for {
+		q.mu.Lock()
+		held := q.frontier.Len() == 0
+		q.mu.Unlock()
+		if held {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("dispatcher did not pick up the first task")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for _, task := range []Task{
+		newTask(t, "https://example.com/deep", 3, KindPage),
+		newTask(t, "https://example.com/mid", 2, KindPage),
+		newTask(t, "https://example.com/shallow", 1, KindPage),
+	} {
+		if err := q.Enqueue(task, 5); err != nil {
+			t.Fatalf("Enqueue failed: %v", err)
+		}
+	}
+
+	var got []string
+	for range 4 {
+		task := <-q.Dequeue()
+		got = append(got, task.URL.Path)
+		q.Done()
+	}
+	assertOrder(t, got, []string{"/first", "/shallow", "/mid", "/deep"})
+}
@@ -3,7 +3,10 @@ package queue
 import (
 	"errors"
 	"net/url"
+	"regexp"
+	"site-mirror/internal/metrics"
 	"sync"
+	"time"
 )
 
 var (
@@ -11,27 +14,164 @@ var (
 	ErrDepthLimit     = errors.New("depth limit")
 	ErrURLisVisited   = errors.New("URL is visited")
 	ErrQueueFull      = errors.New("queue is full")
+	ErrFiltered       = errors.New("URL is filtered")
 )
 
+type Kind int
+
+const (
+	KindPage Kind = iota
+	KindResource
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindPage:
+		return "page"
+	case KindResource:
+		return "resource"
+	default:
+		return "unknown"
+	}
+}
+
+// Filter отбирает URL задач одного вида: при непустом Include URL должен совпасть
+// хотя бы с одним шаблоном, совпадение с Exclude отбрасывает URL.
+type Filter struct {
+	Include []*regexp.Regexp
+	Exclude []*regexp.Regexp
+}
+
+func (f Filter) Allows(u *url.URL) bool {
+	s := u.String()
+	for _, re := range f.Exclude {
+		if re.MatchString(s) {
+			return false
+		}
+	}
+	if len(f.Include) == 0 {
+		return true
+	}
+	for _, re := range f.Include {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
 type Task struct {
-	URL   *url.URL
-	Depth int
-	Type  string
+	URL      *url.URL
+	Parent   *url.URL
+	Depth    int
+	Kind     Kind
+	Priority float64
 }
 
 type Queue struct {
+	frontier    Frontier
 	tasks       chan Task
+	wake        chan struct{}
+	capacity    int
+	pending     int
+	closed      bool
+	paused      bool
+	halted      bool
 	visited     map[string]bool
 	mu          sync.Mutex
 	activeTasks sync.WaitGroup
 	domain      string
+	budget      *budgetTracker
+	filters     map[Kind]Filter
+	metrics     metrics.Metrics
+	gate        func(host string) bool
+	parked      map[string][]Task
 }
 
 func NewQueue(capacity int, domain string) *Queue {
-	return &Queue{
-		tasks:   make(chan Task, capacity),
-		visited: make(map[string]bool),
-		domain:  domain,
+	return NewQueueWithFrontier(capacity, domain, NewBFSFrontier())
+}
+
+func NewQueueWithFrontier(capacity int, domain string, f Frontier) *Queue {
+	q := &Queue{
+		frontier: f,
+		tasks:    make(chan Task),
+		wake:     make(chan struct{}, 1),
+		capacity: capacity,
+		visited:  make(map[string]bool),
+		domain:   domain,
+		filters:  make(map[Kind]Filter),
+		metrics:  metrics.Nop{},
+		parked:   make(map[string][]Task),
+	}
+	go q.dispatch()
+	return q
+}
+
+// dispatch передаёт задачи из frontier воркерам по одной, чтобы порядок
+// определялся стратегией обхода, а не буфером канала.
+func (q *Queue) dispatch() {
+	for {
+		q.mu.Lock()
+		if q.halted {
+			q.mu.Unlock()
+			close(q.tasks)
+			return
+		}
+		var t Task
+		ok := false
+		if !q.paused {
+			t, ok = q.popAllowed()
+		}
+		closed := q.closed
+		q.mu.Unlock()
+
+		if !ok {
+			if closed {
+				close(q.tasks)
+				return
+			}
+			<-q.wake
+			continue
+		}
+
+		q.tasks <- t
+		q.mu.Lock()
+		q.pending--
+		q.metrics.Set(metrics.QueueDepth, float64(q.pending))
+		q.mu.Unlock()
+	}
+}
+
+// popAllowed достаёт следующую задачу, отбрасывая те, что перестали проходить
+// фильтр после добавления исключений во время обхода, и откладывая задачи
+// хостов, закрытых для выдачи.
+func (q *Queue) popAllowed() (Task, bool) {
+	for {
+		t, ok := q.frontier.Pop()
+		if !ok {
+			return Task{}, false
+		}
+		if f, exists := q.filters[t.Kind]; exists && !f.Allows(t.URL) {
+			q.pending--
+			q.metrics.Set(metrics.QueueDepth, float64(q.pending))
+			q.activeTasks.Done()
+			continue
+		}
+		if q.gate != nil && !q.gate(t.URL.Host) {
+			q.pending--
+			q.metrics.Set(metrics.QueueDepth, float64(q.pending))
+			q.park(t)
+			continue
+		}
+		return t, true
+	}
+}
+
+func (q *Queue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
 	}
 }
 
@@ -40,27 +180,184 @@ func (q *Queue) Enqueue(t Task, maxDepth int) error {
 		return ErrExternalDomain
 	}
 
-	if t.Depth > maxDepth {
+	// Ресурсы - это зависимости уже принятой страницы, поэтому глубину не расходуют.
+	if t.Kind == KindPage && t.Depth > maxDepth {
 		return ErrDepthLimit
 	}
 
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
+	if f, ok := q.filters[t.Kind]; ok && !f.Allows(t.URL) {
+		return ErrFiltered
+	}
+
 	urlStr := t.URL.String()
 	if _, exists := q.visited[urlStr]; exists {
 		return ErrURLisVisited
 	} else {
 		q.visited[urlStr] = true
+		q.metrics.Set(metrics.VisitedURLs, float64(len(q.visited)))
 	}
 
-	select {
-	case q.tasks <- t:
-		q.activeTasks.Add(1)
-		return nil
-	default:
+	if q.pending >= q.capacity {
 		return ErrQueueFull
 	}
+
+	if q.budget != nil {
+		if err := q.budget.admit(t.Kind, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	q.push(t)
+	return nil
+}
+
+func (q *Queue) push(t Task) {
+	q.frontier.Push(t)
+	q.pending++
+	q.metrics.Set(metrics.QueueDepth, float64(q.pending))
+	// После Halt задачи только копятся для контрольной точки, завершения обхода они не задерживают.
+	if !q.halted {
+		q.activeTasks.Add(1)
+	}
+	q.signal()
+}
+
+func (q *Queue) SetMetrics(m metrics.Metrics) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.metrics = m
+}
+
+func (q *Queue) SetFilter(kind Kind, f Filter) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.filters[kind] = f
+}
+
+// AddExclude добавляет исключение к фильтру задач вида kind. Оно действует и на
+// уже поставленные в очередь задачи: они отбрасываются при выдаче.
+func (q *Queue) AddExclude(kind Kind, re *regexp.Regexp) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	f := q.filters[kind]
+	f.Exclude = append(f.Exclude[:len(f.Exclude):len(f.Exclude)], re)
+	q.filters[kind] = f
+}
+
+// Pause приостанавливает выдачу задач воркерам, уже выданные дорабатывают.
+func (q *Queue) Pause() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.paused = true
+}
+
+func (q *Queue) Resume() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.paused = false
+	q.signal()
+}
+
+func (q *Queue) Paused() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.paused
+}
+
+// Halt прекращает выдачу задач: канал Dequeue закрывается, WaitAndClose ждёт только
+// уже выданные задачи. Оставшиеся в очереди задачи сохраняются через Checkpoint.
+func (q *Queue) Halt() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.halted {
+		return
+	}
+	q.halted = true
+	q.activeTasks.Add(-q.frontier.Len() - q.parkedCount())
+	q.signal()
+}
+
+// SetGate задаёт проверку хоста перед выдачей задачи: задачи хостов, для которых
+// gate возвращает false, откладываются до Unpark. gate вызывается под мьютексом очереди.
+func (q *Queue) SetGate(gate func(host string) bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.gate = gate
+}
+
+// Park откладывает выданную воркеру задачу до Unpark её хоста. Воркер, как обычно,
+// вызывает Done: отложенная задача продолжает удерживать WaitAndClose.
+// Если хост уже снова открыт для выдачи, задача сразу возвращается в очередь.
+func (q *Queue) Park(t Task) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.gate == nil || q.gate(t.URL.Host) {
+		q.push(t)
+		return
+	}
+	if !q.halted {
+		q.activeTasks.Add(1)
+	}
+	q.park(t)
+}
+
+func (q *Queue) park(t Task) {
+	q.parked[t.URL.Host] = append(q.parked[t.URL.Host], t)
+	q.metrics.Set(metrics.ParkedTasks, float64(len(q.parked[t.URL.Host])), "host", t.URL.Host)
+}
+
+// Unpark возвращает отложенные задачи хоста в очередь.
+func (q *Queue) Unpark(host string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	tasks := q.parked[host]
+	delete(q.parked, host)
+	q.metrics.Set(metrics.ParkedTasks, 0, "host", host)
+	for _, t := range tasks {
+		q.frontier.Push(t)
+		q.pending++
+	}
+	q.metrics.Set(metrics.QueueDepth, float64(q.pending))
+	q.signal()
+	return len(tasks)
+}
+
+// DropParked снимает отложенные задачи хоста и возвращает их, чтобы вызывающий
+// мог отчитаться о них как о неудачных.
+func (q *Queue) DropParked(host string) []Task {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	tasks := q.parked[host]
+	delete(q.parked, host)
+	q.metrics.Set(metrics.ParkedTasks, 0, "host", host)
+	if !q.halted {
+		q.activeTasks.Add(-len(tasks))
+	}
+	return tasks
+}
+
+func (q *Queue) parkedCount() int {
+	n := 0
+	for _, tasks := range q.parked {
+		n += len(tasks)
+	}
+	return n
+}
+
+func (q *Queue) Halted() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.halted
+}
+
+// Visited сообщает, ставился ли URL в очередь за этот обход.
+func (q *Queue) Visited(u string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.visited[u]
 }
 
 func (q *Queue) Dequeue() <-chan Task {
@@ -77,5 +374,6 @@ func (q *Queue) WaitAndClose() {
 func (q *Queue) Close() {
 	q.mu.Lock()
 	defer q.mu.Unlock()
-	close(q.tasks)
+	q.closed = true
+	q.signal()
 }
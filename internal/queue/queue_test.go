@@ -3,6 +3,7 @@ package queue
 import (
 	"errors"
 	"net/url"
+	"regexp"
 	"sync"
 	"testing"
 	"time"
@@ -22,8 +23,8 @@ func TestNewQueue(t *testing.T) {
 	if q.domain != domain {
 		t.Errorf("domain: got %q, want %q", q.domain, domain)
 	}
-	if cap(q.tasks) != capacity {
-		t.Errorf("tasks channel capacity: got %d, want %d", cap(q.tasks), capacity)
+	if q.capacity != capacity {
+		t.Errorf("capacity: got %d, want %d", q.capacity, capacity)
 	}
 	if q.visited == nil {
 		t.Error("visited map is nil")
@@ -35,7 +36,7 @@ func TestEnqueue_ValidTask(t *testing.T) {
 
 	q := NewQueue(10, "example.com")
 	u, _ := url.Parse("https://example.com/page1")
-	task := Task{URL: u, Depth: 1, Type: "page"}
+	task := Task{URL: u, Depth: 1, Kind: KindPage}
 
 	err := q.Enqueue(task, 5)
 
@@ -59,7 +60,7 @@ func TestEnqueue_ExternalDomain(t *testing.T) {
 
 	q := NewQueue(10, "example.com")
 	u, _ := url.Parse("https://other.com/page1")
-	task := Task{URL: u, Depth: 1, Type: "page"}
+	task := Task{URL: u, Depth: 1, Kind: KindPage}
 
 	err := q.Enqueue(task, 5)
 
@@ -79,7 +80,7 @@ func TestEnqueue_DepthLimit(t *testing.T) {
 
 	q := NewQueue(10, "example.com")
 	u, _ := url.Parse("https://example.com/page1")
-	task := Task{URL: u, Depth: 6, Type: "page"}
+	task := Task{URL: u, Depth: 6, Kind: KindPage}
 
 	err := q.Enqueue(task, 5)
 
@@ -93,7 +94,7 @@ func TestEnqueue_Duplicate(t *testing.T) {
 
 	q := NewQueue(10, "example.com")
 	u, _ := url.Parse("https://example.com/page1")
-	task := Task{URL: u, Depth: 1, Type: "page"}
+	task := Task{URL: u, Depth: 1, Kind: KindPage}
 
 	err1 := q.Enqueue(task, 5)
 	err2 := q.Enqueue(task, 5)
@@ -113,14 +114,14 @@ func TestEnqueue_FullQueue(t *testing.T) {
 
 	for i := 1; i <= 2; i++ {
 		u, _ := url.Parse("https://example.com/page" + string(rune('0'+i)))
-		task := Task{URL: u, Depth: 1, Type: "page"}
+		task := Task{URL: u, Depth: 1, Kind: KindPage}
 		if err := q.Enqueue(task, 5); err != nil {
 			t.Errorf("Enqueue %d failed: %v", i, err)
 		}
 	}
 
 	u, _ := url.Parse("https://example.com/page3")
-	task := Task{URL: u, Depth: 1, Type: "page"}
+	task := Task{URL: u, Depth: 1, Kind: KindPage}
 
 	err := q.Enqueue(task, 5)
 
@@ -134,7 +135,7 @@ func TestDequeue(t *testing.T) {
 
 	q := NewQueue(10, "example.com")
 	u, _ := url.Parse("https://example.com/page1")
-	task := Task{URL: u, Depth: 1, Type: "page"}
+	task := Task{URL: u, Depth: 1, Kind: KindPage}
 
 	if err := q.Enqueue(task, 5); err != nil {
 		t.Fatalf("Enqueue failed: %v", err)
@@ -157,7 +158,7 @@ func TestDone(t *testing.T) {
 
 	q := NewQueue(10, "example.com")
 	u, _ := url.Parse("https://example.com/page1")
-	task := Task{URL: u, Depth: 1, Type: "page"}
+	task := Task{URL: u, Depth: 1, Kind: KindPage}
 
 	if err := q.Enqueue(task, 5); err != nil {
 		t.Fatalf("Enqueue failed: %v", err)
@@ -197,7 +198,7 @@ func TestClose(t *testing.T) {
 func TestWaitAndClose(t *testing.T) {
 	q := NewQueue(10, "example.com")
 	u, _ := url.Parse("https://example.com/page1")
-	task := Task{URL: u, Depth: 1, Type: "page"}
+	task := Task{URL: u, Depth: 1, Kind: KindPage}
 
 	if err := q.Enqueue(task, 5); err != nil {
 		t.Fatalf("Enqueue failed: %v", err)
@@ -238,7 +239,7 @@ func TestConcurrentEnqueue(t *testing.T) {
 		go func(i int) {
 			defer wg.Done()
 			u, _ := url.Parse("https://example.com/page" + string(rune('0'+i)))
-			task := Task{URL: u, Depth: 1, Type: "page"}
+			task := Task{URL: u, Depth: 1, Kind: KindPage}
 			_ = q.Enqueue(task, 5)
 		}(i)
 	}
@@ -270,7 +271,7 @@ func TestVisited_ThreadSafety(t *testing.T) {
 		go func() {
 			defer wg.Done()
 			u, _ := url.Parse("https://example.com/page1")
-			task := Task{URL: u, Depth: 1, Type: "page"}
+			task := Task{URL: u, Depth: 1, Kind: KindPage}
 			_ = q.Enqueue(task, 5)
 		}()
 	}
@@ -293,3 +294,44 @@ func TestVisited_ThreadSafety(t *testing.T) {
 		}
 	}
 }
+
+func TestEnqueue_ResourceIgnoresDepthLimit(t *testing.T) {
+	t.Parallel()
+
+	q := NewQueue(10, "example.com")
+	u, _ := url.Parse("https://example.com/style.css")
+
+	if err := q.Enqueue(Task{URL: u, Depth: 6, Kind: KindResource}, 5); err != nil {
+		t.Errorf("expected resource beyond depth limit to be accepted, got %v", err)
+	}
+}
+
+func TestEnqueue_Filter(t *testing.T) {
+	t.Parallel()
+
+	q := NewQueue(10, "example.com")
+	q.SetFilter(KindPage, Filter{
+		Include: []*regexp.Regexp{regexp.MustCompile(`/docs/`)},
+		Exclude: []*regexp.Regexp{regexp.MustCompile(`/docs/private/`)},
+	})
+	q.SetFilter(KindResource, Filter{Exclude: []*regexp.Regexp{regexp.MustCompile(`\.mp4$`)}})
+
+	tests := []struct {
+		url  string
+		kind Kind
+		want error
+	}{
+		{"https://example.com/docs/intro", KindPage, nil},
+		{"https://example.com/blog/post", KindPage, ErrFiltered},
+		{"https://example.com/docs/private/keys", KindPage, ErrFiltered},
+		{"https://example.com/blog/logo.png", KindResource, nil},
+		{"https://example.com/video.mp4", KindResource, ErrFiltered},
+	}
+
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		if err := q.Enqueue(Task{URL: u, Depth: 1, Kind: tt.kind}, 5); !errors.Is(err, tt.want) {
+			t.Errorf("Enqueue(%s, %s) = %v, want %v", tt.url, tt.kind, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"site-mirror/internal/units"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidSchedule = errors.New("invalid rate schedule")
+
+// Window задаёт лимиты на интервал времени суток, интервал может переходить через полночь.
+type Window struct {
+	Start       time.Duration
+	End         time.Duration
+	Requests    float64
+	BytesPerSec int64
+}
+
+func (w Window) contains(t time.Time) bool {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	d := t.Sub(midnight)
+	if w.Start <= w.End {
+		return d >= w.Start && d < w.End
+	}
+	return d >= w.Start || d < w.End
+}
+
+type bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (b *bucket) setRate(rate float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rate == rate {
+		return
+	}
+	b.rate = rate
+	b.burst = max(1, rate)
+	b.tokens = min(b.tokens, b.burst)
+}
+
+// take списывает n токенов и возвращает время, которое нужно подождать.
+// Баланс может уходить в минус, поэтому следующие вызовы ждут дольше.
+func (b *bucket) take(n float64, now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rate <= 0 {
+		return 0
+	}
+
+	if b.last.IsZero() {
+		b.tokens = b.burst
+	} else {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+func (b *bucket) chunk() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rate <= 0 {
+		return 0
+	}
+	return int(b.burst)
+}
+
+// Limiter общий для всех воркеров: ограничивает запросы в секунду и байты в секунду.
+type Limiter struct {
+	requests bucket
+	bytes    bucket
+
+	defaultRequests float64
+	defaultBytes    int64
+	schedule        []Window
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+func New(requestsPerSec float64, bytesPerSec int64, schedule []Window) *Limiter {
+	l := &Limiter{
+		defaultRequests: requestsPerSec,
+		defaultBytes:    bytesPerSec,
+		schedule:        schedule,
+		now:             time.Now,
+		sleep:           time.Sleep,
+	}
+	l.refresh(l.now())
+	return l
+}
+
+func (l *Limiter) refresh(now time.Time) {
+	reqs, bps := l.defaultRequests, l.defaultBytes
+	for _, w := range l.schedule {
+		if w.contains(now) {
+			reqs, bps = w.Requests, w.BytesPerSec
+			break
+		}
+	}
+	l.requests.setRate(reqs)
+	l.bytes.setRate(float64(bps))
+}
+
+func (l *Limiter) WaitRequest() {
+	if l == nil {
+		return
+	}
+	now := l.now()
+	l.refresh(now)
+	if d := l.requests.take(1, now); d > 0 {
+		l.sleep(d)
+	}
+}
+
+func (l *Limiter) waitBytes(n int) {
+	now := l.now()
+	l.refresh(now)
+	if d := l.bytes.take(float64(n), now); d > 0 {
+		l.sleep(d)
+	}
+}
+
+// Reader оборачивает тело ответа так, чтобы чтение не превышало лимит по трафику.
+func (l *Limiter) Reader(r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &reader{r: r, l: l}
+}
+
+type reader struct {
+	r io.Reader
+	l *Limiter
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if c := r.l.bytes.chunk(); c > 0 && len(p) > c {
+		p = p[:c]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.l.waitBytes(n)
+	}
+	return n, err
+}
+
+// ParseSchedule разбирает строку вида "09:00-18:00=2/256KB,22:00-06:00=0/0",
+// где слева от "/" запросы в секунду, справа трафик в секунду, 0 - без ограничений.
+func ParseSchedule(s string) ([]Window, error) {
+	var windows []Window
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		span, limits, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidSchedule, part)
+		}
+		from, to, ok := strings.Cut(span, "-")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidSchedule, part)
+		}
+		start, err := parseClock(from)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(to)
+		if err != nil {
+			return nil, err
+		}
+
+		reqRaw, bytesRaw, _ := strings.Cut(limits, "/")
+		reqs, err := strconv.ParseFloat(strings.TrimSpace(reqRaw), 64)
+		if err != nil || reqs < 0 {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidSchedule, part)
+		}
+		bps, err := units.ParseBytes(bytesRaw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidSchedule, err)
+		}
+
+		windows = append(windows, Window{Start: start, End: end, Requests: reqs, BytesPerSec: bps})
+	}
+	return windows, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidSchedule, s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
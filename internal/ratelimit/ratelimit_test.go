@@ -0,0 +1,181 @@
+package ratelimit
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now    time.Time
+	slept  time.Duration
+	sleeps int
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.slept += d
+	c.sleeps++
+	c.now = c.now.Add(d)
+}
+
+func newTestLimiter(reqs float64, bps int64, schedule []Window, clock *fakeClock) *Limiter {
+	l := &Limiter{
+		defaultRequests: reqs,
+		defaultBytes:    bps,
+		schedule:        schedule,
+		now:             clock.Now,
+		sleep:           clock.Sleep,
+	}
+	l.refresh(clock.now)
+	return l
+}
+
+func TestLimiter_WaitRequest(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	l := newTestLimiter(2, 0, nil, clock)
+
+	for range 5 {
+		l.WaitRequest()
+	}
+
+	// Первые два запроса укладываются в burst, остальные три идут по 500ms.
+	if want := 1500 * time.Millisecond; clock.slept != want {
+		t.Errorf("slept %v, want %v", clock.slept, want)
+	}
+}
+
+func TestLimiter_Unlimited(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	l := newTestLimiter(0, 0, nil, clock)
+
+	for range 100 {
+		l.WaitRequest()
+	}
+	data, err := io.ReadAll(l.Reader(bytes.NewReader(make([]byte, 1<<20))))
+	if err != nil {
+		t.Fatalf("ReadAll error: %v", err)
+	}
+
+	if len(data) != 1<<20 {
+		t.Errorf("read %d bytes, want %d", len(data), 1<<20)
+	}
+	if clock.sleeps != 0 {
+		t.Errorf("expected no sleeps, got %d", clock.sleeps)
+	}
+}
+
+func TestLimiter_Reader(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	l := newTestLimiter(0, 1024, nil, clock)
+
+	data, err := io.ReadAll(l.Reader(bytes.NewReader(make([]byte, 4096))))
+	if err != nil {
+		t.Fatalf("ReadAll error: %v", err)
+	}
+
+	if len(data) != 4096 {
+		t.Errorf("read %d bytes, want 4096", len(data))
+	}
+	// Первая секунда покрывается burst, остальные 3KB занимают 3 секунды.
+	if want := 3 * time.Second; clock.slept != want {
+		t.Errorf("slept %v, want %v", clock.slept, want)
+	}
+}
+
+func TestLimiter_Schedule(t *testing.T) {
+	schedule := []Window{
+		{Start: 9 * time.Hour, End: 18 * time.Hour, Requests: 1},
+		{Start: 22 * time.Hour, End: 6 * time.Hour, Requests: 0},
+	}
+
+	tests := []struct {
+		name      string
+		hour      int
+		wantSlept time.Duration
+	}{
+		{"office hours", 10, 2 * time.Second},
+		{"night window", 23, 0},
+		{"early morning", 3, 0},
+		{"default outside windows", 19, 500 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{now: time.Date(2024, 1, 1, tt.hour, 30, 0, 0, time.UTC)}
+			l := newTestLimiter(2, 0, schedule, clock)
+
+			for range 3 {
+				l.WaitRequest()
+			}
+
+			if clock.slept != tt.wantSlept {
+				t.Errorf("slept %v, want %v", clock.slept, tt.wantSlept)
+			}
+		})
+	}
+}
+
+func TestLimiter_Nil(t *testing.T) {
+	var l *Limiter
+	l.WaitRequest()
+
+	r := bytes.NewReader([]byte("body"))
+	if l.Reader(r) != r {
+		t.Error("nil limiter should return reader unchanged")
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    []Window
+		wantErr bool
+	}{
+		{
+			name: "two windows",
+			in:   "09:00-18:00=2/256KB, 22:00-06:30=0/0",
+			want: []Window{
+				{Start: 9 * time.Hour, End: 18 * time.Hour, Requests: 2, BytesPerSec: 256 << 10},
+				{Start: 22 * time.Hour, End: 6*time.Hour + 30*time.Minute},
+			},
+		},
+		{
+			name: "requests only",
+			in:   "00:00-12:00=0.5",
+			want: []Window{{Start: 0, End: 12 * time.Hour, Requests: 0.5}},
+		},
+		{name: "empty", in: "", want: nil},
+		{name: "missing limits", in: "09:00-18:00", wantErr: true},
+		{name: "bad clock", in: "9am-18:00=1/0", wantErr: true},
+		{name: "bad rate", in: "09:00-18:00=fast/0", wantErr: true},
+		{name: "bad bandwidth", in: "09:00-18:00=1/lots", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSchedule(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSchedule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrInvalidSchedule) {
+					t.Errorf("expected ErrInvalidSchedule, got %v", err)
+				}
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d windows, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("window[%d] = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
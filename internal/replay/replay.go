@@ -0,0 +1,399 @@
+// Package replay воспроизводит ответы из архивов WARC по исходному URL и времени снимка.
+package replay
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"site-mirror/internal/transform"
+	"site-mirror/internal/warc"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrMissingArchive = errors.New("capture refers to unknown WARC file")
+
+// Prefix - начало адресов воспроизведения: /web/ВРЕМЯ/URL, /web/*/URL - календарь снимков.
+const Prefix = "/web/"
+
+// Заголовки архивного ответа, которые не передаются браузеру: длина и кодирование
+// меняются при переписывании, а политики сайта мешают открывать его с сервера воспроизведения.
+var skipHeaders = []string{
+	"Connection", "Keep-Alive", "Transfer-Encoding", "Content-Length", "Content-Encoding",
+	"Content-Security-Policy", "Content-Security-Policy-Report-Only", "Strict-Transport-Security",
+	"Set-Cookie", "Alt-Svc",
+}
+
+// Handler отдаёт снимки из набора архивов.
+type Handler struct {
+	Logger *slog.Logger
+
+	captures map[string][]warc.Capture
+	urls     []string
+	files    map[string]string
+}
+
+// NewHandler собирает обработчик по индексу captures. files - пути архивов,
+// имя файла в индексе сопоставляется с их базовыми именами.
+func NewHandler(captures []warc.Capture, files []string) (*Handler, error) {
+	h := &Handler{
+		Logger:   slog.Default(),
+		captures: make(map[string][]warc.Capture),
+		files:    make(map[string]string, len(files)),
+	}
+	for _, f := range files {
+		h.files[filepath.Base(f)] = f
+	}
+	for _, c := range captures {
+		if _, ok := h.files[filepath.Base(c.Filename)]; !ok {
+			return nil, fmt.Errorf("%w %q", ErrMissingArchive, c.Filename)
+		}
+		u, err := url.Parse(c.URL)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		k := key(u)
+		if _, ok := h.captures[k]; !ok {
+			h.urls = append(h.urls, k)
+		}
+		h.captures[k] = append(h.captures[k], c)
+	}
+	for _, list := range h.captures {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Time.Before(list[j].Time) })
+	}
+	sort.Strings(h.urls)
+	return h, nil
+}
+
+// key - URL без схемы, фрагмента и порта по умолчанию: снимки http и https одного адреса совпадают.
+func key(u *url.URL) string {
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return host + path
+}
+
+// Link возвращает адрес воспроизведения URL для снимка timestamp.
+func Link(timestamp string, u *url.URL) string {
+	return Prefix + timestamp + "/" + u.String()
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(r.RequestURI, Prefix) {
+		if q := r.URL.Query().Get("url"); q != "" {
+			redirect(w, Prefix+"*/"+q)
+			return
+		}
+		h.render(w, http.StatusOK, indexPage, h.urls)
+		return
+	}
+
+	// URL берётся из RequestURI: в нём сохраняются его собственные параметры.
+	rest := strings.TrimPrefix(r.RequestURI, Prefix)
+	timestamp, target, _ := strings.Cut(rest, "/")
+	if timestamp != "*" && !isTimestamp(timestamp) {
+		// Адрес без времени снимка, например /web/https://example.com/, - календарь.
+		timestamp, target = "*", rest
+	}
+	u, err := targetURL(target)
+	if err != nil {
+		http.Error(w, "invalid URL "+target, http.StatusBadRequest)
+		return
+	}
+	captures := h.captures[key(u)]
+	if len(captures) == 0 {
+		h.render(w, http.StatusNotFound, missingPage, u.String())
+		return
+	}
+	if timestamp == "*" || timestamp == "" {
+		h.render(w, http.StatusOK, calendarPage, newCalendar(u, captures))
+		return
+	}
+
+	at, err := warc.ParseTimestamp(timestamp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c := nearest(captures, at)
+	if c.Timestamp() != timestamp {
+		redirect(w, Link(c.Timestamp(), u))
+		return
+	}
+	h.replay(w, u, c)
+}
+
+// isTimestamp проверяет, похоже ли s на время снимка: от 1 до 14 цифр.
+func isTimestamp(s string) bool {
+	if s == "" || len(s) > 14 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// redirect не использует http.Redirect: тот чистит путь и склеивает "//" во вложенном URL.
+func redirect(w http.ResponseWriter, location string) {
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusFound)
+}
+
+// targetURL восстанавливает URL из адреса: прокси и браузеры склеивают "//" после схемы.
+func targetURL(s string) (*url.URL, error) {
+	for _, scheme := range []string{"http:", "https:"} {
+		if strings.HasPrefix(s, scheme+"/") && !strings.HasPrefix(s, scheme+"//") {
+			s = scheme + "/" + s[len(scheme):]
+		}
+	}
+	if !strings.HasPrefix(s, "http://") && !strings.HasPrefix(s, "https://") {
+		s = "http://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, errors.New("no host")
+	}
+	return u, nil
+}
+
+// nearest выбирает снимок, ближайший по времени к at.
+func nearest(captures []warc.Capture, at time.Time) warc.Capture {
+	best := captures[0]
+	for _, c := range captures[1:] {
+		if c.Time.Sub(at).Abs() < best.Time.Sub(at).Abs() {
+			best = c
+		}
+	}
+	return best
+}
+
+func (h *Handler) replay(w http.ResponseWriter, u *url.URL, c warc.Capture) {
+	rec, err := warc.ReadAt(h.files[filepath.Base(c.Filename)], c.Offset)
+	if err != nil {
+		h.fail(w, c, err)
+		return
+	}
+	resp, err := rec.Response()
+	if err != nil {
+		h.fail(w, c, err)
+		return
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		h.fail(w, c, err)
+		return
+	}
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		if body, err = gunzip(body); err != nil {
+			h.fail(w, c, err)
+			return
+		}
+	}
+
+	original, err := url.Parse(c.URL)
+	if err != nil {
+		original = u
+	}
+	header := w.Header()
+	for k, v := range resp.Header {
+		header[k] = v
+	}
+	for _, k := range skipHeaders {
+		header.Del(k)
+	}
+	if loc := resp.Header.Get("Location"); loc != "" {
+		if target, errLoc := original.Parse(loc); errLoc == nil {
+			header.Set("Location", Link(c.Timestamp(), target))
+		}
+	}
+	header.Set("Memento-Datetime", c.Time.UTC().Format(http.TimeFormat))
+
+	doc := &transform.Document{URL: original, ContentType: resp.Header.Get("Content-Type"), Body: body, FetchedAt: c.Time}
+	if err = pipeline(c.Timestamp()).Apply(doc); err != nil {
+		h.fail(w, c, err)
+		return
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = w.Write(doc.Body)
+}
+
+// pipeline переписывает ссылки на адреса воспроизведения того же времени,
+// чтобы переходы не уходили на живой сайт, и добавляет баннер снимка.
+func pipeline(timestamp string) *transform.Pipeline {
+	links := transform.MapLinks{Map: func(_ *transform.Document, u *url.URL, _ string) (string, bool) {
+		return Link(timestamp, u), true
+	}}
+	p := &transform.Pipeline{}
+	p.Add(
+		transform.Rule{Types: append([]string{"text/css"}, transform.HTMLTypes...), Transformer: links},
+		transform.Rule{Types: transform.HTMLTypes, Transformer: transform.HTML(transform.RemoveBase)},
+		transform.Rule{Types: transform.HTMLTypes, Transformer: transform.HTML(transform.Banner)},
+	)
+	return p
+}
+
+func gunzip(b []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+func (h *Handler) fail(w http.ResponseWriter, c warc.Capture, err error) {
+	h.Logger.Error("replaying capture", "url", c.URL, "file", c.Filename, "offset", c.Offset, "err", err)
+	http.Error(w, "can't read capture from archive", http.StatusInternalServerError)
+}
+
+func (h *Handler) render(w http.ResponseWriter, status int, page *template.Template, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := page.Execute(w, data); err != nil {
+		h.Logger.Error("rendering replay page", "page", page.Name(), "err", err)
+	}
+}
+
+type calendar struct {
+	URL    string
+	Count  int
+	Months []month
+}
+
+type month struct {
+	Title string
+	Weeks [][]day
+}
+
+// day - ячейка календаря; Day == 0 - пустая ячейка до первого числа или после последнего.
+type day struct {
+	Day   int
+	Links []capture
+}
+
+type capture struct {
+	Time string
+	Href string
+}
+
+func newCalendar(u *url.URL, captures []warc.Capture) calendar {
+	cal := calendar{URL: u.String(), Count: len(captures)}
+	byMonth := make(map[time.Time]map[int][]capture)
+	var months []time.Time
+	for _, c := range captures {
+		t := c.Time.UTC()
+		first := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		if byMonth[first] == nil {
+			byMonth[first] = make(map[int][]capture)
+			months = append(months, first)
+		}
+		byMonth[first][t.Day()] = append(byMonth[first][t.Day()], capture{
+			Time: t.Format("15:04:05"),
+			Href: Link(c.Timestamp(), u),
+		})
+	}
+
+	for _, first := range months {
+		m := month{Title: first.Format("January 2006")}
+		// Недели начинаются с понедельника.
+		week := make([]day, (int(first.Weekday())+6)%7)
+		last := first.AddDate(0, 1, -1).Day()
+		for d := 1; d <= last; d++ {
+			week = append(week, day{Day: d, Links: byMonth[first][d]})
+			if len(week) == 7 {
+				m.Weeks = append(m.Weeks, week)
+				week = nil
+			}
+		}
+		if len(week) > 0 {
+			m.Weeks = append(m.Weeks, append(week, make([]day, 7-len(week))...))
+		}
+		cal.Months = append(cal.Months, m)
+	}
+	return cal
+}
+
+const pageStyle = `<style>body{font:15px/1.5 sans-serif;max-width:60em;margin:2em auto}` +
+	`table{border-collapse:collapse;margin:0 2em 2em 0;display:inline-table}` +
+	`td,th{border:1px solid #ddd;width:5em;height:3.5em;vertical-align:top;padding:2px 4px}` +
+	`td.hit{background:#e6f0ff}td a{display:block;font-size:12px}</style>`
+
+var indexPage = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Archived URLs</title>` + pageStyle + `</head>
+<body>
+<h1>Archived URLs</h1>
+<form action="/"><input name="url" size="60" placeholder="https://example.com/"> <button>Show captures</button></form>
+<ul>
+{{- range .}}
+<li><a href="/web/*/{{.}}">{{.}}</a></li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
+
+var calendarPage = template.Must(template.New("calendar").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Captures of {{.URL}}</title>` + pageStyle + `</head>
+<body>
+<h1>{{.Count}} captures of <a href="{{.URL}}">{{.URL}}</a></h1>
+{{- range .Months}}
+<table>
+<caption>{{.Title}}</caption>
+<tr><th>Mon</th><th>Tue</th><th>Wed</th><th>Thu</th><th>Fri</th><th>Sat</th><th>Sun</th></tr>
+{{- range .Weeks}}
+<tr>
+{{- range .}}
+{{- if .Links}}<td class="hit">{{.Day}}{{range .Links}}<a href="{{.Href}}">{{.Time}}</a>{{end}}</td>
+{{- else if .Day}}<td>{{.Day}}</td>
+{{- else}}<td></td>
+{{- end}}
+{{- end}}
+</tr>
+{{- end}}
+</table>
+{{- end}}
+<p><a href="/">All archived URLs</a></p>
+</body>
+</html>
+`))
+
+var missingPage = template.Must(template.New("missing").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Not archived: {{.}}</title>` + pageStyle + `</head>
+<body>
+<h1>Not in the archive</h1>
+<p><code>{{.}}</code> has no captures.</p>
+<p><a href="{{.}}">Open the live original</a> or see <a href="/">all archived URLs</a>.</p>
+</body>
+</html>
+`))
@@ -0,0 +1,154 @@
+package replay
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"site-mirror/internal/warc"
+	"strings"
+	"testing"
+)
+
+func record(uri, date, response string) string {
+	return fmt.Sprintf("WARC/1.0\r\nWARC-Type: response\r\nWARC-Target-URI: %s\r\nWARC-Date: %s\r\n"+
+		"Content-Type: application/http; msgtype=response\r\nContent-Length: %d\r\n\r\n%s\r\n\r\n",
+		uri, date, len(response), response)
+}
+
+func response(status string, header map[string]string, body string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "HTTP/1.1 %s\r\n", status)
+	for k, v := range header {
+		fmt.Fprintf(&b, "%s: %s\r\n", k, v)
+	}
+	fmt.Fprintf(&b, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return b.String()
+}
+
+func gzipped(s string) string {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write([]byte(s))
+	_ = zw.Close()
+	return buf.String()
+}
+
+func newTestHandler(t *testing.T) *Handler {
+	t.Helper()
+	html := map[string]string{"Content-Type": "text/html"}
+	records := []string{
+		record("https://example.com/", "2024-03-01T10:00:00Z", response("200 OK", html,
+			`<html><head><base href="https://example.com/docs/"></head><body><a href="page?id=1#top">p</a><img src="/logo.png"></body></html>`)),
+		record("https://example.com/", "2024-05-20T08:30:00Z", response("200 OK",
+			map[string]string{"Content-Type": "text/html", "Content-Encoding": "gzip", "Content-Security-Policy": "default-src 'self'"},
+			gzipped(`<html><body><a href="https://other.org/x">x</a></body></html>`))),
+		record("https://example.com/style.css", "2024-03-01T10:00:01Z", response("200 OK",
+			map[string]string{"Content-Type": "text/css"}, `body{background:url(/bg.png)}`)),
+		record("https://example.com/old", "2024-03-01T10:00:02Z", response("301 Moved Permanently",
+			map[string]string{"Location": "/new"}, "")),
+	}
+	path := filepath.Join(t.TempDir(), "site.warc")
+	if err := os.WriteFile(path, []byte(strings.Join(records, "")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	captures, err := warc.Index(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewHandler(captures, []string{path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestHandler(t *testing.T) {
+	h := newTestHandler(t)
+	tests := []struct {
+		name         string
+		target       string
+		wantStatus   int
+		wantHeader   map[string]string
+		wantBody     []string
+		wantNotBody  []string
+		wantLocation string
+	}{
+		{
+			name: "exact capture", target: "/web/20240301100000/https://example.com/", wantStatus: http.StatusOK,
+			wantHeader: map[string]string{"Memento-Datetime": "Fri, 01 Mar 2024 10:00:00 GMT"},
+			wantBody: []string{`href="/web/20240301100000/https://example.com/docs/page?id=1#top"`,
+				`src="/web/20240301100000/https://example.com/logo.png"`, "site-mirror-banner"},
+			wantNotBody: []string{"<base"},
+		},
+		{
+			name: "gzip and other hosts", target: "/web/20240520083000/https://example.com/", wantStatus: http.StatusOK,
+			wantHeader: map[string]string{"Content-Encoding": "", "Content-Security-Policy": ""},
+			wantBody:   []string{`href="/web/20240520083000/https://other.org/x"`},
+		},
+		{
+			name: "nearest capture", target: "/web/2024/https://example.com/", wantStatus: http.StatusFound,
+			wantLocation: "/web/20240301100000/https://example.com/",
+		},
+		{
+			name: "nearest later capture", target: "/web/20240601/http://example.com/", wantStatus: http.StatusFound,
+			wantLocation: "/web/20240520083000/http://example.com/",
+		},
+		{
+			name: "collapsed slashes", target: "/web/20240301100001/https:/example.com/style.css", wantStatus: http.StatusOK,
+			wantBody: []string{"url(/web/20240301100001/https://example.com/bg.png)"},
+		},
+		{
+			name: "archived redirect", target: "/web/20240301100002/https://example.com/old", wantStatus: http.StatusMovedPermanently,
+			wantLocation: "/web/20240301100002/https://example.com/new",
+		},
+		{
+			name: "calendar", target: "/web/*/example.com/", wantStatus: http.StatusOK,
+			wantBody: []string{"2 captures of", "March 2024", "May 2024", `href="/web/20240520083000/http://example.com/">08:30:00`},
+		},
+		{name: "missing", target: "/web/2024/https://example.com/nope", wantStatus: http.StatusNotFound, wantBody: []string{"Open the live original"}},
+		{name: "no timestamp", target: "/web/https://example.com/", wantStatus: http.StatusOK, wantBody: []string{"2 captures of"}},
+		{name: "no timestamp and scheme", target: "/web/example.com/", wantStatus: http.StatusOK, wantBody: []string{"2 captures of"}},
+		{name: "bad timestamp", target: "/web/20241399/https://example.com/", wantStatus: http.StatusBadRequest},
+		{name: "timestamp without URL", target: "/web/20240301/", wantStatus: http.StatusBadRequest},
+		{name: "index", target: "/", wantStatus: http.StatusOK, wantBody: []string{`href="/web/*/example.com/style.css"`}},
+		{name: "search", target: "/?url=example.com/", wantStatus: http.StatusFound, wantLocation: "/web/*/example.com/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", rr.Code, tt.wantStatus, rr.Body)
+			}
+			if loc := rr.Header().Get("Location"); loc != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", loc, tt.wantLocation)
+			}
+			for k, v := range tt.wantHeader {
+				if got := rr.Header().Get(k); got != v {
+					t.Errorf("header %s = %q, want %q", k, got, v)
+				}
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(rr.Body.String(), want) {
+					t.Errorf("body lacks %q:\n%s", want, rr.Body)
+				}
+			}
+			for _, want := range tt.wantNotBody {
+				if strings.Contains(rr.Body.String(), want) {
+					t.Errorf("body contains %q:\n%s", want, rr.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestNewHandler_MissingArchive(t *testing.T) {
+	captures := []warc.Capture{{URL: "http://example.com/", Filename: "other.warc.gz"}}
+	if _, err := NewHandler(captures, []string{"/data/site.warc.gz"}); err == nil {
+		t.Error("expected error for capture in unknown archive")
+	}
+}
@@ -0,0 +1,189 @@
+// Package serve отдаёт сохранённое зеркало по HTTP так, как его видел обход.
+package serve
+
+import (
+	"html/template"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"site-mirror/internal/eventlog"
+	"site-mirror/internal/storage"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// maxNearby - сколько сохранённых адресов из того же каталога показывать на странице 404.
+const maxNearby = 20
+
+// Handler отдаёт зеркало одного хоста по исходным URL: путь файла вычисляется тем же
+// Storage.Path, что и при сохранении, а тип содержимого берётся из журнала обхода.
+type Handler struct {
+	Logger *slog.Logger
+
+	store  *storage.Storage
+	origin *url.URL
+	types  map[string]string
+	urls   []*url.URL
+}
+
+// NewHandler собирает обработчик для origin (схема и хост исходного сайта).
+// records - журнал обхода, может быть пустым: тогда тип определяется по файлу.
+func NewHandler(store *storage.Storage, origin *url.URL, records []eventlog.Record) *Handler {
+	h := &Handler{
+		Logger: slog.Default(),
+		store:  store,
+		origin: origin,
+		types:  make(map[string]string),
+	}
+	for _, rec := range records {
+		u, err := url.Parse(rec.URL)
+		if err != nil || u.Host != origin.Host || rec.Error != "" || rec.SavedPath == "" {
+			continue
+		}
+		u.Fragment = ""
+		if _, seen := h.types[u.String()]; !seen {
+			h.urls = append(h.urls, u)
+		}
+		h.types[u.String()] = rec.ContentType
+	}
+	sort.Slice(h.urls, func(i, j int) bool { return h.urls[i].String() < h.urls[j].String() })
+	return h
+}
+
+// Origin возвращает адрес сайта host по журналу обхода, по умолчанию https.
+func Origin(host string, records []eventlog.Record) *url.URL {
+	for _, rec := range records {
+		if u, err := url.Parse(rec.URL); err == nil && u.Host == host {
+			return &url.URL{Scheme: u.Scheme, Host: host}
+		}
+	}
+	return &url.URL{Scheme: "https", Host: host}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Clean убирает ".." из пути, параметры запроса Storage.Path очищает сам,
+	// а lookup проверяет, что файл остался в каталоге хоста.
+	u := &url.URL{
+		Scheme:   h.origin.Scheme,
+		Host:     h.origin.Host,
+		Path:     path.Clean("/" + r.URL.Path),
+		RawQuery: r.URL.RawQuery,
+	}
+	if strings.HasSuffix(r.URL.Path, "/") && u.Path != "/" {
+		u.Path += "/"
+	}
+
+	file, contentType, ok := h.lookup(u)
+	if !ok {
+		h.notFound(w, u)
+		return
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		h.Logger.Error("opening mirrored file", "url", u.String(), "path", file, "err", err)
+		http.Error(w, "can't read mirrored file", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		http.Error(w, "can't read mirrored file", http.StatusInternalServerError)
+		return
+	}
+	// Без типа ServeContent определит его по содержимому.
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	http.ServeContent(w, r, "", fi.ModTime(), f)
+}
+
+// lookup находит файл URL: сначала по типу из журнала, затем среди возможных имён.
+func (h *Handler) lookup(u *url.URL) (string, string, bool) {
+	if contentType, ok := h.types[u.String()]; ok {
+		file := h.store.Path(u, contentType)
+		if fi, err := os.Stat(file); err == nil && fi.Mode().IsRegular() && h.store.CheckPath(u, file) == nil {
+			return file, contentType, true
+		}
+	}
+	file, _, err := h.store.Find(u)
+	if err != nil {
+		return "", "", false
+	}
+	return file, mime.TypeByExtension(filepath.Ext(file)), true
+}
+
+var notFoundPage = template.Must(template.New("404").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Not mirrored: {{.URL}}</title></head>
+<body style="font:15px/1.5 sans-serif;max-width:48em;margin:2em auto">
+<h1>Not in the mirror</h1>
+<p><code>{{.URL}}</code> was not saved by the crawl.</p>
+<p><a href="{{.URL}}">Open the live original</a></p>
+{{- if .Nearby}}
+<h2>Mirrored pages nearby</h2>
+<ul>
+{{- range .Nearby}}
+<li><a href="{{.RequestURI}}">{{.}}</a></li>
+{{- end}}
+</ul>
+{{- end}}
+</body>
+</html>
+`))
+
+func (h *Handler) notFound(w http.ResponseWriter, u *url.URL) {
+	dir := u.Path[:strings.LastIndex(u.Path, "/")+1]
+	var nearby []*url.URL
+	for _, m := range h.urls {
+		if len(nearby) == maxNearby {
+			break
+		}
+		if strings.HasPrefix(m.Path, dir) {
+			nearby = append(nearby, m)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	data := struct {
+		URL    string
+		Nearby []*url.URL
+	}{URL: u.String(), Nearby: nearby}
+	if err := notFoundPage.Execute(w, data); err != nil {
+		h.Logger.Error("rendering not found page", "url", u.String(), "err", err)
+	}
+}
+
+// Hosts возвращает каталоги хостов в каталоге зеркала dir и хосты из манифеста:
+// при -dedup pointer каталога хоста может не быть. Скрытые каталоги, например
+// блобы дедупликации, и каталог снимков пропускаются.
+func Hosts(dir string, m *storage.Manifest) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var hosts []string
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") && e.Name() != storage.SnapshotDir {
+			hosts = append(hosts, e.Name())
+		}
+	}
+	for _, e := range m.Entries() {
+		if u, errParse := url.Parse(e.URL); errParse == nil && !slices.Contains(hosts, u.Host) {
+			hosts = append(hosts, u.Host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts, nil
+}
@@ -0,0 +1,122 @@
+package serve
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"site-mirror/internal/eventlog"
+	"site-mirror/internal/storage"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	dir := t.TempDir()
+	st := storage.NewStorage(dir)
+	files := []struct {
+		url, contentType, body string
+		logged                 bool
+	}{
+		{"https://example.com/", "text/html", "<p>home</p>", true},
+		{"https://example.com/docs/about", "text/html; charset=utf-8", "<p>about</p>", true},
+		{"https://example.com/docs/list?page=2&sort=asc", "text/html", "<p>page 2</p>", true},
+		{"https://example.com/feed", "application/rss+xml", "<rss></rss>", true},
+		{"https://example.com/img/logo.png", "image/png", "\x89PNG\r\n\x1a\n", false},
+	}
+	var records []eventlog.Record
+	for _, f := range files {
+		u, _ := url.Parse(f.url)
+		if err := st.Save(u, []byte(f.body), f.contentType); err != nil {
+			t.Fatal(err)
+		}
+		if f.logged {
+			records = append(records, eventlog.Record{URL: f.url, ContentType: f.contentType, SavedPath: st.Path(u, f.contentType)})
+		}
+	}
+	records = append(records, eventlog.Record{URL: "https://example.com/docs/broken", Error: "timeout"})
+	if err := os.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	origin := Origin("example.com", records)
+	if origin.String() != "https://example.com" {
+		t.Fatalf("Origin() = %s", origin)
+	}
+	h := NewHandler(st, origin, records)
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		wantStatus int
+		wantType   string
+		wantBody   []string
+	}{
+		{name: "index", target: "/", wantStatus: http.StatusOK, wantType: "text/html", wantBody: []string{"home"}},
+		{name: "page without extension", target: "/docs/about", wantStatus: http.StatusOK, wantType: "text/html; charset=utf-8", wantBody: []string{"about"}},
+		{name: "query string", target: "/docs/list?page=2&sort=asc", wantStatus: http.StatusOK, wantBody: []string{"page 2"}},
+		{name: "type from event log", target: "/feed", wantStatus: http.StatusOK, wantType: "application/rss+xml", wantBody: []string{"<rss>"}},
+		{name: "type from file", target: "/img/logo.png", wantStatus: http.StatusOK, wantType: "image/png"},
+		{
+			name: "missing page", target: "/docs/broken", wantStatus: http.StatusNotFound, wantType: "text/html; charset=utf-8",
+			wantBody: []string{`href="https://example.com/docs/broken"`, `href="/docs/about"`, `href="/docs/list?page=2&amp;sort=asc"`},
+		},
+		{name: "outside of host", target: "/../secret", wantStatus: http.StatusNotFound},
+		{name: "traversal in query", target: "/a?/../../../secret", wantStatus: http.StatusNotFound},
+		{name: "backslash in query", target: `/a?\..\..\secret`, wantStatus: http.StatusNotFound},
+		{name: "post", method: http.MethodPost, target: "/", wantStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(method, tt.target, nil))
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", rr.Code, tt.wantStatus, rr.Body)
+			}
+			if tt.wantType != "" && rr.Header().Get("Content-Type") != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", rr.Header().Get("Content-Type"), tt.wantType)
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(rr.Body.String(), want) {
+					t.Errorf("body lacks %q:\n%s", want, rr.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestOrigin_Default(t *testing.T) {
+	records := []eventlog.Record{{URL: "http://other.com/"}}
+	if got := Origin("example.com", records).String(); got != "https://example.com" {
+		t.Errorf("Origin() = %s, want https://example.com", got)
+	}
+	if got := Origin("other.com", records).String(); got != "http://other.com" {
+		t.Errorf("Origin() = %s, want http://other.com", got)
+	}
+}
+
+func TestHosts(t *testing.T) {
+	dir := t.TempDir()
+	for _, d := range []string{"example.com", storage.BlobDir, filepath.Join(storage.SnapshotDir, "20240301T120000Z", "example.com")} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := storage.NewManifest()
+	m.Set(storage.ManifestEntry{URL: "https://cdn.example.com/logo.png"})
+
+	hosts, err := Hosts(dir, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(hosts, ",") != "cdn.example.com,example.com" {
+		t.Errorf("Hosts() = %v, want only mirrored hosts", hosts)
+	}
+}
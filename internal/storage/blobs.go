@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"site-mirror/internal/fsutil"
+	"site-mirror/internal/metrics"
+)
+
+// BlobDir - каталог блобов в BaseDir при дедупликации.
+const BlobDir = ".site-mirror-blobs"
+
+var ErrUnknownDedup = errors.New("unknown dedup mode")
+
+// DedupMode задаёт, как путь URL ссылается на блоб с его содержимым.
+type DedupMode string
+
+const (
+	DedupOff      DedupMode = ""
+	DedupHardlink DedupMode = "hardlink"
+	DedupSymlink  DedupMode = "symlink"
+	// DedupPointer не создаёт файл по пути URL: блоб находится по записи манифеста.
+	DedupPointer DedupMode = "pointer"
+)
+
+func ParseDedup(s string) (DedupMode, error) {
+	switch m := DedupMode(s); m {
+	case DedupOff, DedupHardlink, DedupSymlink, DedupPointer:
+		return m, nil
+	default:
+		return "", fmt.Errorf("%w %q", ErrUnknownDedup, s)
+	}
+}
+
+// DedupStats - файлы и байты, которые не пришлось записывать, потому что
+// такое же содержимое уже лежало в блоб-хранилище.
+type DedupStats struct {
+	Files int64
+	Bytes int64
+}
+
+func (s *Storage) DedupStats() DedupStats {
+	return DedupStats{Files: s.dedupFiles.Load(), Bytes: s.dedupBytes.Load()}
+}
+
+// dedup кладёт содержимое в блоб, названный по SHA-256, и ставит на него ссылку
+// из localPath. Существующие блоб и ссылка не перезаписываются. Возвращает путь
+// блоба относительно BaseDir через "/".
+func (s *Storage) dedup(localPath string, content []byte) (string, error) {
+	sum := Checksum(content)
+	blobs := s.Blobs
+	if blobs == "" {
+		blobs = filepath.Join(s.BaseDir, BlobDir)
+	}
+	blob := filepath.Join(blobs, sum[:2], sum)
+	rel, err := filepath.Rel(s.BaseDir, blob)
+	if err != nil {
+		return "", err
+	}
+
+	existed, err := writeBlob(blob, content)
+	if err != nil {
+		return "", err
+	}
+	if existed {
+		s.dedupFiles.Add(1)
+		s.dedupBytes.Add(int64(len(content)))
+		metrics.Inc(s.metrics(), metrics.DedupFilesTotal)
+		s.metrics().Add(metrics.DedupBytesTotal, float64(len(content)))
+	}
+
+	switch s.Dedup {
+	case DedupHardlink:
+		err = hardlink(blob, localPath)
+	case DedupSymlink:
+		err = symlink(blob, localPath)
+	case DedupPointer:
+		// Копия от прежнего обхода без дедупликации нашлась бы раньше блоба.
+		if err = os.Remove(localPath); errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+	}
+	s.logger().Debug("deduplicated", "path", localPath, "blob", rel, "existed", existed)
+	return filepath.ToSlash(rel), err
+}
+
+// writeBlob записывает блоб, если его ещё нет. Существующий блоб с другим
+// хешем, например обрезанный при сбое диска, перезаписывается. Параллельные
+// записи одного блоба безопасны: содержимое у всех одно.
+func writeBlob(path string, content []byte) (bool, error) {
+	if current, err := os.ReadFile(path); err == nil && Checksum(current) == Checksum(content) {
+		return true, nil
+	}
+	return false, fsutil.WriteFileAtomic(path, content, 0644)
+}
+
+func hardlink(blob, path string) error {
+	if fi, err := os.Lstat(path); err == nil {
+		if bi, errBlob := os.Stat(blob); errBlob == nil && os.SameFile(fi, bi) {
+			return nil
+		}
+	}
+	return fsutil.Replace(path, func(tmp string) error { return os.Link(blob, tmp) })
+}
+
+// symlink ставит относительную ссылку, чтобы каталог зеркала можно было переносить.
+func symlink(blob, path string) error {
+	target, err := filepath.Rel(filepath.Dir(path), blob)
+	if err != nil {
+		return err
+	}
+	if current, errRead := os.Readlink(path); errRead == nil && current == target {
+		return nil
+	}
+	return fsutil.Replace(path, func(tmp string) error { return os.Symlink(target, tmp) })
+}
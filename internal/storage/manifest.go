@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"site-mirror/internal/fsutil"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultManifestFile - манифест зеркала в каталоге вывода.
+const DefaultManifestFile = "site-mirror-manifest.json"
+
+// ManifestEntry описывает сохранённый файл. Path - путь относительно BaseDir через "/".
+type ManifestEntry struct {
+	URL         string    `json:"url"`
+	Path        string    `json:"path"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	ContentType string    `json:"content_type,omitempty"`
+	FetchedAt   time.Time `json:"fetched_at"`
+	Status      int       `json:"status"`
+	// Blob - путь блоба относительно BaseDir при дедупликации.
+	Blob string `json:"blob,omitempty"`
+	// ETag и LastModified - заголовки ответа сервера для условных запросов update.
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// Manifest - список файлов зеркала по URL. Переживает запуски: update
+// дополняет манифест прошлого обхода.
+type Manifest struct {
+	mu      sync.Mutex
+	entries map[string]ManifestEntry
+}
+
+func NewManifest() *Manifest {
+	return &Manifest{entries: make(map[string]ManifestEntry)}
+}
+
+// ReadManifest читает манифест; отсутствующий файл - пустой манифест.
+func ReadManifest(path string) (*Manifest, error) {
+	m := NewManifest()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []ManifestEntry
+	if err = json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		m.entries[e.URL] = e
+	}
+	return m, nil
+}
+
+func (m *Manifest) Set(e ManifestEntry) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[e.URL] = e
+}
+
+func (m *Manifest) Get(u string) (ManifestEntry, bool) {
+	if m == nil {
+		return ManifestEntry{}, false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[u]
+	return e, ok
+}
+
+// SetValidators запоминает непустые ETag и Last-Modified ответа в записи URL, если она есть.
+func (m *Manifest) SetValidators(u, etag, lastModified string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[u]
+	if !ok {
+		return
+	}
+	if etag != "" {
+		e.ETag = etag
+	}
+	if lastModified != "" {
+		e.LastModified = lastModified
+	}
+	m.entries[u] = e
+}
+
+func (m *Manifest) Delete(u string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, u)
+}
+
+// Entries возвращает записи, упорядоченные по URL.
+func (m *Manifest) Entries() []ManifestEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := make([]ManifestEntry, 0, len(m.entries))
+	for _, e := range m.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].URL < entries[j].URL })
+	return entries
+}
+
+// WriteFile записывает манифест через временный файл, чтобы прерванная
+// запись не испортила прежний.
+func (m *Manifest) WriteFile(path string) error {
+	return fsutil.WriteJSON(path, m.Entries())
+}
+
+// ReadEntry читает сохранённый файл записи в каталоге зеркала dir, при
+// дедупликации pointer файла по пути нет и читается блоб.
+func ReadEntry(dir string, e ManifestEntry) ([]byte, error) {
+	content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(e.Path)))
+	if errors.Is(err, fs.ErrNotExist) && e.Blob != "" {
+		content, err = os.ReadFile(filepath.Join(dir, filepath.FromSlash(e.Blob)))
+	}
+	return content, err
+}
+
+// Checksum возвращает SHA-256 содержимого в hex, как в манифесте.
+func Checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// SnapshotDir - каталог снимков в каталоге зеркала.
+const SnapshotDir = "snapshots"
+
+// SnapshotLayout - формат имени снимка: время начала обхода в UTC.
+// Имена сортируются в порядке времени.
+const SnapshotLayout = "20060102T150405Z"
+
+// SnapshotName возвращает имя снимка, начатого в t.
+func SnapshotName(t time.Time) string {
+	return t.UTC().Format(SnapshotLayout)
+}
+
+// SnapshotPath возвращает каталог снимка name в каталоге зеркала dir.
+func SnapshotPath(dir, name string) string {
+	return filepath.Join(dir, SnapshotDir, name)
+}
+
+// NextSnapshot возвращает каталог для снимка обхода, начатого в t. Если снимок
+// с таким именем уже есть, например после обхода в ту же секунду, время
+// сдвигается до свободного имени.
+func NextSnapshot(dir string, t time.Time) string {
+	for {
+		path := SnapshotPath(dir, SnapshotName(t))
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			return path
+		}
+		t = t.Add(time.Second)
+	}
+}
+
+// Snapshots возвращает имена снимков в dir от старых к новым.
+func Snapshots(dir string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(dir, SnapshotDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if _, errParse := time.Parse(SnapshotLayout, e.Name()); e.IsDir() && errParse == nil {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
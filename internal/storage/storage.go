@@ -1,24 +1,110 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"site-mirror/internal/fsutil"
+	"site-mirror/internal/metrics"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 var charLoad = 92
 
+var (
+	ErrNotStored  = errors.New("not stored")
+	ErrUnsafePath = errors.New("path outside the host directory")
+)
+
+// queryReplacer убирает из параметров запроса разделители пути и "..", чтобы
+// имя файла не выходило за каталог хоста.
+var queryReplacer = strings.NewReplacer("&", "_", "/", "_", `\`, "_", "..", "_")
+
+// storedTypes - типы содержимого, от которых зависит имя файла в Path.
+var storedTypes = []string{"text/html", "text/css", "application/javascript", "image/jpeg", "image/png", ""}
+
 type Storage struct {
 	BaseDir string
+	Logger  *slog.Logger
+	Metrics metrics.Metrics
+	// Manifest, если задан, получает запись о каждом сохранённом файле.
+	Manifest *Manifest
+	// Dedup включает блоб-хранилище в BlobDir: одинаковое содержимое хранится один раз.
+	Dedup DedupMode
+	// Blobs - каталог блоб-хранилища, пустой - BlobDir в BaseDir. Снимки
+	// одного сайта делят общий каталог блобов.
+	Blobs string
+
+	dedupFiles atomic.Int64
+	dedupBytes atomic.Int64
 }
 
 func NewStorage(baseDir string) *Storage {
-	return &Storage{BaseDir: baseDir}
+	return &Storage{BaseDir: baseDir, Logger: slog.Default(), Metrics: metrics.Nop{}}
 }
 
 func (s *Storage) Save(u *url.URL, content []byte, contentType string) error {
+	localPath := s.Path(u, contentType)
+	if err := s.CheckPath(u, localPath); err != nil {
+		metrics.Inc(s.metrics(), metrics.SaveErrorsTotal)
+		return err
+	}
+
+	var blob string
+	var err error
+	if s.Dedup == DedupOff {
+		err = s.write(u, localPath, content)
+	} else {
+		blob, err = s.dedup(localPath, content)
+	}
+	if err != nil {
+		metrics.Inc(s.metrics(), metrics.SaveErrorsTotal)
+		return err
+	}
+
+	metrics.Inc(s.metrics(), metrics.SavedFilesTotal)
+	s.metrics().Add(metrics.SavedBytesTotal, float64(len(content)))
+	if s.Manifest != nil {
+		entry := s.manifestEntry(u, localPath, content, contentType)
+		entry.Blob = blob
+		s.Manifest.Set(entry)
+	}
+	return nil
+}
+
+// write заменяет файл, а не пишет в него: на его месте может остаться
+// жёсткая или символическая ссылка на общий блоб от прошлого запуска с -dedup.
+func (s *Storage) write(u *url.URL, localPath string, content []byte) error {
+	s.logger().Debug("saving", "url", u.String(), "path", localPath)
+	return fsutil.WriteFileAtomic(localPath, content, 0644)
+}
+
+// Сохраняются только ответы 200, поэтому статус в манифесте всегда 200.
+func (s *Storage) manifestEntry(u *url.URL, localPath string, content []byte, contentType string) ManifestEntry {
+	rel, err := filepath.Rel(s.BaseDir, localPath)
+	if err != nil {
+		rel = localPath
+	}
+	return ManifestEntry{
+		URL:         u.String(),
+		Path:        filepath.ToSlash(rel),
+		Size:        int64(len(content)),
+		SHA256:      Checksum(content),
+		ContentType: contentType,
+		FetchedAt:   time.Now().UTC(),
+		Status:      http.StatusOK,
+	}
+}
+
+// Path возвращает путь к файлу, в который будет сохранён URL.
+func (s *Storage) Path(u *url.URL, contentType string) string {
 	localPath := filepath.Join(s.BaseDir, u.Host)
 
 	path := u.Path
@@ -28,21 +114,125 @@ func (s *Storage) Save(u *url.URL, content []byte, contentType string) error {
 
 	if u.RawQuery != "" {
 		path = strings.Replace(path, ".", "_", -1) + "_" +
-			strings.Replace(u.RawQuery, "&", "_", -1) + getExtensionFromMIME(contentType)
+			queryReplacer.Replace(u.RawQuery) + getExtensionFromMIME(contentType)
 	} else {
 		if filepath.Ext(path) == "" && strings.HasPrefix(contentType, "text/html") {
 			path += ".html"
 		}
 	}
 
-	localPath = filepath.Join(localPath, path)
+	return filepath.Join(localPath, path)
+}
 
-	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
-		return err
+// CheckPath проверяет, что путь localPath файла URL не выходит за каталог
+// его хоста в BaseDir, например из-за ".." в пути URL.
+func (s *Storage) CheckPath(u *url.URL, localPath string) error {
+	if u.Host == "" || u.Host == "." || u.Host == ".." || strings.ContainsAny(u.Host, `/\`) {
+		return fmt.Errorf("%w: %s", ErrUnsafePath, u)
 	}
+	rel, err := filepath.Rel(filepath.Join(s.BaseDir, u.Host), localPath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%w: %s", ErrUnsafePath, u)
+	}
+	return nil
+}
 
-	fmt.Printf("Saving %s to %s\n", path, localPath)
-	return os.WriteFile(localPath, content, 0644)
+// Find ищет ранее сохранённую копию URL, тип содержимого при поиске неизвестен.
+func (s *Storage) Find(u *url.URL) (string, os.FileInfo, error) {
+	for _, ct := range storedTypes {
+		path := s.Path(u, ct)
+		if s.CheckPath(u, path) != nil {
+			return "", nil, ErrNotStored
+		}
+		fi, err := os.Stat(path)
+		if err == nil && fi.Mode().IsRegular() {
+			return path, fi, nil
+		}
+	}
+	// При DedupPointer файла по пути URL нет, его заменяет блоб из манифеста.
+	if e, ok := s.manifestBlob(u); ok {
+		path := filepath.Join(s.BaseDir, filepath.FromSlash(e.Blob))
+		if fi, err := os.Stat(path); err == nil {
+			return path, fi, nil
+		}
+	}
+	return "", nil, ErrNotStored
+}
+
+// Remove удаляет сохранённую копию URL и её запись в манифесте, например когда
+// страница пропала с сайта. Блоб остаётся: его могут делить другие URL.
+func (s *Storage) Remove(u *url.URL) error {
+	var paths []string
+	if s.Manifest != nil {
+		if e, ok := s.Manifest.Get(u.String()); ok && e.Path != "" {
+			paths = append(paths, filepath.Join(s.BaseDir, filepath.FromSlash(e.Path)))
+		}
+	}
+	for _, ct := range storedTypes {
+		paths = append(paths, s.Path(u, ct))
+	}
+	for _, path := range paths {
+		// Путь без расширения может оказаться каталогом вложенных страниц.
+		if fi, err := os.Lstat(path); err != nil || fi.IsDir() || s.CheckPath(u, path) != nil {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	s.Manifest.Delete(u.String())
+	return nil
+}
+
+func (s *Storage) manifestBlob(u *url.URL) (ManifestEntry, bool) {
+	if s.Manifest == nil {
+		return ManifestEntry{}, false
+	}
+	e, ok := s.Manifest.Get(u.String())
+	return e, ok && e.Blob != ""
+}
+
+// Modified возвращает время записи сохранённой копии URL.
+func (s *Storage) Modified(u *url.URL) (time.Time, error) {
+	_, fi, err := s.Find(u)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
+// Load читает сохранённую копию URL и определяет её тип по расширению или содержимому.
+func (s *Storage) Load(u *url.URL) ([]byte, string, error) {
+	path, _, err := s.Find(u)
+	if err != nil {
+		return nil, "", err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if e, ok := s.manifestBlob(u); ok && contentType == "" {
+		contentType = e.ContentType
+	}
+	if contentType == "" {
+		contentType = http.DetectContentType(content)
+	}
+	return content, contentType, nil
+}
+
+func (s *Storage) metrics() metrics.Metrics {
+	if s.Metrics == nil {
+		return metrics.Nop{}
+	}
+	return s.Metrics
+}
+
+func (s *Storage) logger() *slog.Logger {
+	if s.Logger == nil {
+		return slog.Default()
+	}
+	return s.Logger
 }
 
 func getExtensionFromMIME(contentType string) string {
@@ -1,10 +1,15 @@
 package storage
 
 import (
+	"errors"
+	"fmt"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestStorage_Save(t *testing.T) {
@@ -128,3 +133,335 @@ func TestGetExtensionFromMIME(t *testing.T) {
 		})
 	}
 }
+
+func TestStorage_Path(t *testing.T) {
+	s := NewStorage("/mirror")
+
+	tests := []struct {
+		urlStr      string
+		contentType string
+		want        string
+	}{
+		{"https://example.com/", "text/html", filepath.Join("/mirror", "example.com", "index.html")},
+		{"https://example.com/about", "text/html; charset=utf-8", filepath.Join("/mirror", "example.com", "about.html")},
+		{"https://example.com/data", "application/json", filepath.Join("/mirror", "example.com", "data")},
+		{"https://example.com/list.php?page=2&sort=asc", "text/html", filepath.Join("/mirror", "example.com", "list_php_page=2_sort=asc.html")},
+		{"https://example.com/a?/../../secret", "text/html", filepath.Join("/mirror", "example.com", "a______secret.html")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.urlStr, func(t *testing.T) {
+			u, _ := url.Parse(tt.urlStr)
+			if got := s.Path(u, tt.contentType); got != tt.want {
+				t.Errorf("Path() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStorage_CheckPath(t *testing.T) {
+	s := NewStorage(t.TempDir())
+	for _, raw := range []string{"https://example.com/../secret", "https://example.com/a/../../../secret"} {
+		u := &url.URL{Scheme: "https", Host: "example.com", Path: strings.TrimPrefix(raw, "https://example.com")}
+		if err := s.CheckPath(u, s.Path(u, "text/html")); !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("CheckPath(%s) = %v, want ErrUnsafePath", raw, err)
+		}
+		if err := s.Save(u, []byte("x"), "text/html"); !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("Save(%s) = %v, want ErrUnsafePath", raw, err)
+		}
+	}
+	u, _ := url.Parse("https://example.com/a?/../../secret")
+	if err := s.CheckPath(u, s.Path(u, "text/html")); err != nil {
+		t.Errorf("CheckPath(query) = %v", err)
+	}
+}
+
+func TestStorage_FindLoad(t *testing.T) {
+	s := NewStorage(t.TempDir())
+
+	tests := []struct {
+		urlStr      string
+		content     string
+		contentType string
+		wantType    string
+	}{
+		{"https://example.com/about", "<html>about</html>", "text/html", "text/html"},
+		{"https://example.com/list.php?page=2", "<html>list</html>", "text/html", "text/html"},
+		{"https://example.com/style.css?v=3", "body {}", "text/css", "text/css"},
+		{"https://example.com/data", "plain data", "application/octet-stream", "text/plain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.urlStr, func(t *testing.T) {
+			u, _ := url.Parse(tt.urlStr)
+			if err := s.Save(u, []byte(tt.content), tt.contentType); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			path, fi, err := s.Find(u)
+			if err != nil || path != s.Path(u, tt.contentType) || fi.Size() != int64(len(tt.content)) {
+				t.Fatalf("Find() = %q, %v, want %q", path, err, s.Path(u, tt.contentType))
+			}
+			content, contentType, err := s.Load(u)
+			if err != nil || string(content) != tt.content || !strings.HasPrefix(contentType, tt.wantType) {
+				t.Errorf("Load() = %q, %q, %v", content, contentType, err)
+			}
+		})
+	}
+
+	u, _ := url.Parse("https://example.com/missing")
+	if _, _, err := s.Find(u); !errors.Is(err, ErrNotStored) {
+		t.Errorf("expected ErrNotStored, got %v", err)
+	}
+}
+
+func TestStorage_Manifest(t *testing.T) {
+	dir := t.TempDir()
+	s := NewStorage(dir)
+	s.Manifest = NewManifest()
+
+	page, _ := url.Parse("https://example.com/docs/page")
+	if err := s.Save(page, []byte("<p>v1</p>"), "text/html"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(page, []byte("<p>v2</p>"), "text/html"); err != nil {
+		t.Fatal(err)
+	}
+	e, ok := s.Manifest.Get(page.String())
+	if !ok {
+		t.Fatal("expected manifest entry for saved page")
+	}
+	if e.Path != "example.com/docs/page.html" || e.Size != 9 || e.SHA256 != Checksum([]byte("<p>v2</p>")) ||
+		e.Status != 200 || e.ContentType != "text/html" || e.FetchedAt.IsZero() {
+		t.Errorf("unexpected manifest entry %+v", e)
+	}
+
+	path := filepath.Join(dir, DefaultManifestFile)
+	if err := s.Manifest.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadManifest(path)
+	if err != nil {
+		t.Fatalf("ReadManifest returned error: %v", err)
+	}
+	if got := read.Entries(); len(got) != 1 || got[0].SHA256 != e.SHA256 || !got[0].FetchedAt.Equal(e.FetchedAt) {
+		t.Errorf("manifest did not round-trip: %+v", got)
+	}
+
+	empty, err := ReadManifest(filepath.Join(dir, "missing.json"))
+	if err != nil || len(empty.Entries()) != 0 {
+		t.Errorf("expected empty manifest for missing file, got %v, %v", empty.Entries(), err)
+	}
+}
+
+func TestStorage_Remove(t *testing.T) {
+	dir := t.TempDir()
+	s := NewStorage(dir)
+	s.Manifest = NewManifest()
+	docs, _ := url.Parse("https://example.com/docs")
+	page, _ := url.Parse("https://example.com/docs/page")
+	for _, u := range []*url.URL{docs, page} {
+		if err := s.Save(u, []byte("<p>x</p>"), "text/html"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.Remove(docs); err != nil {
+		t.Fatalf("Remove returned error: %v", err)
+	}
+	if _, _, err := s.Find(docs); !errors.Is(err, ErrNotStored) {
+		t.Errorf("expected removed copy, got %v", err)
+	}
+	if _, ok := s.Manifest.Get(docs.String()); ok {
+		t.Error("expected manifest entry to be deleted")
+	}
+	if _, _, err := s.Find(page); err != nil {
+		t.Errorf("nested page must stay, got %v", err)
+	}
+}
+
+func TestStorage_Dedup(t *testing.T) {
+	logo := []byte("PNG logo bytes")
+	for _, mode := range []DedupMode{DedupHardlink, DedupSymlink, DedupPointer} {
+		t.Run(string(mode), func(t *testing.T) {
+			dir := t.TempDir()
+			s := NewStorage(dir)
+			s.Manifest = NewManifest()
+			s.Dedup = mode
+
+			a, _ := url.Parse("https://example.com/img/logo.png?v=1")
+			b, _ := url.Parse("https://example.com/static/logo.png")
+			for _, u := range []*url.URL{a, b, b} {
+				if err := s.Save(u, logo, "image/png"); err != nil {
+					t.Fatalf("Save(%s) returned error: %v", u, err)
+				}
+			}
+
+			blob := filepath.Join(dir, BlobDir, Checksum(logo)[:2], Checksum(logo))
+			if content, err := os.ReadFile(blob); err != nil || string(content) != string(logo) {
+				t.Fatalf("expected blob with content, got %q %v", content, err)
+			}
+			if stats := s.DedupStats(); stats.Files != 2 || stats.Bytes != int64(2*len(logo)) {
+				t.Errorf("expected 2 deduplicated files, got %+v", stats)
+			}
+			e, _ := s.Manifest.Get(b.String())
+			if e.Blob != filepath.ToSlash(filepath.Join(BlobDir, Checksum(logo)[:2], Checksum(logo))) {
+				t.Errorf("unexpected blob in manifest %q", e.Blob)
+			}
+
+			fi, err := os.Lstat(s.Path(b, "image/png"))
+			switch mode {
+			case DedupHardlink:
+				bi, _ := os.Stat(blob)
+				if err != nil || !os.SameFile(fi, bi) {
+					t.Errorf("expected hardlink to the blob, got %v", err)
+				}
+			case DedupSymlink:
+				if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+					t.Errorf("expected symlink, got %v %v", fi, err)
+				}
+			case DedupPointer:
+				if !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("expected no file for pointer, got %v", err)
+				}
+			}
+
+			content, contentType, err := s.Load(b)
+			if err != nil || string(content) != string(logo) || contentType != "image/png" {
+				t.Errorf("Load returned %q %q %v", content, contentType, err)
+			}
+		})
+	}
+}
+
+func TestStorage_SaveReplacesLink(t *testing.T) {
+	logo := []byte("PNG logo bytes")
+	for _, mode := range []DedupMode{DedupHardlink, DedupSymlink} {
+		t.Run(string(mode), func(t *testing.T) {
+			dir := t.TempDir()
+			s := NewStorage(dir)
+			s.Dedup = mode
+
+			a, _ := url.Parse("https://example.com/a.png")
+			b, _ := url.Parse("https://example.com/b.png")
+			for _, u := range []*url.URL{a, b} {
+				if err := s.Save(u, logo, "image/png"); err != nil {
+					t.Fatalf("Save(%s) returned error: %v", u, err)
+				}
+			}
+
+			// Запуск без -dedup не должен писать через ссылку в общий блоб.
+			s.Dedup = DedupOff
+			if err := s.Save(a, []byte("new logo"), "image/png"); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := os.ReadFile(s.Path(a, "image/png")); string(got) != "new logo" {
+				t.Errorf("a.png was not rewritten: %q", got)
+			}
+			if got, _ := os.ReadFile(s.Path(b, "image/png")); string(got) != string(logo) {
+				t.Errorf("b.png changed through the shared blob: %q", got)
+			}
+			blob := filepath.Join(dir, BlobDir, Checksum(logo)[:2], Checksum(logo))
+			if got, _ := os.ReadFile(blob); string(got) != string(logo) {
+				t.Errorf("blob changed: %q", got)
+			}
+		})
+	}
+}
+
+func TestStorage_DedupConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	s := NewStorage(dir)
+	s.Manifest = NewManifest()
+	s.Dedup = DedupHardlink
+	content := []byte("shared script")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u, _ := url.Parse(fmt.Sprintf("https://example.com/js/app%d.js", i))
+			errs <- s.Save(u, content, "application/javascript")
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("concurrent Save returned error: %v", err)
+		}
+	}
+
+	blobDir := filepath.Join(dir, BlobDir, Checksum(content)[:2])
+	entries, err := os.ReadDir(blobDir)
+	if err != nil || len(entries) != 1 || entries[0].Name() != Checksum(content) {
+		t.Fatalf("expected only the blob in %s, got %v %v", blobDir, entries, err)
+	}
+	if stats := s.DedupStats(); stats.Files > 19 {
+		t.Errorf("unexpected dedup stats %+v", stats)
+	}
+
+	// Обрезанный блоб того же имени перезаписывается.
+	blob := filepath.Join(blobDir, Checksum(content))
+	if err = os.WriteFile(blob, content[:5], 0644); err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse("https://example.com/js/other.js")
+	if err = s.Save(u, content, "application/javascript"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(s.Path(u, "application/javascript")); string(got) != string(content) {
+		t.Errorf("truncated blob was kept: %q", got)
+	}
+}
+
+func TestParseDedup(t *testing.T) {
+	if mode, err := ParseDedup("symlink"); err != nil || mode != DedupSymlink {
+		t.Errorf("ParseDedup(symlink) = %q, %v", mode, err)
+	}
+	if _, err := ParseDedup("copy"); !errors.Is(err, ErrUnknownDedup) {
+		t.Errorf("expected ErrUnknownDedup, got %v", err)
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	first := NextSnapshot(dir, start)
+	if err := os.MkdirAll(first, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Второй обход в ту же секунду получает следующее имя.
+	second := NextSnapshot(dir, start)
+	if err := os.MkdirAll(second, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, SnapshotDir, "notes"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := Snapshots(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0] != "20261018T090000Z" || names[1] != "20261018T090001Z" {
+		t.Errorf("unexpected snapshots %v", names)
+	}
+
+	// Снимки делят общий каталог блобов.
+	s := NewStorage(second)
+	s.Dedup = DedupHardlink
+	s.Blobs = filepath.Join(dir, BlobDir)
+	s.Manifest = NewManifest()
+	u, _ := url.Parse("https://example.com/")
+	if err = s.Save(u, []byte("page"), "text/html"); err != nil {
+		t.Fatal(err)
+	}
+	e, _ := s.Manifest.Get(u.String())
+	if !strings.HasPrefix(e.Blob, "../../"+BlobDir+"/") {
+		t.Errorf("expected blob outside the snapshot, got %q", e.Blob)
+	}
+	if content, errRead := ReadEntry(second, e); errRead != nil || string(content) != "page" {
+		t.Errorf("ReadEntry returned %q %v", content, errRead)
+	}
+}
@@ -0,0 +1,312 @@
+package transform
+
+import (
+	"bytes"
+	"mime"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"site-mirror/internal/mediatype"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// HTMLTypes - типы содержимого, к которым применяются HTML-преобразования.
+var HTMLTypes = []string{"text/html", "application/xhtml+xml"}
+
+// HTML превращает функцию над деревом документа в Transformer для HTML.
+func HTML(f func(doc *Document, root *html.Node) error) Transformer {
+	return Func(func(doc *Document) error {
+		root, err := html.Parse(bytes.NewReader(doc.Body))
+		if err != nil {
+			return err
+		}
+		if err = f(doc, root); err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err = html.Render(&buf, root); err != nil {
+			return err
+		}
+		doc.Body = buf.Bytes()
+		return nil
+	})
+}
+
+func walk(n *html.Node, f func(n *html.Node)) {
+	for c := n.FirstChild; c != nil; {
+		// f может удалить c из дерева, поэтому следующий узел берётся заранее.
+		next := c.NextSibling
+		if c.Type == html.ElementNode {
+			f(c)
+		}
+		if c.Parent != nil {
+			walk(c, f)
+		}
+		c = next
+	}
+}
+
+func attr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func removeAttr(n *html.Node, key string) {
+	attrs := n.Attr[:0]
+	for _, a := range n.Attr {
+		if a.Key != key {
+			attrs = append(attrs, a)
+		}
+	}
+	n.Attr = attrs
+}
+
+// linkAttrs - атрибуты со ссылками, которые переписывает RewriteLinks.
+var linkAttrs = map[string][]string{
+	"a":      {"href"},
+	"area":   {"href"},
+	"link":   {"href"},
+	"script": {"src"},
+	"img":    {"src"},
+	"iframe": {"src"},
+	"source": {"src"},
+	"audio":  {"src"},
+	"video":  {"src", "poster"},
+	"embed":  {"src"},
+	"track":  {"src"},
+}
+
+var (
+	cssURLRe    = regexp.MustCompile(`url\(\s*(['"]?)([^'")]+?)(['"]?)\s*\)`)
+	cssImportRe = regexp.MustCompile(`@import\s+(['"])([^'"]+)(['"])`)
+)
+
+// MapLinks заменяет ссылки в HTML и CSS: Map получает абсолютный http(s) URL без
+// фрагмента и угаданный тип цели и возвращает новую ссылку или false, чтобы оставить старую.
+type MapLinks struct {
+	Map func(doc *Document, u *url.URL, contentType string) (string, bool)
+}
+
+func (m MapLinks) Transform(doc *Document) error {
+	if mediatype.Of(doc.ContentType) == "text/css" {
+		doc.Body = m.rewriteCSS(doc, doc.URL, doc.Body)
+		return nil
+	}
+	return HTML(m.rewriteHTML).Transform(doc)
+}
+
+func (m MapLinks) rewriteHTML(doc *Document, root *html.Node) error {
+	base := doc.URL
+	walk(root, func(n *html.Node) {
+		if n.DataAtom != atom.Base || base != doc.URL {
+			return
+		}
+		if href, ok := attr(n, "href"); ok {
+			if u, err := url.Parse(href); err == nil {
+				base = doc.URL.ResolveReference(u)
+			}
+		}
+	})
+
+	walk(root, func(n *html.Node) {
+		for _, key := range linkAttrs[n.Data] {
+			for i, a := range n.Attr {
+				if a.Key != key {
+					continue
+				}
+				if link, ok := m.link(doc, base, a.Val, linkType(n)); ok {
+					n.Attr[i].Val = link
+				}
+			}
+		}
+		if n.DataAtom == atom.Style && n.FirstChild != nil && n.FirstChild.Type == html.TextNode {
+			n.FirstChild.Data = string(m.rewriteCSS(doc, base, []byte(n.FirstChild.Data)))
+		}
+	})
+	return nil
+}
+
+func (m MapLinks) rewriteCSS(doc *Document, base *url.URL, css []byte) []byte {
+	replace := func(re *regexp.Regexp, contentType string, prefix string) {
+		css = re.ReplaceAllFunc(css, func(match []byte) []byte {
+			sub := re.FindSubmatch(match)
+			link, ok := m.link(doc, base, string(sub[2]), contentType)
+			if !ok {
+				return match
+			}
+			if prefix == "url(" {
+				return []byte("url(" + string(sub[1]) + link + string(sub[3]) + ")")
+			}
+			return []byte("@import " + string(sub[1]) + link + string(sub[3]))
+		})
+	}
+	replace(cssImportRe, "text/css", "@import")
+	replace(cssURLRe, "", "url(")
+	return css
+}
+
+func (m MapLinks) link(doc *Document, base *url.URL, ref, contentType string) (string, bool) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.HasPrefix(ref, "#") {
+		return "", false
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", false
+	}
+	abs := base.ResolveReference(u)
+	if abs.Scheme != "http" && abs.Scheme != "https" {
+		return "", false
+	}
+	fragment := abs.Fragment
+	abs.Fragment = ""
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(abs.Path))
+	}
+	link, ok := m.Map(doc, abs, contentType)
+	if !ok {
+		return "", false
+	}
+	if fragment != "" {
+		link += (&url.URL{Fragment: fragment}).String()
+	}
+	return link, true
+}
+
+// RewriteLinks заменяет ссылки на тот же хост относительными путями к локальным
+// копиям, чтобы зеркало открывалось без сервера. Path - путь сохранения URL.
+type RewriteLinks struct {
+	Path func(u *url.URL, contentType string) string
+}
+
+func (r RewriteLinks) Transform(doc *Document) error {
+	return MapLinks{Map: r.local}.Transform(doc)
+}
+
+// local возвращает относительный путь от копии документа к копии u.
+func (r RewriteLinks) local(doc *Document, u *url.URL, contentType string) (string, bool) {
+	if u.Host != doc.URL.Host {
+		return "", false
+	}
+	from := filepath.Dir(r.Path(doc.URL, doc.ContentType))
+	rel, err := filepath.Rel(from, r.Path(u, contentType))
+	if err != nil {
+		return "", false
+	}
+	return (&url.URL{Path: filepath.ToSlash(rel)}).String(), true
+}
+
+// linkType угадывает тип файла по элементу, пока он не скачан.
+func linkType(n *html.Node) string {
+	switch n.DataAtom {
+	case atom.A, atom.Area, atom.Iframe:
+		return "text/html"
+	case atom.Script:
+		return "application/javascript"
+	case atom.Link:
+		if rel, _ := attr(n, "rel"); strings.EqualFold(rel, "stylesheet") {
+			return "text/css"
+		}
+	}
+	return ""
+}
+
+// DefaultTrackers - шаблоны распространённых счётчиков и систем аналитики.
+func DefaultTrackers() []*regexp.Regexp {
+	return []*regexp.Regexp{
+		regexp.MustCompile(`google-analytics\.com`),
+		regexp.MustCompile(`googletagmanager\.com`),
+		regexp.MustCompile(`\bgtag\(`),
+		regexp.MustCompile(`mc\.yandex\.ru/(metrika|watch)`),
+		regexp.MustCompile(`connect\.facebook\.net`),
+		regexp.MustCompile(`static\.hotjar\.com`),
+		regexp.MustCompile(`cdn\.segment\.com`),
+		regexp.MustCompile(`plausible\.io/js`),
+	}
+}
+
+// StripTrackers удаляет <script> и <noscript>, чей адрес или текст подходит
+// под один из шаблонов.
+type StripTrackers struct {
+	Patterns []*regexp.Regexp
+}
+
+func (s StripTrackers) Transform(doc *Document) error {
+	return HTML(func(_ *Document, root *html.Node) error {
+		walk(root, func(n *html.Node) {
+			if n.DataAtom != atom.Script && n.DataAtom != atom.Noscript {
+				return
+			}
+			src, _ := attr(n, "src")
+			text := src
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				if c.Type == html.TextNode {
+					text += c.Data
+				}
+			}
+			for _, re := range s.Patterns {
+				if re.MatchString(text) {
+					n.Parent.RemoveChild(n)
+					return
+				}
+			}
+		})
+		return nil
+	}).Transform(doc)
+}
+
+// removeSRI снимает integrity с ресурсов: после переписывания ссылок хеш
+// перестаёт совпадать и браузер отказывается их загружать.
+func removeSRI(_ *Document, root *html.Node) error {
+	walk(root, func(n *html.Node) {
+		if n.DataAtom == atom.Script || n.DataAtom == atom.Link {
+			removeAttr(n, "integrity")
+		}
+	})
+	return nil
+}
+
+// RemoveBase удаляет <base>, обычно после переписывания ссылок.
+func RemoveBase(_ *Document, root *html.Node) error {
+	walk(root, func(n *html.Node) {
+		if n.DataAtom == atom.Base {
+			n.Parent.RemoveChild(n)
+		}
+	})
+	return nil
+}
+
+const bannerStyle = "margin:0;padding:6px 12px;background:#fff3cd;color:#333;" +
+	"font:14px/1.4 sans-serif;border-bottom:1px solid #e0c97f"
+
+// Banner добавляет в начало <body> строку об источнике и времени копии.
+func Banner(doc *Document, root *html.Node) error {
+	var body *html.Node
+	walk(root, func(n *html.Node) {
+		if n.DataAtom == atom.Body && body == nil {
+			body = n
+		}
+	})
+	if body == nil {
+		return nil
+	}
+
+	link := &html.Node{Type: html.ElementNode, Data: "a", DataAtom: atom.A,
+		Attr: []html.Attribute{{Key: "href", Val: doc.URL.String()}}}
+	link.AppendChild(&html.Node{Type: html.TextNode, Data: doc.URL.String()})
+	div := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div,
+		Attr: []html.Attribute{{Key: "class", Val: "site-mirror-banner"}, {Key: "style", Val: bannerStyle}}}
+	div.AppendChild(&html.Node{Type: html.TextNode, Data: "Archived from "})
+	div.AppendChild(link)
+	div.AppendChild(&html.Node{Type: html.TextNode, Data: " on " + doc.FetchedAt.UTC().Format("2006-01-02 15:04 UTC")})
+	body.InsertBefore(div, body.FirstChild)
+	return nil
+}
@@ -0,0 +1,204 @@
+package transform
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"site-mirror/internal/mediatype"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnknownTransformer = errors.New("unknown transformer")
+	ErrInvalidSpec        = errors.New("invalid transform spec")
+)
+
+// Имена встроенных преобразований для флага -transform.
+const (
+	RewriteLinksName  = "rewrite-links"
+	StripTrackersName = "strip-trackers"
+	RemoveSRIName     = "remove-sri"
+	BannerName        = "banner"
+	RemoveBaseName    = "remove-base"
+)
+
+// order - порядок встроенных преобразований: ссылки переписываются, пока <base>
+// ещё на месте, а баннер добавляется последним, чтобы его ссылку не переписали.
+var order = []string{StripTrackersName, RemoveSRIName, RewriteLinksName, RemoveBaseName, BannerName}
+
+// Document - скачанный файл перед сохранением.
+type Document struct {
+	URL         *url.URL
+	ContentType string
+	Body        []byte
+	FetchedAt   time.Time
+}
+
+type Transformer interface {
+	Transform(doc *Document) error
+}
+
+type Func func(doc *Document) error
+
+func (f Func) Transform(doc *Document) error {
+	return f(doc)
+}
+
+// Rule применяет Transformer к документам, чей URL подходит под Pattern,
+// а тип - под Types. Пустые Pattern и Types подходят всем.
+type Rule struct {
+	Pattern     *regexp.Regexp
+	Types       []string
+	Transformer Transformer
+}
+
+func (r Rule) matches(doc *Document) bool {
+	if r.Pattern != nil && !r.Pattern.MatchString(doc.URL.String()) {
+		return false
+	}
+	if len(r.Types) == 0 {
+		return true
+	}
+	mt := mediatype.Of(doc.ContentType)
+	for _, t := range r.Types {
+		if t == mt {
+			return true
+		}
+	}
+	return false
+}
+
+// Pipeline применяет подходящие правила по порядку.
+type Pipeline struct {
+	rules []Rule
+}
+
+func (p *Pipeline) Add(rules ...Rule) {
+	p.rules = append(p.rules, rules...)
+}
+
+func (p *Pipeline) Len() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.rules)
+}
+
+func (p *Pipeline) Apply(doc *Document) error {
+	if p == nil {
+		return nil
+	}
+	for _, r := range p.rules {
+		if !r.matches(doc) {
+			continue
+		}
+		if err := r.Transformer.Transform(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Spec - встроенные преобразования для URL, подходящих под Pattern.
+type Spec struct {
+	Names   []string
+	Pattern *regexp.Regexp
+}
+
+// ParseSpec разбирает "имя[,имя...][@регулярное выражение]".
+func ParseSpec(s string) (Spec, error) {
+	names, pattern, hasPattern := strings.Cut(s, "@")
+	var spec Spec
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !known(name) {
+			return Spec{}, fmt.Errorf("%w %q", ErrUnknownTransformer, name)
+		}
+		spec.Names = append(spec.Names, name)
+	}
+	if len(spec.Names) == 0 {
+		return Spec{}, fmt.Errorf("%w: %q has no transformers", ErrInvalidSpec, s)
+	}
+	if hasPattern {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return Spec{}, fmt.Errorf("%w: %v", ErrInvalidSpec, err)
+		}
+		spec.Pattern = re
+	}
+	return spec, nil
+}
+
+func (s Spec) String() string {
+	if s.Pattern == nil {
+		return strings.Join(s.Names, ",")
+	}
+	return strings.Join(s.Names, ",") + "@" + s.Pattern.String()
+}
+
+// Names возвращает имена встроенных преобразований в порядке применения.
+func Names() []string {
+	return append([]string(nil), order...)
+}
+
+func known(name string) bool {
+	for _, n := range order {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Env - то, что нужно встроенным преобразованиям от обхода.
+type Env struct {
+	// Path - путь, по которому сохраняется URL; нужен для rewrite-links.
+	Path     func(u *url.URL, contentType string) string
+	Trackers []*regexp.Regexp
+}
+
+// Build собирает правила из спецификаций. Внутри каждой спецификации
+// преобразования идут в порядке order, независимо от порядка в списке.
+func Build(specs []Spec, env Env) ([]Rule, error) {
+	var rules []Rule
+	for _, spec := range specs {
+		for _, name := range order {
+			if !contains(spec.Names, name) {
+				continue
+			}
+			rule := Rule{Pattern: spec.Pattern, Types: HTMLTypes}
+			switch name {
+			case RewriteLinksName:
+				if env.Path == nil {
+					return nil, fmt.Errorf("%w: %s needs local file paths", ErrInvalidSpec, name)
+				}
+				rule.Types = append([]string{"text/css"}, HTMLTypes...)
+				rule.Transformer = RewriteLinks{Path: env.Path}
+			case StripTrackersName:
+				rule.Transformer = StripTrackers{Patterns: append(DefaultTrackers(), env.Trackers...)}
+			case RemoveSRIName:
+				rule.Transformer = HTML(removeSRI)
+			case BannerName:
+				rule.Transformer = HTML(Banner)
+			case RemoveBaseName:
+				rule.Transformer = HTML(RemoveBase)
+			}
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
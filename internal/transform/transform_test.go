@@ -0,0 +1,194 @@
+package transform
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"site-mirror/internal/storage"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSpec(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr error
+	}{
+		{in: "rewrite-links", want: "rewrite-links"},
+		{in: "banner, remove-sri@/docs/", want: "banner,remove-sri@/docs/"},
+		{in: "banner@", want: "banner@"},
+		{in: "unknown", wantErr: ErrUnknownTransformer},
+		{in: "@/docs/", wantErr: ErrInvalidSpec},
+		{in: "banner@(", wantErr: ErrInvalidSpec},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			spec, err := ParseSpec(tt.in)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseSpec(%q) error = %v, want %v", tt.in, err, tt.wantErr)
+			}
+			if err == nil && spec.String() != tt.want {
+				t.Errorf("ParseSpec(%q) = %q, want %q", tt.in, spec.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestBuild(t *testing.T) {
+	st := storage.NewStorage("/out")
+	pageURL, _ := url.Parse("https://example.com/docs/guide/intro")
+	fetched := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		specs       string
+		contentType string
+		url         *url.URL
+		body        string
+		want        []string
+		wantNot     []string
+	}{
+		{
+			name:        "rewrite links",
+			specs:       "rewrite-links",
+			contentType: "text/html",
+			body: `<a href="/docs/api#top">api</a><a href="https://other.com/x">ext</a>` +
+				`<link rel="stylesheet" href="/css/site.css"><img src="../img/logo.png"><a href="#local">l</a>` +
+				`<style>body{background:url("/img/bg.png")}</style>`,
+			want: []string{`href="../api.html#top"`, `href="https://other.com/x"`, `href="../../css/site.css"`,
+				`src="../img/logo.png"`, `href="#local"`, `url("../../img/bg.png")`},
+		},
+		{
+			name:        "rewrite links against base",
+			specs:       "rewrite-links,remove-base",
+			contentType: "text/html",
+			body:        `<head><base href="/blog/"></head><a href="post">post</a>`,
+			want:        []string{`href="../../blog/post.html"`},
+			wantNot:     []string{"<base"},
+		},
+		{
+			name:        "rewrite css",
+			specs:       "rewrite-links",
+			contentType: "text/css",
+			url:         mustParse("https://example.com/css/site.css"),
+			body:        `@import "/css/base.css"; a{background:url(/img/a.png)} b{background:url(data:image/png;base64,AA)}`,
+			want:        []string{`@import "base.css"`, `url(../img/a.png)`, `url(data:image/png;base64,AA)`},
+		},
+		{
+			name:        "strip trackers",
+			specs:       "strip-trackers",
+			contentType: "text/html",
+			body: `<script async src="https://www.googletagmanager.com/gtag/js?id=G-1"></script>` +
+				`<script>window.dataLayer=[];gtag('js', new Date());</script><script src="/app.js"></script>`,
+			want:    []string{`src="/app.js"`},
+			wantNot: []string{"googletagmanager", "gtag("},
+		},
+		{
+			name:        "remove sri and banner",
+			specs:       "remove-sri,banner",
+			contentType: "text/html; charset=utf-8",
+			body:        `<html><body><script src="/a.js" integrity="sha384-x" crossorigin="anonymous"></script></body></html>`,
+			want:        []string{`<body><div class="site-mirror-banner"`, "Archived from", "2024-03-01 12:30 UTC", `crossorigin="anonymous"`},
+			wantNot:     []string{"integrity"},
+		},
+		{
+			name:        "pattern does not match",
+			specs:       "banner@/blog/",
+			contentType: "text/html",
+			body:        `<p>text</p>`,
+			wantNot:     []string{"site-mirror-banner"},
+		},
+		{
+			name:        "html transformers skip other types",
+			specs:       "banner,remove-sri",
+			contentType: "application/javascript",
+			body:        `var integrity = "<body>";`,
+			want:        []string{`var integrity = "<body>";`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var specs []Spec
+			for _, s := range strings.Split(tt.specs, " ") {
+				spec, err := ParseSpec(s)
+				if err != nil {
+					t.Fatal(err)
+				}
+				specs = append(specs, spec)
+			}
+			rules, err := Build(specs, Env{Path: st.Path})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var p Pipeline
+			p.Add(rules...)
+
+			u := tt.url
+			if u == nil {
+				u = pageURL
+			}
+			doc := &Document{URL: u, ContentType: tt.contentType, Body: []byte(tt.body), FetchedAt: fetched}
+			if err = p.Apply(doc); err != nil {
+				t.Fatal(err)
+			}
+			got := string(doc.Body)
+			for _, w := range tt.want {
+				if !strings.Contains(got, w) {
+					t.Errorf("output lacks %q:\n%s", w, got)
+				}
+			}
+			for _, w := range tt.wantNot {
+				if strings.Contains(got, w) {
+					t.Errorf("output contains %q:\n%s", w, got)
+				}
+			}
+		})
+	}
+}
+
+func TestBuild_Errors(t *testing.T) {
+	spec, _ := ParseSpec(RewriteLinksName)
+	if _, err := Build([]Spec{spec}, Env{}); !errors.Is(err, ErrInvalidSpec) {
+		t.Errorf("Build without Path error = %v, want %v", err, ErrInvalidSpec)
+	}
+}
+
+func TestStripTrackers_CustomPattern(t *testing.T) {
+	spec, _ := ParseSpec(StripTrackersName)
+	rules, err := Build([]Spec{spec}, Env{Trackers: []*regexp.Regexp{regexp.MustCompile(`stats\.example\.com`)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p Pipeline
+	p.Add(rules...)
+	doc := &Document{
+		URL:         mustParse("https://example.com/"),
+		ContentType: "text/html",
+		Body:        []byte(`<script src="https://stats.example.com/s.js"></script><noscript><img src="https://mc.yandex.ru/watch/1"></noscript>`),
+	}
+	if err = p.Apply(doc); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(doc.Body); strings.Contains(got, "stats.example.com") || strings.Contains(got, "noscript") {
+		t.Errorf("trackers left in output:\n%s", got)
+	}
+}
+
+func TestPipeline_Nil(t *testing.T) {
+	var p *Pipeline
+	doc := &Document{URL: mustParse("https://example.com/"), Body: []byte("x")}
+	if p.Len() != 0 || p.Apply(doc) != nil || string(doc.Body) != "x" {
+		t.Error("nil pipeline must keep documents unchanged")
+	}
+}
+
+func mustParse(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
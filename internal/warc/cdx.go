@@ -0,0 +1,152 @@
+package warc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCDX = errors.New("invalid CDX index")
+
+// TimestampFormat - формат времени снимка в CDX и адресах воспроизведения.
+const TimestampFormat = "20060102150405"
+
+// Capture - снимок URL: где в архиве лежит запись и что о ней известно.
+type Capture struct {
+	URL      string
+	Time     time.Time
+	MIME     string
+	Status   int
+	Digest   string
+	Length   int64
+	Offset   int64
+	Filename string
+}
+
+func (c Capture) Timestamp() string {
+	return c.Time.UTC().Format(TimestampFormat)
+}
+
+// ParseTimestamp разбирает время снимка; неполное время ("2024", "202403")
+// дополняется началом периода.
+func ParseTimestamp(s string) (time.Time, error) {
+	const zero = "00000101000000"
+	if len(s) < 4 || len(s) > len(zero) {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+	}
+	if _, err := strconv.ParseUint(s, 10, 64); err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+	}
+	return time.Parse(TimestampFormat, s+zero[len(s):])
+}
+
+// ReadCDX читает индекс в формате CDX: первая строка " CDX ..." перечисляет поля.
+// Нужны поля a (URL), b (время), V (смещение) и g (файл архива).
+func ReadCDX(r io.Reader) ([]Capture, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	if !sc.Scan() {
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: empty", ErrInvalidCDX)
+	}
+	header := strings.Fields(sc.Text())
+	if len(header) < 2 || header[0] != "CDX" {
+		return nil, fmt.Errorf("%w: header %q", ErrInvalidCDX, sc.Text())
+	}
+	fields := header[1:]
+	pos := make(map[string]int, len(fields))
+	for i, f := range fields {
+		pos[f] = i
+	}
+	for _, f := range []string{"a", "b", "V", "g"} {
+		if _, ok := pos[f]; !ok {
+			return nil, fmt.Errorf("%w: no %q field in header", ErrInvalidCDX, f)
+		}
+	}
+
+	var captures []Capture
+	for line := 2; sc.Scan(); line++ {
+		if strings.TrimSpace(sc.Text()) == "" {
+			continue
+		}
+		values := strings.Fields(sc.Text())
+		if len(values) != len(fields) {
+			return nil, fmt.Errorf("%w: line %d has %d fields, want %d", ErrInvalidCDX, line, len(values), len(fields))
+		}
+		get := func(f string) string {
+			i, ok := pos[f]
+			if !ok || values[i] == "-" {
+				return ""
+			}
+			return values[i]
+		}
+
+		c := Capture{URL: get("a"), MIME: get("m"), Digest: get("k"), Filename: get("g")}
+		var err error
+		if c.Time, err = ParseTimestamp(get("b")); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidCDX, line, err)
+		}
+		if c.Offset, err = strconv.ParseInt(get("V"), 10, 64); err != nil {
+			return nil, fmt.Errorf("%w: line %d: offset %q", ErrInvalidCDX, line, get("V"))
+		}
+		if s := get("S"); s != "" {
+			c.Length, _ = strconv.ParseInt(s, 10, 64)
+		}
+		if s := get("s"); s != "" {
+			c.Status, _ = strconv.Atoi(s)
+		}
+		captures = append(captures, c)
+	}
+	return captures, sc.Err()
+}
+
+// Index строит индекс архива path без CDX, просматривая все записи.
+func Index(path string) ([]Capture, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var captures []Capture
+	r := NewReader(f)
+	for {
+		rec, offset, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return captures, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if rec.Type() != TypeResponse && rec.Type() != TypeResource {
+			continue
+		}
+		date, err := rec.Date()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w: WARC-Date at offset %d", path, ErrInvalidRecord, offset)
+		}
+		c := Capture{
+			URL:      rec.TargetURI(),
+			Time:     date,
+			Digest:   rec.Header.Get("WARC-Payload-Digest"),
+			Offset:   offset,
+			Length:   r.r.n - offset,
+			Filename: filepath.Base(path),
+		}
+		if resp, err := rec.Response(); err == nil {
+			c.Status = resp.StatusCode
+			c.MIME, _, _ = mime.ParseMediaType(resp.Header.Get("Content-Type"))
+			_ = resp.Body.Close()
+		}
+		captures = append(captures, c)
+	}
+}
@@ -0,0 +1,203 @@
+// Package warc читает архивы WARC (ISO 28500) и индексы CDX к ним.
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidRecord = errors.New("invalid WARC record")
+	ErrNotResponse   = errors.New("WARC record holds no HTTP response")
+)
+
+// Типы записей, из которых воспроизводятся ответы.
+const (
+	TypeResponse = "response"
+	TypeResource = "resource"
+)
+
+type Record struct {
+	Header  textproto.MIMEHeader
+	Content []byte
+}
+
+func (r *Record) Type() string {
+	return r.Header.Get("WARC-Type")
+}
+
+// TargetURI возвращает исходный URL; старые архивы пишут его в угловых скобках.
+func (r *Record) TargetURI() string {
+	return strings.Trim(r.Header.Get("WARC-Target-URI"), "<>")
+}
+
+func (r *Record) Date() (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, r.Header.Get("WARC-Date"))
+}
+
+// Response разбирает сохранённый ответ: у response это HTTP-сообщение целиком,
+// у resource - только тело с типом из заголовка записи.
+func (r *Record) Response() (*http.Response, error) {
+	switch r.Type() {
+	case TypeResponse:
+		return http.ReadResponse(bufio.NewReader(bytes.NewReader(r.Content)), nil)
+	case TypeResource:
+		header := make(http.Header)
+		if ct := r.Header.Get("Content-Type"); ct != "" {
+			header.Set("Content-Type", ct)
+		}
+		return &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        header,
+			ContentLength: int64(len(r.Content)),
+			Body:          io.NopCloser(bytes.NewReader(r.Content)),
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s record", ErrNotResponse, r.Type())
+	}
+}
+
+// Reader читает записи подряд. В архивах .warc.gz каждая запись - отдельный
+// поток gzip, и смещения указывают на начало сжатого потока.
+type Reader struct {
+	r *countingReader
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: &countingReader{br: bufio.NewReader(r)}}
+}
+
+// Next возвращает следующую запись и её смещение; после последней - io.EOF.
+func (r *Reader) Next() (*Record, int64, error) {
+	offset := r.r.n
+	magic, err := r.r.br.Peek(2)
+	if len(magic) == 0 && err != nil {
+		return nil, offset, err
+	}
+	if !bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		rec, err := readRecord(r.r)
+		return rec, offset, err
+	}
+
+	// countingReader реализует io.ByteReader, поэтому gzip не читает дальше своего потока.
+	zr, err := gzip.NewReader(r.r)
+	if err != nil {
+		return nil, offset, err
+	}
+	zr.Multistream(false)
+	rec, err := readRecord(&countingReader{br: bufio.NewReader(zr)})
+	if err != nil {
+		return nil, offset, err
+	}
+	if _, err = io.Copy(io.Discard, zr); err != nil {
+		return nil, offset, err
+	}
+	return rec, offset, zr.Close()
+}
+
+// ReadAt читает одну запись архива path по смещению из индекса.
+func ReadAt(path string, offset int64) (*Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	rec, _, err := NewReader(f).Next()
+	if errors.Is(err, io.EOF) {
+		err = fmt.Errorf("%w: nothing at offset %d of %s", ErrInvalidRecord, offset, path)
+	}
+	return rec, err
+}
+
+func readRecord(r *countingReader) (*Record, error) {
+	version, err := r.line()
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(version, "WARC/") {
+		return nil, fmt.Errorf("%w: unexpected %q at offset %d", ErrInvalidRecord, version, r.n)
+	}
+
+	rec := &Record{Header: make(textproto.MIMEHeader)}
+	var last string
+	for {
+		line, err := r.line()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRecord, err)
+		}
+		if line == "" {
+			break
+		}
+		if (line[0] == ' ' || line[0] == '\t') && last != "" {
+			values := rec.Header[last]
+			values[len(values)-1] += " " + strings.TrimSpace(line)
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: header line %q", ErrInvalidRecord, line)
+		}
+		last = textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(key))
+		rec.Header.Add(last, strings.TrimSpace(value))
+	}
+
+	length, err := strconv.ParseInt(rec.Header.Get("Content-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("%w: Content-Length %q", ErrInvalidRecord, rec.Header.Get("Content-Length"))
+	}
+	rec.Content = make([]byte, length)
+	if _, err = io.ReadFull(r, rec.Content); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRecord, err)
+	}
+	// После содержимого идут два CRLF.
+	for {
+		b, err := r.br.Peek(1)
+		if err != nil || (b[0] != '\r' && b[0] != '\n') {
+			break
+		}
+		_, _ = r.ReadByte()
+	}
+	return rec, nil
+}
+
+// countingReader считает прочитанные байты, чтобы знать смещения записей.
+type countingReader struct {
+	br *bufio.Reader
+	n  int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.br.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.br.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+func (c *countingReader) line() (string, error) {
+	s, err := c.br.ReadString('\n')
+	c.n += int64(len(s))
+	if err != nil && (s == "" || !errors.Is(err, io.EOF)) {
+		return "", err
+	}
+	return strings.TrimRight(s, "\r\n"), nil
+}
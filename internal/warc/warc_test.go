@@ -0,0 +1,192 @@
+package warc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// record возвращает запись WARC в том виде, в каком её пишут краулеры.
+func record(typ, uri, date, contentType, content string) string {
+	return fmt.Sprintf("WARC/1.0\r\nWARC-Type: %s\r\nWARC-Target-URI: %s\r\nWARC-Date: %s\r\n"+
+		"Content-Type: %s\r\nContent-Length: %d\r\n\r\n%s\r\n\r\n", typ, uri, date, contentType, len(content), content)
+}
+
+func httpResponse(status, contentType, body string) string {
+	return fmt.Sprintf("HTTP/1.1 %s\r\nContent-Type: %s\r\nContent-Length: %d\r\n\r\n%s", status, contentType, len(body), body)
+}
+
+var records = []string{
+	record("warcinfo", "", "2024-03-01T10:00:00Z", "application/warc-fields", "software: test\r\n"),
+	record("request", "http://example.com/", "2024-03-01T10:00:00Z", "application/http; msgtype=request", "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"),
+	record("response", "http://example.com/", "2024-03-01T10:00:01Z", "application/http; msgtype=response",
+		httpResponse("200 OK", "text/html; charset=utf-8", "<p>home</p>")),
+	record("response", "<http://example.com/gone>", "2024-03-01T10:00:02Z", "application/http; msgtype=response",
+		httpResponse("404 Not Found", "text/plain", "gone")),
+	record("resource", "http://example.com/logo.png", "2024-03-01T10:00:03Z", "image/png", "\x89PNG"),
+}
+
+func writeArchive(t *testing.T, name string, compress bool) string {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, rec := range records {
+		if !compress {
+			buf.WriteString(rec)
+			continue
+		}
+		zw := gzip.NewWriter(&buf)
+		_, _ = zw.Write([]byte(rec))
+		_ = zw.Close()
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestIndexAndReadAt(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		name := "test.warc"
+		if compress {
+			name += ".gz"
+		}
+		t.Run(name, func(t *testing.T) {
+			path := writeArchive(t, name, compress)
+			captures, err := Index(path)
+			if err != nil {
+				t.Fatalf("Index returned error: %v", err)
+			}
+			if len(captures) != 3 {
+				t.Fatalf("expected 3 captures, got %d: %+v", len(captures), captures)
+			}
+
+			want := []struct {
+				url, mime, body string
+				status          int
+			}{
+				{"http://example.com/", "text/html", "<p>home</p>", 200},
+				{"http://example.com/gone", "text/plain", "gone", 404},
+				{"http://example.com/logo.png", "image/png", "\x89PNG", 200},
+			}
+			for i, w := range want {
+				c := captures[i]
+				if c.URL != w.url || c.MIME != w.mime || c.Status != w.status || c.Filename != name {
+					t.Errorf("capture %d = %+v, want %s %s %d", i, c, w.url, w.mime, w.status)
+				}
+				rec, err := ReadAt(path, c.Offset)
+				if err != nil {
+					t.Fatalf("ReadAt(%d) returned error: %v", c.Offset, err)
+				}
+				resp, err := rec.Response()
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, _ := io.ReadAll(resp.Body)
+				if string(body) != w.body {
+					t.Errorf("body of %s = %q, want %q", w.url, body, w.body)
+				}
+			}
+			if captures[0].Timestamp() != "20240301100001" {
+				t.Errorf("unexpected timestamp %s", captures[0].Timestamp())
+			}
+		})
+	}
+}
+
+func TestReader_Invalid(t *testing.T) {
+	tests := []string{
+		"HTTP/1.1 200 OK\r\n\r\n",
+		"WARC/1.0\r\nWARC-Type: response\r\n\r\n",
+		"WARC/1.0\r\nContent-Length: 10\r\n\r\nshort",
+		"WARC/1.0\r\nbroken header\r\n\r\n",
+	}
+	for _, in := range tests {
+		if _, _, err := NewReader(strings.NewReader(in)).Next(); !errors.Is(err, ErrInvalidRecord) {
+			t.Errorf("Next(%q) error = %v, want %v", in, err, ErrInvalidRecord)
+		}
+	}
+	if _, _, err := NewReader(strings.NewReader("")).Next(); !errors.Is(err, io.EOF) {
+		t.Errorf("Next on empty input error = %v, want EOF", err)
+	}
+}
+
+func TestReadCDX(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    []Capture
+		wantErr bool
+	}{
+		{
+			name: "cdx11",
+			in: " CDX N b a m s k r M S V g\n" +
+				"com,example)/ 20240301100001 http://example.com/ text/html 200 SHA1 - - 210 530 test.warc.gz\n" +
+				"com,example)/gone 2024030110 http://example.com/gone - 404 - - - 180 740 test.warc.gz\n",
+			want: []Capture{
+				{URL: "http://example.com/", Time: time.Date(2024, 3, 1, 10, 0, 1, 0, time.UTC), MIME: "text/html", Status: 200, Digest: "SHA1", Length: 210, Offset: 530, Filename: "test.warc.gz"},
+				{URL: "http://example.com/gone", Time: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), Status: 404, Length: 180, Offset: 740, Filename: "test.warc.gz"},
+			},
+		},
+		{
+			name: "cdx9",
+			in:   "CDX N b a m s k r V g\nx 20240301100001 http://example.com/ text/html 200 - - 0 a.warc\n",
+			want: []Capture{{URL: "http://example.com/", Time: time.Date(2024, 3, 1, 10, 0, 1, 0, time.UTC), MIME: "text/html", Status: 200, Filename: "a.warc"}},
+		},
+		{name: "empty", in: "", wantErr: true},
+		{name: "no header", in: "com,example)/ 20240301100001 http://example.com/\n", wantErr: true},
+		{name: "no offset field", in: " CDX N b a g\n", wantErr: true},
+		{name: "short line", in: " CDX N b a V g\nx 20240301100001 http://example.com/ 0\n", wantErr: true},
+		{name: "bad timestamp", in: " CDX N b a V g\nx 2024-03 http://example.com/ 0 a.warc\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadCDX(strings.NewReader(tt.in))
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidCDX) {
+					t.Fatalf("expected ErrInvalidCDX, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadCDX returned error: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d captures, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("capture %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{in: "20240301100001", want: time.Date(2024, 3, 1, 10, 0, 1, 0, time.UTC)},
+		{in: "2024", want: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{in: "202403", want: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{in: "20", wantErr: true},
+		{in: "2024x", wantErr: true},
+		{in: "202403011000011", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTimestamp(tt.in)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("ParseTimestamp(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
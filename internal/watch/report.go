@@ -0,0 +1,56 @@
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Report - изменения отслеживаемых страниц за одну проверку.
+type Report struct {
+	Time time.Time `json:"time"`
+	// Baseline - первая проверка, с которой сравниваются следующие.
+	Baseline bool `json:"baseline,omitempty"`
+	// Pages - число отслеживаемых страниц после проверки.
+	Pages   int      `json:"pages"`
+	Added   []string `json:"added"`
+	Changed []string `json:"changed"`
+	Removed []string `json:"removed"`
+}
+
+// HasChanges сообщает, есть ли изменения, о которых нужно уведомить.
+func (r *Report) HasChanges() bool {
+	return len(r.Added)+len(r.Changed)+len(r.Removed) > 0
+}
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func (r *Report) WriteText(w io.Writer) error {
+	var b strings.Builder
+	stamp := r.Time.Format(time.RFC3339)
+	switch {
+	case r.Baseline:
+		fmt.Fprintf(&b, "%s: baseline of %d watched pages\n", stamp, r.Pages)
+	case !r.HasChanges():
+		fmt.Fprintf(&b, "%s: no changes in %d watched pages\n", stamp, r.Pages)
+	default:
+		fmt.Fprintf(&b, "%s: %d changed, %d added, %d removed of %d watched pages\n",
+			stamp, len(r.Changed), len(r.Added), len(r.Removed), r.Pages)
+	}
+	for _, group := range []struct {
+		kind string
+		urls []string
+	}{{"changed", r.Changed}, {"added", r.Added}, {"removed", r.Removed}} {
+		for _, u := range group.urls {
+			fmt.Fprintf(&b, "%-8s %s\n", group.kind, u)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,190 @@
+package watch
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"site-mirror/internal/events"
+	"site-mirror/internal/fsutil"
+	"site-mirror/internal/mediatype"
+	"site-mirror/internal/parser"
+	"site-mirror/internal/queue"
+	"site-mirror/internal/storage"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultStateFile - хеши страниц прошлой проверки в каталоге зеркала.
+const DefaultStateFile = "watch-state.json"
+
+// ChangedEvent - тип события уведомления об изменениях для hooks.
+const ChangedEvent = "pages_changed"
+
+// Page - состояние отслеживаемой страницы.
+type Page struct {
+	Hash    string    `json:"hash"`
+	Checked time.Time `json:"checked"`
+	Changed time.Time `json:"changed"`
+}
+
+// State - хеши страниц по URL, переживает запуски.
+type State struct {
+	Pages map[string]Page `json:"pages"`
+}
+
+// ReadState читает состояние; отсутствующий файл - пустое состояние.
+func ReadState(path string) (*State, error) {
+	s := &State{Pages: make(map[string]Page)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	if s.Pages == nil {
+		s.Pages = make(map[string]Page)
+	}
+	return s, nil
+}
+
+// WriteFile записывает состояние через временный файл.
+func (s *State) WriteFile(path string) error {
+	return fsutil.WriteJSON(path, s)
+}
+
+// Detector собирает хеши страниц одного обхода из событий. Хеш HTML считается
+// по видимому тексту без элементов под Ignore, поэтому счётчики и даты в них не
+// считаются изменением.
+type Detector struct {
+	// Ignore - элементы HTML, которые не входят в хеш.
+	Ignore []parser.Selector
+	// Select - регулярные выражения URL отслеживаемых страниц, пустой - все страницы.
+	Select []*regexp.Regexp
+	Logger *slog.Logger
+
+	pars   *parser.Parser
+	mu     sync.Mutex
+	hashes map[string]string
+	gone   map[string]bool
+}
+
+func NewDetector() *Detector {
+	return &Detector{
+		Logger: slog.Default(),
+		pars:   parser.NewParser(),
+		hashes: make(map[string]string),
+		gone:   make(map[string]bool),
+	}
+}
+
+// Handle принимает событие обхода. Хеш считается по ответу сервера до
+// преобразований: баннер с датой или переписанные ссылки изменением не считаются.
+// Страницы, не изменившиеся по условному запросу, событий Saved не дают и
+// сохраняют прежний хеш.
+func (d *Detector) Handle(e events.Event) {
+	if e.Kind != queue.KindPage.String() || !d.selected(e.URL) {
+		return
+	}
+	switch e.Type {
+	case events.Saved:
+		body := e.Raw
+		if body == nil {
+			body = e.Body
+		}
+		hash, err := d.hash(body, e.ContentType)
+		if err != nil {
+			d.logger().Warn("parse failed", "url", e.URL, "err", err)
+			return
+		}
+		d.mu.Lock()
+		d.hashes[e.URL] = hash
+		d.mu.Unlock()
+	case events.Failed:
+		// Другие ошибки могут быть временными, страница остаётся в состоянии.
+		if e.Status == http.StatusNotFound || e.Status == http.StatusGone {
+			d.mu.Lock()
+			d.gone[e.URL] = true
+			d.mu.Unlock()
+		}
+	case events.Removed:
+		d.mu.Lock()
+		d.gone[e.URL] = true
+		d.mu.Unlock()
+	}
+}
+
+func (d *Detector) selected(u string) bool {
+	if len(d.Select) == 0 {
+		return true
+	}
+	for _, re := range d.Select {
+		if re.MatchString(u) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Detector) hash(body []byte, contentType string) (string, error) {
+	if !mediatype.IsHTML(contentType) {
+		return storage.Checksum(body), nil
+	}
+	lines, err := d.pars.TextLines(body, d.Ignore)
+	if err != nil {
+		return "", err
+	}
+	return storage.Checksum([]byte(strings.Join(lines, "\n"))), nil
+}
+
+func (d *Detector) logger() *slog.Logger {
+	if d.Logger == nil {
+		return slog.Default()
+	}
+	return d.Logger
+}
+
+// Apply сравнивает хеши обхода с состоянием s, обновляет его и возвращает
+// отчёт. Первая проверка с пустым состоянием - Baseline, её страницы не
+// считаются добавленными.
+func (d *Detector) Apply(s *State, now time.Time) *Report {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	r := &Report{Time: now.UTC(), Baseline: len(s.Pages) == 0, Added: []string{}, Changed: []string{}, Removed: []string{}}
+	for u, hash := range d.hashes {
+		prev, ok := s.Pages[u]
+		switch {
+		case !ok:
+			prev.Changed = now
+			if !r.Baseline {
+				r.Added = append(r.Added, u)
+			}
+		case prev.Hash != hash:
+			prev.Changed = now
+			r.Changed = append(r.Changed, u)
+		}
+		prev.Hash, prev.Checked = hash, now
+		s.Pages[u] = prev
+	}
+	for u := range d.gone {
+		if _, ok := s.Pages[u]; ok {
+			delete(s.Pages, u)
+			r.Removed = append(r.Removed, u)
+		}
+	}
+	r.Pages = len(s.Pages)
+	sort.Strings(r.Added)
+	sort.Strings(r.Changed)
+	sort.Strings(r.Removed)
+	return r
+}
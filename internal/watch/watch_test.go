@@ -0,0 +1,147 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"site-mirror/internal/events"
+	"site-mirror/internal/parser"
+	"site-mirror/mirror"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func saved(u, body string) events.Event {
+	return events.Event{Type: events.Saved, Kind: "page", URL: u, ContentType: "text/html; charset=utf-8", Body: []byte(body)}
+}
+
+func TestDetector_Apply(t *testing.T) {
+	ignore, _ := parser.ParseSelectors(".updated")
+	path := filepath.Join(t.TempDir(), DefaultStateFile)
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+
+	check := func(evs ...events.Event) *Report {
+		t.Helper()
+		state, err := ReadState(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := NewDetector()
+		d.Ignore = ignore
+		d.Select = []*regexp.Regexp{regexp.MustCompile(`/rules/`)}
+		for _, e := range evs {
+			d.Handle(e)
+		}
+		now = now.Add(time.Hour)
+		r := d.Apply(state, now)
+		if err = state.WriteFile(path); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	r := check(
+		saved("https://example.com/rules/a", `<p>Rule A</p><p class="updated">9:00</p>`),
+		saved("https://example.com/rules/b", `<p>Rule B</p>`),
+		saved("https://example.com/news", `<p>not watched</p>`),
+	)
+	if !r.Baseline || r.HasChanges() || r.Pages != 2 {
+		t.Errorf("expected baseline of 2 pages, got %+v", r)
+	}
+
+	// Изменилось только время в игнорируемом элементе, /rules/b не менялась (304).
+	r = check(saved("https://example.com/rules/a", `<p>Rule  A</p><p class="updated">10:00</p>`))
+	if r.Baseline || r.HasChanges() {
+		t.Errorf("expected no changes, got %+v", r)
+	}
+
+	r = check(
+		saved("https://example.com/rules/a", `<p>Rule A, amended</p>`),
+		saved("https://example.com/rules/c", `<p>Rule C</p>`),
+		events.Event{Type: events.Failed, Kind: "page", URL: "https://example.com/rules/b", Status: http.StatusNotFound},
+	)
+	if len(r.Changed) != 1 || len(r.Added) != 1 || len(r.Removed) != 1 || r.Pages != 2 {
+		t.Errorf("expected one changed, added and removed page, got %+v", r)
+	}
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), ": 1 changed, 1 added, 1 removed of 2 watched pages\nchanged  https://example.com/rules/a\n") {
+		t.Errorf("unexpected report:\n%s", buf.String())
+	}
+}
+
+func TestDetector_Crawl(t *testing.T) {
+	var mu sync.Mutex
+	pages := map[string]string{
+		"/":        `<html><body><a href="/rules/a">a</a><a href="/rules/b">b</a></body></html>`,
+		"/rules/a": `<html><body><p>Rule A</p><a href="/">home</a></body></html>`,
+		"/rules/b": `<html><body><p>Rule B</p></body></html>`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		body, ok := pages[r.URL.Path]
+		mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	cfg, err := mirror.NewConfig(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.OutputDir = t.TempDir()
+	cfg.EventLog = ""
+	cfg.Progress = false
+	cfg.Update = true
+	state := &State{Pages: make(map[string]Page)}
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	check := func() *Report {
+		t.Helper()
+		c, err := mirror.New(mirror.Options{Config: cfg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := NewDetector()
+		d.Select = []*regexp.Regexp{regexp.MustCompile(`/rules/`)}
+		c.Subscribe(d.Handle, mirror.Saved, mirror.Failed, mirror.Removed)
+		if _, err = c.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Hour)
+		return d.Apply(state, now)
+	}
+
+	if r := check(); !r.Baseline || r.Pages != 2 {
+		t.Fatalf("expected baseline of 2 pages, got %+v", r)
+	}
+
+	// Баннер меняет сохранённую копию, но не ответ сервера.
+	spec, err := mirror.ParseTransform("banner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Transforms = []mirror.TransformSpec{spec}
+	if r := check(); r.HasChanges() {
+		t.Errorf("expected no changes with banner, got %+v", r)
+	}
+
+	// На /rules/b больше нет ссылок: update удаляет её из зеркала.
+	mu.Lock()
+	pages["/"] = `<html><body><a href="/rules/a">a</a></body></html>`
+	mu.Unlock()
+	if r := check(); len(r.Removed) != 1 || r.Removed[0] != server.URL+"/rules/b" || r.Pages != 1 {
+		t.Errorf("expected /rules/b removed, got %+v", r)
+	}
+}
@@ -0,0 +1,120 @@
+package mirror
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"site-mirror/internal/progress"
+	"site-mirror/internal/queue"
+	"sync"
+)
+
+var ErrWorkerCount = errors.New("worker count must be at least 1")
+
+// workerPool держит заданное число воркеров, размер меняется во время обхода.
+type workerPool struct {
+	mu    sync.Mutex
+	wg    sync.WaitGroup
+	stops []chan struct{}
+	work  func(stop <-chan struct{})
+}
+
+func (p *workerPool) Resize(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.stops) < n {
+		stop := make(chan struct{})
+		p.stops = append(p.stops, stop)
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.work(stop)
+		}()
+	}
+	// Лишние воркеры завершаются после текущей задачи.
+	for len(p.stops) > n {
+		last := len(p.stops) - 1
+		close(p.stops[last])
+		p.stops = p.stops[:last]
+	}
+}
+
+func (p *workerPool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.stops)
+}
+
+func (p *workerPool) Wait() {
+	p.wg.Wait()
+}
+
+type controlState struct {
+	Paused   bool `json:"paused"`
+	Stopping bool `json:"stopping"`
+	Workers  int  `json:"workers"`
+	progress.Status
+}
+
+// Pause перестаёт выдавать задачи воркерам, начатые загрузки завершаются.
+func (c *Crawler) Pause() {
+	c.q.Pause()
+}
+
+func (c *Crawler) Resume() {
+	c.q.Resume()
+}
+
+// SetWorkers меняет число воркеров во время обхода.
+func (c *Crawler) SetWorkers(n int) error {
+	if n < 1 {
+		return ErrWorkerCount
+	}
+	c.workers.Resize(n)
+	return nil
+}
+
+// AddSeed добавляет в очередь новую начальную страницу.
+func (c *Crawler) AddSeed(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	return c.enqueue(queue.Task{URL: u, Depth: 0, Kind: queue.KindPage})
+}
+
+// AddExclude исключает URL по регулярному выражению, в том числе уже поставленные
+// в очередь. Пустой kind - страницы и ресурсы.
+func (c *Crawler) AddExclude(kind, pattern string) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	if kind == "" {
+		c.q.AddExclude(queue.KindPage, re)
+		c.q.AddExclude(queue.KindResource, re)
+		return nil
+	}
+	k, err := queue.ParseKind(kind)
+	if err != nil {
+		return fmt.Errorf("%w, expected page or resource", err)
+	}
+	c.q.AddExclude(k, re)
+	return nil
+}
+
+// Stop останавливает обход: Run дождётся текущих загрузок и сохранит контрольную точку.
+func (c *Crawler) Stop() {
+	c.q.Halt()
+}
+
+// State - состояние для API управления.
+func (c *Crawler) State() any {
+	return controlState{
+		Paused:   c.q.Paused(),
+		Stopping: c.q.Halted(),
+		Workers:  c.workers.Size(),
+		Status:   c.reporter.Status(),
+	}
+}
@@ -0,0 +1,948 @@
+// Package mirror - движок зеркалирования сайтов для встраивания в другие программы.
+// Команда site-mirror - тонкая обёртка над ним.
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"site-mirror/internal/adaptive"
+	"site-mirror/internal/config"
+	"site-mirror/internal/downloader"
+	"site-mirror/internal/eventlog"
+	"site-mirror/internal/events"
+	"site-mirror/internal/fsutil"
+	"site-mirror/internal/linkgraph"
+	"site-mirror/internal/mediatype"
+	"site-mirror/internal/metrics"
+	"site-mirror/internal/neardup"
+	"site-mirror/internal/parser"
+	"site-mirror/internal/progress"
+	"site-mirror/internal/queue"
+	"site-mirror/internal/ratelimit"
+	"site-mirror/internal/storage"
+	"site-mirror/internal/transform"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Config - область обхода, фильтры и лимиты, те же, что у флагов site-mirror.
+	Config = config.Config
+	Filter = queue.Filter
+	// Window - интервал Config.RateSchedule, PatternWeight - вес шаблона
+	// Config.PriorityPatterns, TransformSpec - элемент Config.Transforms.
+	Window        = ratelimit.Window
+	PatternWeight = queue.PatternWeight
+	TransformSpec = transform.Spec
+	DedupMode     = storage.DedupMode
+	Response      = downloader.Response
+	// Downloader - HTTP-загрузчик обхода, см. NewFetcher.
+	Downloader = downloader.Downloader
+	// Record - итог обработки одного URL, строка журнала обхода.
+	Record  = eventlog.Record
+	Result  = progress.Summary
+	Status  = progress.Status
+	Metrics = metrics.Metrics
+	// Event - событие обхода для подписчиков Subscribe.
+	Event     = events.Event
+	EventType = events.Type
+	// Document - скачанный файл, который Transformer может изменить перед сохранением.
+	Document      = transform.Document
+	Transformer   = transform.Transformer
+	TransformRule = transform.Rule
+	// LinkGraph - граф ссылок обхода при заданном Config.LinkGraph.
+	LinkGraph = linkgraph.Graph
+	// NearDuplicates - кластеры почти одинаковых страниц при Config.NearDup.
+	NearDuplicates = neardup.Report
+)
+
+const (
+	TaskQueued     = events.TaskQueued
+	FetchStarted   = events.FetchStarted
+	FetchCompleted = events.FetchCompleted
+	Saved          = events.Saved
+	Skipped        = events.Skipped
+	Failed         = events.Failed
+	Removed        = events.Removed
+	CrawlFinished  = events.CrawlFinished
+)
+
+const (
+	DedupOff      = storage.DedupOff
+	DedupHardlink = storage.DedupHardlink
+	DedupSymlink  = storage.DedupSymlink
+	DedupPointer  = storage.DedupPointer
+)
+
+var (
+	ErrNotModified        = downloader.ErrNotModified
+	ErrCircuitOpen        = downloader.ErrCircuitOpen
+	ErrUpdateUnsupported  = errors.New("storage can't load stored copies for update")
+	ErrRewriteUnsupported = errors.New("storage doesn't report file paths for " + transform.RewriteLinksName)
+	ErrOutputNotWritable  = errors.New("output dir is not writable")
+)
+
+const DefaultUserAgent = "SiteMirror"
+
+// Fetcher скачивает URL. Ответ возвращается и вместе с ошибкой. ErrNotModified
+// означает, что сохранённая копия актуальна, ErrCircuitOpen - что задачу нужно отложить.
+type Fetcher interface {
+	Fetch(u *url.URL, useRobots bool) (*Response, error)
+}
+
+// Storage сохраняет скачанные файлы.
+type Storage interface {
+	Save(u *url.URL, content []byte, contentType string) error
+}
+
+// Locator - хранилище, которое знает путь сохранённого файла; путь попадает в журнал обхода.
+type Locator interface {
+	Path(u *url.URL, contentType string) string
+}
+
+// Loader - хранилище, из которого читаются сохранённые копии. Нужно для Config.Update.
+type Loader interface {
+	Load(u *url.URL) ([]byte, string, error)
+	Modified(u *url.URL) (time.Time, error)
+}
+
+// Remover - хранилище, из которого при Config.Update удаляются копии URL,
+// пропавших с сайта.
+type Remover interface {
+	Remove(u *url.URL) error
+}
+
+// Options собирают Crawler. Пустые Storage и Fetcher заменяются файлами в
+// Config.OutputDir и HTTP-загрузчиком с лимитами, выключателем и адаптивной
+// параллельностью из Config; свой Fetcher отвечает за них сам.
+type Options struct {
+	Config
+	Storage Storage
+	Fetcher Fetcher
+	Logger  *slog.Logger
+	Metrics Metrics
+	// Output - куда выводится строка прогресса при Config.Progress.
+	Output    io.Writer
+	UserAgent string
+	// OnRecord вызывается после обработки каждого URL из воркера обхода.
+	OnRecord func(Record)
+	// Transforms применяются после Config.Transforms, перед сохранением файла.
+	Transforms []TransformRule
+	// PagesOnly - обходить только страницы, не ставя в очередь ресурсы, как при проверке ссылок.
+	PagesOnly bool
+}
+
+// NewConfig возвращает конфигурацию со значениями по умолчанию, как у site-mirror без флагов.
+func NewConfig(startURL string) (Config, error) {
+	cfg, err := parser.LoadConfig([]string{"-url", startURL}, func(string) string { return "" })
+	if err != nil {
+		return Config{}, err
+	}
+	return *cfg, nil
+}
+
+// ParseSchedule разбирает расписание скорости в формате флага -rate-schedule.
+func ParseSchedule(s string) ([]Window, error) {
+	return ratelimit.ParseSchedule(s)
+}
+
+// ParsePatternWeights разбирает веса в формате флага -priority-patterns.
+func ParsePatternWeights(s string) ([]PatternWeight, error) {
+	return queue.ParsePatternWeights(s)
+}
+
+// ParseTransform разбирает одно значение флага -transform.
+func ParseTransform(s string) (TransformSpec, error) {
+	return transform.ParseSpec(s)
+}
+
+// ParseDedup разбирает режим флага -dedup.
+func ParseDedup(s string) (DedupMode, error) {
+	return storage.ParseDedup(s)
+}
+
+// ParseEventTypes разбирает список событий в формате флага -hook-events.
+func ParseEventTypes(s string) ([]EventType, error) {
+	return events.ParseTypes(s)
+}
+
+// Crawler - один обход сайта. Run вызывается один раз; методы управления
+// безопасны во время обхода.
+type Crawler struct {
+	cfg      Config
+	onRecord func(Record)
+	pageOnly bool
+	q        *queue.Queue
+	pars     *parser.Parser
+	fetcher  Fetcher
+	dwnld    *downloader.Downloader
+	store    Storage
+	manifest *storage.Manifest
+	graph    *linkgraph.Graph
+	dups     *neardup.Index
+	pipeline *transform.Pipeline
+	events   *eventlog.Log
+	bus      events.Bus
+	reporter *progress.Reporter
+	output   io.Writer
+	metrics  Metrics
+	logger   *slog.Logger
+	active   atomic.Int64
+	workers  *workerPool
+	nworkers int
+	slots    map[queue.Kind]chan struct{}
+}
+
+func New(opts Options) (*Crawler, error) {
+	cfg := opts.Config
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	// Снимок - отдельный каталог вывода со своими журналом и манифестом,
+	// блобы лежат в общем каталоге зеркала.
+	var blobs string
+	if cfg.Snapshot {
+		blobs = filepath.Join(cfg.OutputDir, storage.BlobDir)
+		cfg.OutputDir = storage.NextSnapshot(cfg.OutputDir, time.Now())
+		if cfg.Dedup == storage.DedupOff {
+			cfg.Dedup = storage.DedupHardlink
+		}
+	}
+
+	c := &Crawler{
+		cfg:      cfg,
+		onRecord: opts.OnRecord,
+		pageOnly: opts.PagesOnly,
+		pars:     parser.NewParser(),
+		fetcher:  opts.Fetcher,
+		store:    opts.Storage,
+		output:   opts.Output,
+		metrics:  opts.Metrics,
+		logger:   opts.Logger,
+		nworkers: cfg.Concurrency,
+		slots: map[queue.Kind]chan struct{}{
+			queue.KindPage:     newSlots(cfg.PageConcurrency),
+			queue.KindResource: newSlots(cfg.ResourceConcurrency),
+		},
+	}
+	if c.metrics == nil {
+		c.metrics = metrics.Nop{}
+	}
+	if c.logger == nil {
+		c.logger = slog.Default()
+	}
+	if c.output == nil {
+		c.output = io.Discard
+	}
+	c.reporter = progress.NewReporter(c.output)
+	if cfg.LinkGraph != "" {
+		c.graph = linkgraph.New()
+	}
+	if cfg.NearDup > 0 {
+		dups, err := neardup.NewIndex(cfg.NearDup)
+		if err != nil {
+			return nil, err
+		}
+		c.dups = dups
+	}
+
+	scorer := queue.Scorer{PriorityWeight: 10, PathDepthWeight: 1, Patterns: cfg.PriorityPatterns}
+	if cfg.ResourcesFirst {
+		scorer.ResourceBonus = 1000
+	}
+	frontier, err := queue.NewFrontier(cfg.CrawlOrder, scorer.Score)
+	if err != nil {
+		return nil, err
+	}
+	c.q = queue.NewQueueWithFrontier(1000, cfg.StartURL.Host, frontier)
+	c.q.SetBudget(queue.Budget{
+		MaxPages:        cfg.MaxPages,
+		MaxBytes:        cfg.MaxBytes,
+		MaxBytesPerMIME: cfg.MaxBytesPerMIME,
+		MaxDuration:     cfg.MaxDuration,
+	})
+	c.q.SetMetrics(c.metrics)
+	c.q.SetFilter(queue.KindPage, cfg.PageFilter)
+	c.q.SetFilter(queue.KindResource, cfg.ResourceFilter)
+
+	if c.store == nil {
+		if err = fsutil.CheckWritable(cfg.OutputDir); err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrOutputNotWritable, cfg.OutputDir, err)
+		}
+		st := storage.NewStorage(cfg.OutputDir)
+		st.Logger = c.logger
+		st.Metrics = c.metrics
+		st.Dedup = cfg.Dedup
+		st.Blobs = blobs
+		if cfg.Manifest != "" {
+			if st.Manifest, err = storage.ReadManifest(OutputPath(cfg.OutputDir, cfg.Manifest)); err != nil {
+				return nil, err
+			}
+			c.manifest = st.Manifest
+		}
+		c.store = st
+	}
+	loader, canLoad := c.store.(Loader)
+	if cfg.Update && !canLoad {
+		return nil, ErrUpdateUnsupported
+	}
+
+	env := transform.Env{Trackers: cfg.TrackerPatterns}
+	if l, ok := c.store.(Locator); ok {
+		env.Path = l.Path
+	}
+	rules, err := transform.Build(cfg.Transforms, env)
+	if err != nil {
+		if env.Path == nil {
+			return nil, ErrRewriteUnsupported
+		}
+		return nil, err
+	}
+	c.pipeline = &transform.Pipeline{}
+	c.pipeline.Add(rules...)
+	c.pipeline.Add(opts.Transforms...)
+
+	if c.fetcher == nil {
+		userAgent := opts.UserAgent
+		if userAgent == "" {
+			userAgent = DefaultUserAgent
+		}
+		if err = c.newDownloader(userAgent); err != nil {
+			return nil, err
+		}
+		if cfg.Update {
+			c.dwnld.IfModifiedSince = func(u *url.URL) time.Time {
+				return c.modifiedSince(loader, u)
+			}
+			c.dwnld.IfNoneMatch = func(u *url.URL) string {
+				e, _ := c.manifest.Get(u.String())
+				return e.ETag
+			}
+		}
+		c.fetcher = c.dwnld
+	}
+
+	c.workers = &workerPool{work: c.runWorker}
+	return c, nil
+}
+
+func (c *Crawler) newDownloader(userAgent string) error {
+	d, err := downloader.NewDownloader(c.cfg.StartURL, userAgent)
+	if err != nil {
+		return err
+	}
+	configure(d, c.cfg, c.logger, c.metrics)
+	if d.Breaker != nil {
+		d.Breaker.OnChange = c.onCircuitChange
+		c.q.SetGate(d.Breaker.Ready)
+	}
+	if d.Adaptive != nil {
+		// Воркеров столько, сколько допускает верхняя граница, фактическую
+		// параллельность по хостам определяет контроллер.
+		c.nworkers = c.cfg.MaxConcurrency
+	}
+	c.dwnld = d
+	return nil
+}
+
+// NewFetcher возвращает HTTP-загрузчик с лимитами, выключателем и адаптивной
+// параллельностью из opts.Config, как у обхода, для загрузок вне Crawler,
+// например ресурсов страниц, записанных прокси. robots.txt он не читает.
+func NewFetcher(opts Options) *Downloader {
+	userAgent := opts.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	d := &downloader.Downloader{
+		Client:    &http.Client{Timeout: 30 * time.Second},
+		UserAgent: userAgent,
+	}
+	configure(d, opts.Config, logger, opts.Metrics)
+	return d
+}
+
+// configure подключает к загрузчику лимиты, выключатель и адаптивную параллельность из cfg.
+func configure(d *downloader.Downloader, cfg Config, logger *slog.Logger, m Metrics) {
+	if m == nil {
+		m = metrics.Nop{}
+	}
+	d.Logger = logger
+	d.Metrics = m
+	if cfg.RateLimit > 0 || cfg.BandwidthLimit > 0 || len(cfg.RateSchedule) > 0 {
+		d.Limiter = ratelimit.New(cfg.RateLimit, cfg.BandwidthLimit, cfg.RateSchedule)
+	}
+	if cfg.BreakerThreshold > 0 {
+		d.Breaker = downloader.NewBreaker(downloader.BreakerConfig{
+			Threshold: cfg.BreakerThreshold,
+			Cooldown:  cfg.BreakerCooldown,
+			MaxProbes: cfg.BreakerProbes,
+		})
+		d.Breaker.Logger = logger
+		d.Breaker.Metrics = m
+	}
+	if cfg.Adaptive {
+		d.Adaptive = adaptive.New(adaptive.Config{
+			Min:     cfg.MinConcurrency,
+			Max:     cfg.MaxConcurrency,
+			Initial: cfg.Concurrency,
+		})
+		d.Adaptive.Logger = logger
+		d.Adaptive.Metrics = m
+	}
+}
+
+// Run выполняет обход до конца очереди, исчерпания бюджета или отмены ctx.
+// После отмены текущие загрузки завершаются, а невыполненные задачи
+// сохраняются в контрольную точку.
+func (c *Crawler) Run(ctx context.Context) (*Result, error) {
+	if c.cfg.EventLog != "" {
+		events, err := eventlog.Open(OutputPath(c.cfg.OutputDir, c.cfg.EventLog))
+		if err != nil {
+			return nil, err
+		}
+		c.events = events
+		defer func() {
+			if errClose := events.Close(); errClose != nil {
+				c.logger.Error("closing event log", "err", errClose)
+			}
+		}()
+	}
+
+	c.workers.Resize(c.nworkers)
+	if c.cfg.Resume {
+		if err := c.restore(); err != nil {
+			c.q.Halt()
+			c.workers.Wait()
+			return nil, err
+		}
+	} else {
+		initTask := queue.Task{URL: c.cfg.StartURL, Depth: 0, Kind: queue.KindPage}
+		if err := c.enqueue(initTask); err != nil {
+			c.q.Halt()
+			c.workers.Wait()
+			return nil, err
+		}
+		if c.cfg.UseSitemap {
+			c.seedFromSitemap()
+		}
+	}
+
+	stop := context.AfterFunc(ctx, c.Stop)
+	defer stop()
+
+	c.logger.Info("processing", "url", c.cfg.StartURL.String(), "workers", c.workers.Size())
+	if c.cfg.Progress && c.output != io.Discard {
+		c.reporter.Start()
+	}
+	c.q.WaitAndClose()
+	c.workers.Wait()
+	c.reporter.Stop()
+	// Только полный обход знает, что на URL прошлых обходов больше нет ссылок.
+	if c.cfg.Update && !c.q.Halted() && len(c.q.BudgetHits()) == 0 {
+		c.prune()
+	}
+	if c.q.Halted() && c.cfg.CheckpointFile != "" {
+		if err := c.saveCheckpoint(); err != nil {
+			return nil, err
+		}
+	}
+	if c.manifest != nil {
+		if err := c.manifest.WriteFile(OutputPath(c.cfg.OutputDir, c.cfg.Manifest)); err != nil {
+			return nil, err
+		}
+	}
+	if c.graph != nil {
+		if err := c.graph.WriteFile(OutputPath(c.cfg.OutputDir, c.cfg.LinkGraph)); err != nil {
+			return nil, err
+		}
+	}
+	dups := c.dups.Report()
+	if dups != nil && c.cfg.NearDupReport != "" {
+		if err := dups.WriteFile(OutputPath(c.cfg.OutputDir, c.cfg.NearDupReport)); err != nil {
+			return nil, err
+		}
+	}
+	c.logger.Info("done")
+
+	summary := c.reporter.Summary()
+	for _, hit := range c.q.BudgetHits() {
+		summary.BudgetHits = append(summary.BudgetHits, hit.Error())
+	}
+	if st, ok := c.store.(*storage.Storage); ok {
+		dedup := st.DedupStats()
+		summary.DedupFiles, summary.DedupBytes = dedup.Files, dedup.Bytes
+	}
+	if c.cfg.Snapshot {
+		summary.Snapshot = c.cfg.OutputDir
+	}
+	if dups != nil {
+		summary.NearDuplicates = dups.Duplicates
+	}
+	c.bus.Emit(Event{Type: CrawlFinished, Result: &summary})
+	return &summary, nil
+}
+
+// Subscribe подписывает handler на события указанных типов, без типов - на все.
+// Обработчики вызываются синхронно из воркеров и не должны надолго блокировать.
+func (c *Crawler) Subscribe(handler func(Event), types ...EventType) {
+	c.bus.Subscribe(handler, types...)
+}
+
+func (c *Crawler) emit(t EventType, rec Record) {
+	c.bus.Emit(newEvent(t, rec))
+}
+
+func newEvent(t EventType, rec Record) Event {
+	return Event{
+		Type:        t,
+		URL:         rec.URL,
+		Kind:        rec.Kind,
+		Depth:       rec.Depth,
+		Parent:      rec.Parent,
+		Status:      rec.Status,
+		Bytes:       rec.Bytes,
+		ContentType: rec.ContentType,
+		Path:        rec.SavedPath,
+		Reason:      rec.Error,
+		Redirects:   rec.Redirects,
+	}
+}
+
+// Graph возвращает граф ссылок обхода или nil, если Config.LinkGraph пуст.
+func (c *Crawler) Graph() *LinkGraph {
+	return c.graph
+}
+
+// NearDuplicates возвращает кластеры почти одинаковых страниц или nil, если Config.NearDup равен 0.
+func (c *Crawler) NearDuplicates() *NearDuplicates {
+	return c.dups.Report()
+}
+
+// Status - текущее состояние обхода, то же, что в строке прогресса.
+func (c *Crawler) Status() Status {
+	return c.reporter.Status()
+}
+
+// OutputPath разрешает относительные пути служебных файлов относительно каталога зеркала.
+func OutputPath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// newSlots возвращает семафор на n одновременных загрузок, nil - без отдельного лимита.
+func newSlots(n int) chan struct{} {
+	if n <= 0 {
+		return nil
+	}
+	return make(chan struct{}, n)
+}
+
+func (c *Crawler) enqueue(t queue.Task) error {
+	err := c.q.Enqueue(t, c.cfg.Depth)
+	switch {
+	case err == nil:
+		c.reporter.Queued()
+		c.emit(TaskQueued, newRecord(t))
+	case !errors.Is(err, queue.ErrURLisVisited):
+		rec := newRecord(t)
+		rec.Error = err.Error()
+		c.emit(Skipped, rec)
+	}
+	return err
+}
+
+func (c *Crawler) seedFromSitemap() {
+	pending := []*url.URL{c.cfg.StartURL.ResolveReference(&url.URL{Path: "/sitemap.xml"})}
+	seen := make(map[string]bool)
+	for len(pending) > 0 {
+		sm := pending[0]
+		pending = pending[1:]
+		if seen[sm.String()] {
+			continue
+		}
+		seen[sm.String()] = true
+
+		resp, err := c.fetcher.Fetch(sm, c.cfg.UseRobots)
+		if err != nil {
+			c.logger.Warn("can't load sitemap", "url", sm.String(), "err", err)
+			continue
+		}
+		entries, nested, err := c.pars.ParseSitemap(resp.Body, sm)
+		if err != nil {
+			c.logger.Warn("can't parse sitemap", "url", sm.String(), "err", err)
+			continue
+		}
+		pending = append(pending, nested...)
+		for _, entry := range entries {
+			c.graph.MarkSitemap(entry.URL.String())
+			newTask := queue.Task{URL: entry.URL, Parent: sm, Depth: 1, Kind: queue.KindPage, Priority: entry.Priority}
+			_ = c.enqueue(newTask)
+		}
+	}
+}
+
+func (c *Crawler) restore() error {
+	path := OutputPath(c.cfg.OutputDir, c.cfg.CheckpointFile)
+	cp, err := queue.ReadCheckpoint(path)
+	if err != nil {
+		return err
+	}
+	if err = c.q.Restore(cp); err != nil {
+		return err
+	}
+	for range cp.Tasks {
+		c.reporter.Queued()
+	}
+	c.logger.Info("resuming from checkpoint", "path", path, "tasks", len(cp.Tasks), "visited", len(cp.Visited))
+	return nil
+}
+
+func (c *Crawler) saveCheckpoint() error {
+	path := OutputPath(c.cfg.OutputDir, c.cfg.CheckpointFile)
+	cp := c.q.Checkpoint()
+	if err := queue.WriteCheckpoint(path, cp); err != nil {
+		return err
+	}
+	c.logger.Info("checkpoint saved", "path", path, "tasks", len(cp.Tasks))
+	return nil
+}
+
+func (c *Crawler) runWorker(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case task, ok := <-c.q.Dequeue():
+			if !ok {
+				return
+			}
+			if err := c.q.Stopped(); err != nil {
+				c.skip(task, err)
+			} else {
+				c.process(task)
+			}
+			c.q.Done()
+		}
+	}
+}
+
+// skip отчитывается о задаче, выданной воркеру после исчерпания бюджета.
+func (c *Crawler) skip(task queue.Task, err error) {
+	rec := newRecord(task)
+	rec.Error = err.Error()
+	c.emit(Skipped, rec)
+	c.reporter.Started()
+	c.record(rec)
+}
+
+func (c *Crawler) process(task queue.Task) {
+	if slots := c.slots[task.Kind]; slots != nil {
+		slots <- struct{}{}
+		defer func() { <-slots }()
+	}
+
+	c.metrics.Set(metrics.ActiveWorkers, float64(c.active.Add(1)))
+	defer func() { c.metrics.Set(metrics.ActiveWorkers, float64(c.active.Add(-1))) }()
+
+	rec := newRecord(task)
+	c.reporter.Started()
+	parked := false
+	defer func() {
+		if parked {
+			c.reporter.Parked()
+			return
+		}
+		c.record(rec)
+	}()
+
+	c.emit(FetchStarted, rec)
+	resp, err := c.fetcher.Fetch(task.URL, c.cfg.UseRobots)
+	if errors.Is(err, ErrCircuitOpen) {
+		c.q.Park(task)
+		parked = true
+		return
+	}
+	if resp != nil {
+		rec.Status = resp.StatusCode
+		rec.Redirects = resp.Redirects
+		rec.DurationMS = float64(resp.Duration.Microseconds()) / 1000
+	}
+	if errors.Is(err, ErrNotModified) {
+		c.setValidators(rec.URL, resp)
+		c.emit(FetchCompleted, rec)
+		c.reuse(task, &rec)
+		return
+	}
+	if err != nil {
+		rec.Error = err.Error()
+		if errors.Is(err, downloader.ErrDisallowed) {
+			c.emit(Skipped, rec)
+		} else {
+			c.emit(Failed, rec)
+		}
+		if c.cfg.Update && (rec.Status == http.StatusNotFound || rec.Status == http.StatusGone) {
+			c.remove(task.URL, task.Kind, "gone")
+		}
+		c.logger.Warn("download failed", "url", rec.URL, "status", rec.Status, "err", err)
+		return
+	}
+	rec.Bytes = int64(len(resp.Body))
+	rec.ContentType = resp.ContentType
+	c.emit(FetchCompleted, rec)
+
+	if err = c.q.AddBytes(resp.ContentType, rec.Bytes); errors.Is(err, queue.ErrMIMEBytesLimit) {
+		rec.Error = err.Error()
+		c.emit(Skipped, rec)
+		return
+	}
+
+	// Ссылки для обхода берутся из исходного файла, на диск попадает преобразованный.
+	doc := &Document{URL: task.URL, ContentType: resp.ContentType, Body: resp.Body, FetchedAt: time.Now()}
+	if c.pipeline.Len() > 0 {
+		if err = c.pipeline.Apply(doc); err != nil {
+			rec.Error = err.Error()
+			c.emit(Failed, rec)
+			c.logger.Error("transform failed", "url", rec.URL, "err", err)
+			return
+		}
+		rec.SavedBytes = int64(len(doc.Body))
+	}
+
+	if err = c.store.Save(task.URL, doc.Body, resp.ContentType); err != nil {
+		rec.Error = err.Error()
+		c.emit(Failed, rec)
+		c.logger.Error("save failed", "url", rec.URL, "err", err)
+		return
+	}
+	c.setValidators(rec.URL, resp)
+	rec.SavedPath = c.path(task.URL, resp.ContentType)
+	c.logger.Debug("saved", "url", rec.URL, "kind", rec.Kind, "bytes", rec.Bytes, "path", rec.SavedPath)
+	saved := newEvent(Saved, rec)
+	saved.Body, saved.Raw = doc.Body, resp.Body
+	c.bus.Emit(saved)
+
+	c.follow(task, resp.Body, resp.ContentType)
+}
+
+// modifiedSince возвращает время для If-Modified-Since: Last-Modified сервера из
+// манифеста, а без него - время записи сохранённой копии.
+func (c *Crawler) modifiedSince(loader Loader, u *url.URL) time.Time {
+	if e, ok := c.manifest.Get(u.String()); ok && e.LastModified != "" {
+		if t, err := http.ParseTime(e.LastModified); err == nil {
+			return t
+		}
+	}
+	mod, _ := loader.Modified(u)
+	return mod
+}
+
+// setValidators запоминает в манифесте ETag и Last-Modified ответа для
+// следующего update. Вызывается только для сохранённой или подтверждённой копии.
+func (c *Crawler) setValidators(u string, resp *Response) {
+	if resp.Header != nil {
+		c.manifest.SetValidators(u, resp.Header.Get("ETag"), resp.Header.Get("Last-Modified"))
+	}
+}
+
+// prune удаляет из зеркала URL стартового хоста из манифеста, до которых
+// обход update не дошёл: на них больше нет ссылок или их исключили фильтры.
+func (c *Crawler) prune() {
+	if c.manifest == nil {
+		return
+	}
+	for _, e := range c.manifest.Entries() {
+		u, err := url.Parse(e.URL)
+		if err != nil || u.Host != c.cfg.StartURL.Host || c.q.Visited(e.URL) {
+			continue
+		}
+		kind := queue.KindResource
+		if mediatype.IsHTML(e.ContentType) {
+			kind = queue.KindPage
+		}
+		c.remove(u, kind, "not linked")
+	}
+}
+
+// remove удаляет копию URL и его запись в манифесте, если хранилище это умеет,
+// и сообщает об удалении событием Removed.
+func (c *Crawler) remove(u *url.URL, kind queue.Kind, reason string) {
+	r, ok := c.store.(Remover)
+	if !ok {
+		return
+	}
+	if err := r.Remove(u); err != nil {
+		c.logger.Error("remove failed", "url", u.String(), "err", err)
+		return
+	}
+	c.logger.Info("removed from mirror", "url", u.String(), "reason", reason)
+	c.bus.Emit(Event{Type: Removed, URL: u.String(), Kind: kind.String(), Reason: reason})
+}
+
+func (c *Crawler) path(u *url.URL, contentType string) string {
+	if l, ok := c.store.(Locator); ok {
+		return l.Path(u, contentType)
+	}
+	return ""
+}
+
+// reuse обрабатывает URL, не изменившийся с прошлого обхода: ссылки берутся
+// из сохранённой копии.
+func (c *Crawler) reuse(task queue.Task, rec *Record) {
+	loader, ok := c.store.(Loader)
+	if !ok {
+		rec.Error = ErrUpdateUnsupported.Error()
+		c.emit(Failed, *rec)
+		return
+	}
+	body, contentType, err := loader.Load(task.URL)
+	if err != nil {
+		rec.Error = err.Error()
+		c.emit(Failed, *rec)
+		c.logger.Warn("stored copy unavailable", "url", rec.URL, "err", err)
+		return
+	}
+	rec.ContentType = contentType
+	rec.SavedPath = c.path(task.URL, contentType)
+	c.logger.Debug("not modified", "url", rec.URL, "path", rec.SavedPath)
+
+	c.follow(task, body, contentType)
+}
+
+// follow ставит в очередь страницы и ресурсы, найденные в скачанном файле.
+func (c *Crawler) follow(task queue.Task, body []byte, contentType string) {
+	var pages, resources []*url.URL
+	var err error
+	switch mediatype.Of(contentType) {
+	case "text/html", "application/xhtml+xml":
+		if task.Kind != queue.KindPage {
+			return
+		}
+		var text []string
+		if c.dups != nil {
+			var page *parser.Page
+			if page, err = c.pars.ParsePage(body, task.URL); err == nil {
+				pages, resources, text = page.Pages, page.Resources, page.Text
+			}
+		} else {
+			pages, resources, err = c.pars.ParseHTML(body, task.URL)
+		}
+		if err != nil {
+			c.logger.Warn("parse failed", "url", task.URL.String(), "err", err)
+			return
+		}
+		// У почти копии ресурсы нужны для сохранённой страницы, а ссылки ведут
+		// на такие же копии.
+		if c.nearDuplicate(task, text) && c.cfg.NearDupSkipLinks {
+			pages = nil
+		}
+		if c.graph != nil {
+			c.addEdges(task, body)
+		}
+	case "text/css":
+		resources = c.pars.ParseCSS(body, task.URL)
+		for _, resource := range resources {
+			c.graph.AddEdge(linkgraph.Edge{Source: task.URL.String(), Target: resource.String(), Element: "css", Attr: "url"})
+		}
+	}
+
+	for _, page := range pages {
+		newTask := queue.Task{URL: page, Parent: task.URL, Depth: task.Depth + 1, Kind: queue.KindPage}
+		_ = c.enqueue(newTask)
+	}
+	if c.pageOnly {
+		return
+	}
+	for _, resource := range resources {
+		newTask := queue.Task{URL: resource, Parent: task.URL, Depth: task.Depth + 1, Kind: queue.KindResource}
+		_ = c.enqueue(newTask)
+	}
+}
+
+// nearDuplicate сравнивает текст страницы с уже скачанными.
+func (c *Crawler) nearDuplicate(task queue.Task, text []string) bool {
+	if c.dups == nil {
+		return false
+	}
+	fp, ok := neardup.Fingerprint(text)
+	if !ok {
+		return false
+	}
+	dup, found := c.dups.Add(task.URL.String(), fp)
+	if found {
+		c.logger.Debug("near-duplicate", "url", task.URL.String(), "of", dup.URL, "similarity", dup.Similarity)
+	}
+	return found
+}
+
+// addEdges записывает в граф все ссылки страницы, включая ссылки на другие хосты.
+func (c *Crawler) addEdges(task queue.Task, body []byte) {
+	links, err := c.pars.ParseLinks(body, task.URL)
+	if err != nil {
+		c.logger.Warn("parse failed", "url", task.URL.String(), "err", err)
+		return
+	}
+	for _, l := range links {
+		target := *l.URL
+		target.Fragment, target.RawFragment = "", ""
+		c.graph.AddEdge(linkgraph.Edge{
+			Source:  task.URL.String(),
+			Target:  target.String(),
+			Element: l.Element,
+			Attr:    l.Attr,
+			Text:    l.Text,
+			Rel:     l.Rel,
+		})
+	}
+}
+
+func newRecord(task queue.Task) Record {
+	rec := Record{URL: task.URL.String(), Kind: task.Kind.String(), Depth: task.Depth}
+	if task.Parent != nil {
+		rec.Parent = task.Parent.String()
+	}
+	return rec
+}
+
+func (c *Crawler) record(rec Record) {
+	c.reporter.Finished(rec)
+	c.graph.AddNode(linkgraph.Node{URL: rec.URL, Kind: rec.Kind, Depth: rec.Depth, Status: rec.Status})
+	if err := c.events.Write(rec); err != nil {
+		c.logger.Error("writing event log", "err", err)
+	}
+	if c.onRecord != nil {
+		c.onRecord(rec)
+	}
+}
+
+// onCircuitChange возвращает отложенные задачи хоста в очередь, когда его можно
+// проверить или он восстановился, и отчитывается о них, если хост недоступен.
+func (c *Crawler) onCircuitChange(host string, state downloader.CircuitState) {
+	switch state {
+	case downloader.CircuitHalfOpen, downloader.CircuitClosed:
+		if n := c.q.Unpark(host); n > 0 {
+			c.logger.Info("parked tasks resumed", "host", host, "tasks", n)
+		}
+	case downloader.CircuitDead:
+		tasks := c.q.DropParked(host)
+		for _, task := range tasks {
+			rec := newRecord(task)
+			rec.Error = downloader.ErrHostDown.Error()
+			c.emit(Failed, rec)
+			c.reporter.Started()
+			c.record(rec)
+		}
+		c.logger.Warn("parked tasks failed", "host", host, "tasks", len(tasks))
+	}
+}
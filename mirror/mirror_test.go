@@ -0,0 +1,594 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"site-mirror/internal/linkgraph"
+	"site-mirror/internal/neardup"
+	"site-mirror/internal/storage"
+	"site-mirror/internal/transform"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memStorage struct {
+	mu    sync.Mutex
+	files map[string]string
+}
+
+func (m *memStorage) Save(u *url.URL, content []byte, _ string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[u.Path] = string(content)
+	return nil
+}
+
+// mapFetcher отдаёт страницы из памяти без сети.
+type mapFetcher map[string]string
+
+func (f mapFetcher) Fetch(u *url.URL, _ bool) (*Response, error) {
+	body, ok := f[u.Path]
+	if !ok {
+		return &Response{URL: u, StatusCode: http.StatusNotFound}, errors.New("not found")
+	}
+	return &Response{URL: u, StatusCode: http.StatusOK, ContentType: "text/html", Body: []byte(body)}, nil
+}
+
+func testConfig(t *testing.T, startURL string) Config {
+	t.Helper()
+	cfg, err := NewConfig(startURL)
+	if err != nil {
+		t.Fatalf("NewConfig returned error: %v", err)
+	}
+	cfg.OutputDir = t.TempDir()
+	cfg.EventLog = ""
+	cfg.Progress = false
+	return cfg
+}
+
+func TestCrawler_Run(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<a href="/a">a</a><link rel="stylesheet" href="/style.css">`))
+		case "/a":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<a href="/">home</a>`))
+		case "/style.css":
+			w.Header().Set("Content-Type", "text/css")
+			_, _ = w.Write([]byte(`body {}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	store := &memStorage{files: make(map[string]string)}
+	var mu sync.Mutex
+	var records []Record
+	c, err := New(Options{
+		Config:  testConfig(t, server.URL+"/"),
+		Storage: store,
+		OnRecord: func(rec Record) {
+			mu.Lock()
+			defer mu.Unlock()
+			records = append(records, rec)
+		},
+	})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	result, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if result.Total != 3 || result.Succeeded != 3 {
+		t.Errorf("expected 3 successful URLs, got %d/%d", result.Succeeded, result.Total)
+	}
+	if len(records) != 3 {
+		t.Errorf("expected OnRecord for every URL, got %d", len(records))
+	}
+	if store.files["/style.css"] != "body {}" || len(store.files) != 3 {
+		t.Errorf("unexpected stored files %v", store.files)
+	}
+}
+
+func TestCrawler_CustomFetcher(t *testing.T) {
+	fetcher := mapFetcher{
+		"/":   `<a href="/ok">ok</a><a href="/missing">missing</a><a href="/private/">private</a>`,
+		"/ok": `ok`,
+	}
+	store := &memStorage{files: make(map[string]string)}
+	cfg := testConfig(t, "https://example.com/")
+	cfg.PageFilter.Exclude = []*regexp.Regexp{regexp.MustCompile("/private/")}
+	c, err := New(Options{Config: cfg, Storage: store, Fetcher: fetcher})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	var mu sync.Mutex
+	counts := make(map[EventType]int)
+	var saved []Event
+	c.Subscribe(func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		counts[e.Type]++
+		if e.Type == Saved {
+			saved = append(saved, e)
+		}
+	})
+
+	result, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if result.Succeeded != 2 || result.Failed != 1 {
+		t.Errorf("expected 2 ok and 1 failed, got %d/%d", result.Succeeded, result.Failed)
+	}
+	if _, ok := store.files["/ok"]; !ok {
+		t.Errorf("expected /ok to be stored, got %v", store.files)
+	}
+
+	want := map[EventType]int{TaskQueued: 3, FetchStarted: 3, FetchCompleted: 2, Saved: 2, Skipped: 1, Failed: 1, CrawlFinished: 1}
+	for typ, n := range want {
+		if counts[typ] != n {
+			t.Errorf("expected %d %s events, got %d", n, typ, counts[typ])
+		}
+	}
+	for _, e := range saved {
+		if len(e.Body) == 0 {
+			t.Errorf("expected body in saved event for %s", e.URL)
+		}
+	}
+}
+
+// slowFetcher отдаёт страницы mapFetcher, задерживая все, кроме стартовой.
+type slowFetcher struct {
+	mapFetcher
+	delay time.Duration
+}
+
+func (f slowFetcher) Fetch(u *url.URL, useRobots bool) (*Response, error) {
+	if u.Path != "/" {
+		time.Sleep(f.delay)
+	}
+	return f.mapFetcher.Fetch(u, useRobots)
+}
+
+func TestCrawler_BudgetSkipsDequeued(t *testing.T) {
+	fetcher := slowFetcher{delay: 50 * time.Millisecond, mapFetcher: mapFetcher{
+		"/":  `<a href="/1">1</a><a href="/2">2</a><a href="/3">3</a><a href="/4">4</a><a href="/5">5</a>`,
+		"/1": "1", "/2": "2", "/3": "3", "/4": "4", "/5": "5",
+	}}
+	cfg := testConfig(t, "https://example.com/")
+	cfg.Concurrency = 1
+	cfg.MaxDuration = 75 * time.Millisecond
+	c, err := New(Options{
+		Config:  cfg,
+		Storage: &memStorage{files: make(map[string]string)},
+		Fetcher: fetcher,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var skipped []Event
+	c.Subscribe(func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		skipped = append(skipped, e)
+	}, Skipped)
+
+	result, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	// Каждая поставленная в очередь задача попадает в итог, в том числе не начатые.
+	if result.Total != 6 {
+		t.Errorf("expected all 6 URLs in the summary, got %d", result.Total)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(skipped) == 0 || result.Succeeded+len(skipped) != 6 {
+		t.Fatalf("expected the rest to be skipped, got %d succeeded and %d skipped", result.Succeeded, len(skipped))
+	}
+	for _, e := range skipped {
+		if !strings.Contains(e.Reason, "max duration") {
+			t.Errorf("expected budget reason for %s, got %q", e.URL, e.Reason)
+		}
+	}
+}
+
+func TestNew_UpdateNeedsLoader(t *testing.T) {
+	cfg := testConfig(t, "https://example.com/")
+	cfg.Update = true
+	_, err := New(Options{Config: cfg, Storage: &memStorage{}, Fetcher: mapFetcher{}})
+	if !errors.Is(err, ErrUpdateUnsupported) {
+		t.Errorf("expected ErrUpdateUnsupported, got %v", err)
+	}
+}
+
+func TestConfigTypes(t *testing.T) {
+	cfg := testConfig(t, "https://example.com/")
+	var err error
+	if cfg.RateSchedule, err = ParseSchedule("09:00-18:00=2/256KB"); err != nil || len(cfg.RateSchedule) != 1 {
+		t.Errorf("ParseSchedule: %v %v", cfg.RateSchedule, err)
+	}
+	if cfg.PriorityPatterns, err = ParsePatternWeights("/docs/=10"); err != nil || len(cfg.PriorityPatterns) != 1 {
+		t.Errorf("ParsePatternWeights: %v %v", cfg.PriorityPatterns, err)
+	}
+	spec, err := ParseTransform("strip-trackers")
+	if err != nil {
+		t.Errorf("ParseTransform: %v", err)
+	}
+	cfg.Transforms = []TransformSpec{spec}
+	if cfg.HookEvents, err = ParseEventTypes("saved,failed"); err != nil || cfg.HookEvents[0] != Saved {
+		t.Errorf("ParseEventTypes: %v %v", cfg.HookEvents, err)
+	}
+	if cfg.Dedup, err = ParseDedup("symlink"); err != nil || cfg.Dedup != DedupSymlink {
+		t.Errorf("ParseDedup: %v %v", cfg.Dedup, err)
+	}
+	if _, err = New(Options{Config: cfg, Fetcher: mapFetcher{}}); err != nil {
+		t.Errorf("New with parsed values returned error: %v", err)
+	}
+}
+
+func TestNew_OutputNotWritable(t *testing.T) {
+	cfg := testConfig(t, "https://example.com/")
+	cfg.OutputDir = filepath.Join(cfg.OutputDir, "out")
+	if err := os.WriteFile(cfg.OutputDir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(Options{Config: cfg, Fetcher: mapFetcher{}}); !errors.Is(err, ErrOutputNotWritable) {
+		t.Errorf("expected ErrOutputNotWritable, got %v", err)
+	}
+	// Своё хранилище не пишет в каталог вывода.
+	if _, err := New(Options{Config: cfg, Storage: &memStorage{}, Fetcher: mapFetcher{}}); err != nil {
+		t.Errorf("New with custom storage returned error: %v", err)
+	}
+}
+
+func TestCrawler_Transforms(t *testing.T) {
+	cfg := testConfig(t, "https://example.com/")
+	spec, err := transform.ParseSpec("rewrite-links,banner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Transforms = []transform.Spec{spec}
+	upper := TransformRule{Transformer: transform.Func(func(doc *Document) error {
+		doc.Body = bytes.ToUpper(doc.Body)
+		return nil
+	})}
+	c, err := New(Options{
+		Config:     cfg,
+		Fetcher:    mapFetcher{"/": `<a href="/docs/b">b</a>`, "/docs/b": `<p>b</p>`},
+		Transforms: []TransformRule{upper},
+	})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	result, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	// Ссылки для обхода берутся из исходной страницы, поэтому /docs/b скачан.
+	if result.Succeeded != 2 {
+		t.Fatalf("expected 2 pages, got %d", result.Succeeded)
+	}
+
+	home, err := os.ReadFile(filepath.Join(cfg.OutputDir, "example.com", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`HREF="DOCS/B.HTML"`, "ARCHIVED FROM"} {
+		if !bytes.Contains(home, []byte(want)) {
+			t.Errorf("expected %q in saved page, got %s", want, home)
+		}
+	}
+
+	// Манифест описывает файл на диске, то есть после преобразований.
+	manifest, err := storage.ReadManifest(filepath.Join(cfg.OutputDir, cfg.Manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, ok := manifest.Get("https://example.com/")
+	if len(manifest.Entries()) != 2 || !ok || entry.SHA256 != storage.Checksum(home) {
+		t.Errorf("unexpected manifest %+v", manifest.Entries())
+	}
+}
+
+func TestNew_RewriteNeedsLocator(t *testing.T) {
+	cfg := testConfig(t, "https://example.com/")
+	spec, _ := transform.ParseSpec(transform.RewriteLinksName)
+	cfg.Transforms = []transform.Spec{spec}
+	_, err := New(Options{Config: cfg, Storage: &memStorage{}, Fetcher: mapFetcher{}})
+	if !errors.Is(err, ErrRewriteUnsupported) {
+		t.Errorf("expected ErrRewriteUnsupported, got %v", err)
+	}
+}
+
+func TestCrawler_LinkGraph(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<a href="/a#top" rel="next">Next page</a><a href="https://other.com/">out</a>` +
+				`<link rel="stylesheet" href="/style.css">`))
+		case "/a", "/orphan", "/bg.png":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<p>page</p>`))
+		case "/style.css":
+			w.Header().Set("Content-Type", "text/css")
+			_, _ = w.Write([]byte(`body { background: url(/bg.png) }`))
+		case "/sitemap.xml":
+			_, _ = w.Write([]byte(`<urlset><url><loc>` + "http://" + r.Host + `/orphan</loc></url></urlset>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cfg := testConfig(t, server.URL+"/")
+	cfg.UseSitemap = true
+	cfg.LinkGraph = "graph.json"
+	c, err := New(Options{Config: cfg, Storage: &memStorage{files: make(map[string]string)}})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if _, err = c.Run(context.Background()); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	g, err := linkgraph.Read(filepath.Join(cfg.OutputDir, "graph.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[linkgraph.Edge]bool{
+		{Source: server.URL + "/", Target: server.URL + "/a", Element: "a", Attr: "href", Text: "Next page", Rel: "next"}: true,
+		{Source: server.URL + "/", Target: "https://other.com/", Element: "a", Attr: "href", Text: "out"}:                 true,
+		{Source: server.URL + "/", Target: server.URL + "/style.css", Element: "link", Attr: "href", Rel: "stylesheet"}:   true,
+		{Source: server.URL + "/style.css", Target: server.URL + "/bg.png", Element: "css", Attr: "url"}:                  true,
+	}
+	edges := g.Edges()
+	if len(edges) != len(want) {
+		t.Errorf("expected %d edges, got %+v", len(want), edges)
+	}
+	for _, e := range edges {
+		if !want[e] {
+			t.Errorf("unexpected edge %+v", e)
+		}
+	}
+	stats := g.Stats(10)
+	if len(stats.Orphans) != 1 || stats.Orphans[0] != server.URL+"/orphan" {
+		t.Errorf("expected /orphan from sitemap as orphan, got %v", stats.Orphans)
+	}
+}
+
+func TestCrawler_RunCanceled(t *testing.T) {
+	cfg := testConfig(t, "https://example.com/")
+	c, err := New(Options{Config: cfg, Storage: &memStorage{files: make(map[string]string)}, Fetcher: mapFetcher{"/": "home"}})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err = c.Run(ctx); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(cfg.OutputDir, cfg.CheckpointFile)); err != nil {
+		t.Errorf("expected checkpoint after cancellation: %v", err)
+	}
+}
+
+func TestCrawler_Snapshot(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<p>same every run</p>`))
+	}))
+	defer server.Close()
+
+	cfg := testConfig(t, server.URL+"/")
+	cfg.Snapshot = true
+	for run := 0; run < 2; run++ {
+		c, err := New(Options{Config: cfg})
+		if err != nil {
+			t.Fatalf("New returned error: %v", err)
+		}
+		result, err := c.Run(context.Background())
+		if err != nil {
+			t.Fatalf("Run returned error: %v", err)
+		}
+		if _, err = os.Stat(filepath.Join(result.Snapshot, storage.DefaultManifestFile)); err != nil {
+			t.Errorf("expected manifest in snapshot %q: %v", result.Snapshot, err)
+		}
+		if run == 1 && result.DedupFiles != 1 {
+			t.Errorf("expected the unchanged page to share a blob, got %d", result.DedupFiles)
+		}
+	}
+
+	names, err := storage.Snapshots(cfg.OutputDir)
+	if err != nil || len(names) != 2 {
+		t.Errorf("expected 2 snapshots, got %v %v", names, err)
+	}
+}
+
+func TestCrawler_UpdatePrunes(t *testing.T) {
+	var mu sync.Mutex
+	pages := map[string]string{
+		"/":  `<a href="/a">a</a><a href="/b">b</a>`,
+		"/a": `<p>a</p>`,
+		"/b": `<p>b</p>`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		body, ok := pages[r.URL.Path]
+		mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	cfg := testConfig(t, server.URL+"/")
+	var removed []string
+	run := func() {
+		t.Helper()
+		c, err := New(Options{Config: cfg})
+		if err != nil {
+			t.Fatalf("New returned error: %v", err)
+		}
+		c.Subscribe(func(e Event) {
+			mu.Lock()
+			removed = append(removed, e.Kind+" "+strings.TrimPrefix(e.URL, server.URL)+" "+e.Reason)
+			mu.Unlock()
+		}, Removed)
+		if _, err = c.Run(context.Background()); err != nil {
+			t.Fatalf("Run returned error: %v", err)
+		}
+	}
+	run()
+
+	// /a пропал с сайта, на /b больше нет ссылок.
+	mu.Lock()
+	pages["/"] = `<a href="/a">a</a>`
+	delete(pages, "/a")
+	mu.Unlock()
+	cfg.Update = true
+	run()
+
+	m, err := storage.ReadManifest(filepath.Join(cfg.OutputDir, cfg.Manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Entries(); len(got) != 1 || got[0].URL != server.URL+"/" {
+		t.Errorf("expected only the start page in the manifest, got %+v", got)
+	}
+	host := filepath.Join(cfg.OutputDir, strings.TrimPrefix(server.URL, "http://"))
+	for _, name := range []string{"a.html", "b.html"} {
+		if _, err = os.Stat(filepath.Join(host, name)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected %s to be removed, got %v", name, err)
+		}
+	}
+	slices.Sort(removed)
+	if want := []string{"page /a gone", "page /b not linked"}; !slices.Equal(removed, want) {
+		t.Errorf("expected Removed events %v, got %v", want, removed)
+	}
+}
+
+func TestCrawler_UpdateValidators(t *testing.T) {
+	lastModified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC).Format(http.TimeFormat)
+	var mu sync.Mutex
+	conditions := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		conditions[r.URL.Path] = r.Header.Get("If-None-Match") + "|" + r.Header.Get("If-Modified-Since")
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			if r.Header.Get("If-None-Match") == `"home-1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"home-1"`)
+			_, _ = w.Write([]byte(`<a href="/dated">dated</a>`))
+		case "/dated":
+			w.Header().Set("Last-Modified", lastModified)
+			_, _ = w.Write([]byte(`<p>dated</p>`))
+		}
+	}))
+	defer server.Close()
+
+	cfg := testConfig(t, server.URL+"/")
+	for run := 0; run < 2; run++ {
+		c, err := New(Options{Config: cfg})
+		if err != nil {
+			t.Fatalf("New returned error: %v", err)
+		}
+		if _, err = c.Run(context.Background()); err != nil {
+			t.Fatalf("Run returned error: %v", err)
+		}
+		cfg.Update = true
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got := conditions["/"]; !strings.HasPrefix(got, `"home-1"|`) {
+		t.Errorf("expected If-None-Match with the stored ETag for /, got %q", got)
+	}
+	// Время сервера, а не время записи файла.
+	if got := conditions["/dated"]; got != "|"+lastModified {
+		t.Errorf("expected If-Modified-Since from the stored Last-Modified, got %q", got)
+	}
+	m, err := storage.ReadManifest(filepath.Join(cfg.OutputDir, cfg.Manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, _ := m.Get(server.URL + "/"); e.ETag != `"home-1"` {
+		t.Errorf("expected ETag to survive a 304, got %+v", e)
+	}
+}
+
+func TestCrawler_NearDuplicates(t *testing.T) {
+	text := `<p>The committee published the new rules for banks on Monday. Banks must report
+large transfers within three days and keep records for five years.</p>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch {
+		case r.URL.Path == "/":
+			_, _ = w.Write([]byte(`<a href="/rules">rules</a><a href="/rules?print=1">print</a>`))
+		case r.URL.Path == "/rules" && r.URL.RawQuery == "":
+			_, _ = w.Write([]byte(text))
+		case r.URL.Path == "/rules":
+			// Ссылки почти копии не обходятся.
+			_, _ = w.Write([]byte(`<h1>Print version</h1>` + text + `<a href="/archive">archive</a>`))
+		default:
+			_, _ = w.Write([]byte(`<p>archive</p>`))
+		}
+	}))
+	defer server.Close()
+
+	cfg := testConfig(t, server.URL+"/")
+	cfg.Concurrency = 1
+	cfg.NearDup = 0.9
+	cfg.NearDupSkipLinks = true
+	store := &memStorage{files: make(map[string]string)}
+	c, err := New(Options{Config: cfg, Storage: store})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	result, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	if result.NearDuplicates != 1 || result.Total != 3 {
+		t.Errorf("expected 3 pages with one near-duplicate, got %d of %d", result.NearDuplicates, result.Total)
+	}
+	if _, ok := store.files["/archive"]; ok {
+		t.Error("expected links of the near-duplicate not to be followed")
+	}
+	report, err := neardup.Read(filepath.Join(cfg.OutputDir, neardup.DefaultFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Clusters) != 1 || report.Clusters[0].URL != server.URL+"/rules" ||
+		report.Clusters[0].Duplicates[0].URL != server.URL+"/rules?print=1" {
+		t.Errorf("unexpected clusters %+v", report.Clusters)
+	}
+}